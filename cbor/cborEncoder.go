@@ -1,6 +1,7 @@
 package cbor
 
 import (
+	"fmt"
 	"io"
 
 	. "github.com/polydawn/refmt/tok"
@@ -51,17 +52,23 @@ func (d *Encoder) pushPhase(p encoderPhase) {
 }
 
 // Pop a phase from the stack; return 'true' if stack now empty.
-func (d *Encoder) popPhase() bool {
+func (d *Encoder) popPhase() (bool, error) {
 	n := len(d.stack) - 1
 	if n == 0 {
-		return true
+		return true, nil
 	}
 	if n < 0 { // the state machines are supposed to have already errored better
-		panic("cborEncoder stack overpopped")
+		return true, fmt.Errorf("cbor encoder stack overpopped")
 	}
 	d.current = d.stack[n-1]
 	d.stack = d.stack[0:n]
-	return false
+	return false, nil
+}
+
+// Error for when the encoder's phase is none of the known ones
+// (which the state machines should make impossible).
+func (d *Encoder) errInvalidPhase() error {
+	return fmt.Errorf("cbor encoder in invalid phase %d", d.current)
 }
 
 func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
@@ -93,19 +100,22 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForKey}
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	case TMapClose:
 		switch phase {
 		case phase_mapDefExpectKeyOrEnd:
-			return d.popPhase(), nil
+			return d.popPhase()
 		case phase_mapIndefExpectKeyOrEnd:
 			d.w.writen1(cborSigilBreak)
-			return d.popPhase(), d.w.checkErr()
+			if err := d.w.checkErr(); err != nil {
+				return true, err
+			}
+			return d.popPhase()
 		case phase_anyExpectValue, phase_mapDefExpectValue, phase_mapIndefExpectValue, phase_arrDefExpectValueOrEnd, phase_arrIndefExpectValueOrEnd:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForValue}
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	case TArrOpen:
 		switch phase {
@@ -127,21 +137,24 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForKey}
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	case TArrClose:
 		switch phase {
 		case phase_arrDefExpectValueOrEnd:
-			return d.popPhase(), nil
+			return d.popPhase()
 		case phase_arrIndefExpectValueOrEnd:
 			d.w.writen1(cborSigilBreak)
-			return d.popPhase(), d.w.checkErr()
+			if err := d.w.checkErr(); err != nil {
+				return true, err
+			}
+			return d.popPhase()
 		case phase_anyExpectValue, phase_mapDefExpectValue, phase_mapIndefExpectValue:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForValue}
 		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForKey}
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	case TNull: // terminal value; not accepted as map key.
 		switch phase {
@@ -157,7 +170,7 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForKey}
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	case TString: // terminal value; YES, accepted as map key.
 		switch phase {
@@ -170,7 +183,7 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 			d.current += 1
 			goto emitStr
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	emitStr:
 		{
@@ -194,23 +207,28 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForKey}
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
-	case TBool: // terminal value; not accepted as map key.
+	case TBool: // terminal value; YES, accepted as map key.
 		switch phase {
 		case phase_mapDefExpectValue, phase_mapIndefExpectValue:
 			d.current -= 1
 			fallthrough
 		case phase_anyExpectValue, phase_arrDefExpectValueOrEnd, phase_arrIndefExpectValueOrEnd:
+			goto emitBool
+		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
+			d.current += 1
+			goto emitBool
+		default:
+			return true, d.errInvalidPhase()
+		}
+	emitBool:
+		{
 			if tokenSlot.Tagged {
 				d.emitMajorPlusLen(cborMajorTag, uint64(tokenSlot.Tag))
 			}
 			d.encodeBool(tokenSlot.Bool)
 			return phase == phase_anyExpectValue, d.w.checkErr()
-		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
-			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForKey}
-		default:
-			panic("unreachable phase")
 		}
 	case TInt: // terminal value; YES, accepted as map key.
 		switch phase {
@@ -223,7 +241,7 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 			d.current += 1
 			goto emitInt
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	emitInt:
 		{
@@ -244,7 +262,7 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 			d.current += 1
 			goto emitUint
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	emitUint:
 		{
@@ -268,9 +286,9 @@ func (d *Encoder) Step(tokenSlot *Token) (done bool, err error) {
 		case phase_mapDefExpectKeyOrEnd, phase_mapIndefExpectKeyOrEnd:
 			return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForKey}
 		default:
-			panic("unreachable phase")
+			return true, d.errInvalidPhase()
 		}
 	default:
-		panic("unhandled token type")
+		return true, &ErrInvalidTokenStream{Got: *tokenSlot, Acceptable: tokenTypesForValue}
 	}
 }
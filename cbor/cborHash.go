@@ -0,0 +1,198 @@
+package cbor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"hash"
+
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	HashSink is a TokenSink which computes a digest of the canonical cbor
+	encoding of a value, feeding the encoding straight to the hash as it
+	goes (so the whole serial form is never held in memory).
+
+	The token stream must already be in canonical form: every map and array
+	must declare its Length, and map keys must be in canonical order
+	(as in RFC 7049 section 3.9: shorter encodings first, then bytewise),
+	with no repeats.  Anything else is rejected with ErrNonCanonical
+	rather than silently hashed, since two different streams for the same
+	value would give different digests.  (An obj.Marshaller with
+	MarshalOptions.CanonicalKeyOrder produces canonical streams;
+	the top-level refmt.Hash function does just that.)
+	The stream is also checked to be well-formed, as shared.Validator does.
+
+	Once the sink says it's done, Sum has the digest.  Reset to hash another.
+*/
+type HashSink struct {
+	h      hash.Hash
+	enc    *Encoder
+	v      shared.Validator
+	index  int
+	frames []hashFrame
+
+	keyBuf bytes.Buffer
+	keyEnc *Encoder
+}
+
+type hashFrame struct {
+	isMap   bool
+	wantKey bool   // for maps: whether the next token is a key.
+	lastKey []byte // for maps: the encoding of the previous key (nil if none yet).
+}
+
+/*
+	Create a HashSink feeding the given hash.  If it's nil, SHA-256 is used.
+*/
+func NewHashSink(h hash.Hash) *HashSink {
+	if h == nil {
+		h = sha256.New()
+	}
+	s := &HashSink{h: h, enc: NewEncoder(h)}
+	s.keyEnc = NewEncoder(&s.keyBuf)
+	return s
+}
+
+func (s *HashSink) Step(tok *Token) (done bool, err error) {
+	i := s.index
+	s.index++
+	if _, err := s.v.Step(tok); err != nil {
+		return true, err
+	}
+	if err := s.checkCanonical(i, tok); err != nil {
+		return true, err
+	}
+	return s.enc.Step(tok)
+}
+
+func (s *HashSink) checkCanonical(i int, tok *Token) error {
+	var top *hashFrame
+	if n := len(s.frames); n > 0 {
+		top = &s.frames[n-1]
+	}
+	switch tok.Type {
+	case TMapClose, TArrClose:
+		s.frames = s.frames[:len(s.frames)-1]
+		if n := len(s.frames); n > 0 && s.frames[n-1].isMap {
+			s.frames[n-1].wantKey = true
+		}
+		return nil
+	}
+	if top != nil && top.isMap && top.wantKey {
+		// Encode the key, and check it comes after the last one.
+		s.keyBuf.Reset()
+		s.keyEnc.Reset()
+		if _, err := s.keyEnc.Step(tok); err != nil {
+			return err
+		}
+		key := s.keyBuf.Bytes()
+		if top.lastKey != nil {
+			switch {
+			case len(key) < len(top.lastKey):
+				return ErrNonCanonical{i, *tok, "map key out of canonical order (shorter than the previous key)"}
+			case len(key) == len(top.lastKey):
+				switch bytes.Compare(key, top.lastKey) {
+				case 0:
+					return ErrNonCanonical{i, *tok, "repeated map key"}
+				case -1:
+					return ErrNonCanonical{i, *tok, "map key out of canonical order"}
+				}
+			}
+		}
+		top.lastKey = append(top.lastKey[:0], key...)
+		top.wantKey = false
+		return nil
+	}
+	if top != nil && top.isMap {
+		top.wantKey = true
+	}
+	switch tok.Type {
+	case TMapOpen, TArrOpen:
+		if tok.Length < 0 {
+			return ErrNonCanonical{i, *tok, "maps and arrays must declare their length"}
+		}
+		s.frames = append(s.frames, hashFrame{isMap: tok.Type == TMapOpen, wantKey: true})
+	}
+	return nil
+}
+
+/*
+	Sum appends the digest to b and returns the resulting slice,
+	like hash.Hash.Sum.  It's only meaningful once the sink is done.
+*/
+func (s *HashSink) Sum(b []byte) []byte {
+	return s.h.Sum(b)
+}
+
+/*
+	Reset clears the sink (and its hash), so it can hash another value.
+*/
+func (s *HashSink) Reset() {
+	s.h.Reset()
+	s.enc.Reset()
+	s.v.Reset()
+	s.index = 0
+	s.frames = s.frames[:0]
+}
+
+// Multihash function codes, for use with Multihash and CID.
+// See https://github.com/multiformats/multicodec for the full table.
+const (
+	MultihashSHA2_256 = 0x12 // The hash NewHashSink uses by default.
+	MultihashSHA2_512 = 0x13
+)
+
+// The multicodec code for dag-cbor, which is what CIDs made by HashSink.CID say
+// the content is (canonical cbor is valid dag-cbor).
+const CodecDagCbor = 0x71
+
+/*
+	Multihash returns the digest in multihash form: the hash function code,
+	the digest length, and the digest.  The code must be the one for the
+	hash the sink was made with (MultihashSHA2_256, for the default).
+*/
+func (s *HashSink) Multihash(code uint64) []byte {
+	digest := s.Sum(nil)
+	mh := appendUvarint(nil, code)
+	mh = appendUvarint(mh, uint64(len(digest)))
+	return append(mh, digest...)
+}
+
+// Like binary.AppendUvarint (which needs Go 1.19).
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+/*
+	CID returns a CIDv1 (in binary form) for the hashed value, with the
+	dag-cbor codec.  The code is as for Multihash.
+*/
+func (s *HashSink) CID(code uint64) []byte {
+	cid := appendUvarint(nil, 1) // CID version.
+	cid = appendUvarint(cid, CodecDagCbor)
+	return append(cid, s.Multihash(code)...)
+}
+
+/*
+	CIDString returns the string form of a binary CIDv1:
+	multibase base32 (lowercase, no padding), which starts with "b".
+*/
+func CIDString(cid []byte) string {
+	return "b" + cidBase32.EncodeToString(cid)
+}
+
+var cidBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+/*
+	CIDToken returns the token for a link to a binary CID, as dag-cbor
+	encodes them: bytes (with a leading zero byte, the multibase prefix
+	for raw binary), tagged 42.
+*/
+func CIDToken(cid []byte) Token {
+	return Token{Type: TBytes, Bytes: append([]byte{0}, cid...), Tagged: true, Tag: 42}
+}
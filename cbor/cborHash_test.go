@@ -0,0 +1,81 @@
+package cbor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+func hashTokens(sink *HashSink, toks ...Token) error {
+	for _, tok := range toks {
+		if _, err := sink.Step(&tok); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestHashSink(t *testing.T) {
+	toks := []Token{
+		{Type: TMapOpen, Length: 2},
+		TokStr("b"), TokInt(1),
+		TokStr("aa"), {Type: TArrOpen, Length: 1}, {Type: TBool, Bool: true}, {Type: TArrClose},
+		{Type: TMapClose},
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	for _, tok := range toks {
+		enc.Step(&tok)
+	}
+	expect := sha256.Sum256(buf.Bytes())
+
+	t.Run("sha256", func(t *testing.T) {
+		sink := NewHashSink(nil)
+		Wish(t, hashTokens(sink, toks...), ShouldEqual, nil)
+		Wish(t, sink.Sum(nil), ShouldEqual, expect[:])
+		t.Run("multihash", func(t *testing.T) {
+			Wish(t, sink.Multihash(MultihashSHA2_256), ShouldEqual, append([]byte{0x12, 0x20}, expect[:]...))
+		})
+		t.Run("cid", func(t *testing.T) {
+			cid := sink.CID(MultihashSHA2_256)
+			Wish(t, cid, ShouldEqual, append([]byte{0x01, 0x71, 0x12, 0x20}, expect[:]...))
+			Wish(t, CIDString(cid)[:4], ShouldEqual, "bafy") // as all dag-cbor sha256 CIDv1s do.
+			Wish(t, CIDToken(cid), ShouldEqual, Token{Type: TBytes, Bytes: append([]byte{0}, cid...), Tagged: true, Tag: 42})
+		})
+		t.Run("reset", func(t *testing.T) {
+			sink.Reset()
+			Wish(t, hashTokens(sink, toks...), ShouldEqual, nil)
+			Wish(t, sink.Sum(nil), ShouldEqual, expect[:])
+		})
+	})
+	t.Run("other hashes", func(t *testing.T) {
+		sink := NewHashSink(sha512.New())
+		Wish(t, hashTokens(sink, toks...), ShouldEqual, nil)
+		expect := sha512.Sum512(buf.Bytes())
+		Wish(t, hex.EncodeToString(sink.Sum(nil)), ShouldEqual, hex.EncodeToString(expect[:]))
+	})
+	t.Run("non-canonical streams are rejected", func(t *testing.T) {
+		err := hashTokens(NewHashSink(nil), Token{Type: TArrOpen, Length: -1})
+		Wish(t, err, ShouldEqual, ErrNonCanonical{0, Token{Type: TArrOpen, Length: -1}, "maps and arrays must declare their length"})
+		err = hashTokens(NewHashSink(nil), Token{Type: TMapOpen, Length: 2}, TokStr("aa"), TokInt(1), TokStr("b"))
+		Wish(t, err, ShouldEqual, ErrNonCanonical{3, TokStr("b"), "map key out of canonical order (shorter than the previous key)"})
+		err = hashTokens(NewHashSink(nil), Token{Type: TMapOpen, Length: 2}, TokStr("b"), TokInt(1), TokStr("a"))
+		Wish(t, err, ShouldEqual, ErrNonCanonical{3, TokStr("a"), "map key out of canonical order"})
+		err = hashTokens(NewHashSink(nil), Token{Type: TMapOpen, Length: 2}, TokStr("b"), TokInt(1), TokStr("b"))
+		Wish(t, err, ShouldEqual, ErrNonCanonical{3, TokStr("b"), "repeated map key"})
+		// Keys of nested maps are ordered separately.
+		err = hashTokens(NewHashSink(nil),
+			Token{Type: TMapOpen, Length: 2},
+			TokStr("b"), Token{Type: TMapOpen, Length: 1}, TokStr("zz"), TokInt(1), Token{Type: TMapClose},
+			TokStr("cc"), TokInt(2),
+			Token{Type: TMapClose},
+		)
+		Wish(t, err, ShouldEqual, nil)
+	})
+}
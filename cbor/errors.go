@@ -18,5 +18,19 @@ func (e *ErrInvalidTokenStream) Error() string {
 	// More comprehensible strings might include "start of value", "start of key or end of map", "start of value or end of array".
 }
 
-var tokenTypesForKey = []TokenType{TString, TInt, TUint}
+var tokenTypesForKey = []TokenType{TString, TInt, TUint, TBool}
 var tokenTypesForValue = []TokenType{TMapOpen, TArrOpen, TNull, TString, TBytes, TInt, TUint, TFloat64}
+
+// ErrNonCanonical is returned by HashSink when the token stream doesn't
+// have a canonical cbor encoding: because a map or array has no declared
+// length, or map keys aren't in canonical order (or repeat).
+// Index is the index of the offending token within the value.
+type ErrNonCanonical struct {
+	Index  int
+	Token  Token
+	Reason string
+}
+
+func (e ErrNonCanonical) Error() string {
+	return fmt.Sprintf("non-canonical token stream: token %d (%s): %s", e.Index, e.Token, e.Reason)
+}
@@ -28,11 +28,14 @@ func newYamlTokenSource(in io.Reader) shared.TokenSource {
 		return errthunkTokenSource{fmt.Errorf("refmt: error reading: %s", err)}
 	}
 	byts = tab2space(byts)
-	var barf interface{}
-	if err := yaml.Unmarshal(byts, &barf); err != nil {
+	var doc yamlOrdered
+	if err := yaml.Unmarshal(byts, &doc); err != nil {
+		return errthunkTokenSource{fmt.Errorf("refmt: error deserializing yaml: %s", err)}
+	}
+	barf, err := stringifyMapKeys(doc.v)
+	if err != nil {
 		return errthunkTokenSource{fmt.Errorf("refmt: error deserializing yaml: %s", err)}
 	}
-	barf = stringifyMapKeys(barf)
 	tokenSrc := obj.NewMarshaller(atlas.MustBuild())
 	if err := tokenSrc.Bind(barf); err != nil {
 		return errthunkTokenSource{fmt.Errorf("refmt: error deserializing yaml: %s", err)}
@@ -40,6 +43,35 @@ func newYamlTokenSource(in io.Reader) shared.TokenSource {
 	return tokenSrc
 }
 
+/*
+	A yaml value which keeps the order of map keys, however deep the maps are.
+
+	Unmarshalling into a yaml.MapSlice keeps the order of the map and of
+	every map inside it (whatever it's in), but there's no such option for
+	a document that's a sequence, so sequences are unmarshalled into this
+	again, one element at a time.
+*/
+type yamlOrdered struct {
+	v interface{}
+}
+
+func (y *yamlOrdered) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	// Sequences have to be tried first: the yaml library will happily
+	//  unmarshal a sequence of maps into a MapSlice, as if they were MapItems.
+	//  (Nulls never get here at all, so they can't be mistaken for either.)
+	var seq []yamlOrdered
+	if err := unmarshal(&seq); err == nil {
+		y.v = seq
+		return nil
+	}
+	var mapSlice yaml.MapSlice
+	if err := unmarshal(&mapSlice); err == nil {
+		y.v = mapSlice
+		return nil
+	}
+	return unmarshal(&y.v)
+}
+
 type errthunkTokenSource struct {
 	err error
 }
@@ -52,22 +84,73 @@ func (x errthunkTokenSource) Step(*tok.Token) (done bool, err error) {
 	Yaml things anything can be a map key.
 	Most things think only strings can be a map key.
 	This func makes yaml outputs into what everyone else expects.
+
+	Scalar keys which aren't strings (e.g. `1: x`) become strings the way
+	they were written; anything else as a key is an error.
+
+	Ordered maps from yaml become obj.OrderedMap, so the order survives.
 */
-func stringifyMapKeys(value interface{}) interface{} {
+func stringifyMapKeys(value interface{}) (interface{}, error) {
 	switch value := value.(type) {
+	case yaml.MapSlice:
+		next := make(obj.OrderedMap, len(value))
+		for i, item := range value {
+			k, err := stringifyMapKey(item.Key)
+			if err != nil {
+				return nil, err
+			}
+			v, err := stringifyMapKeys(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			next[i] = obj.OrderedMapEntry{k, v}
+		}
+		return next, nil
 	case map[interface{}]interface{}:
 		next := make(map[string]interface{}, len(value))
 		for k, v := range value {
-			next[k.(string)] = stringifyMapKeys(v)
+			k, err := stringifyMapKey(k)
+			if err != nil {
+				return nil, err
+			}
+			next[k], err = stringifyMapKeys(v)
+			if err != nil {
+				return nil, err
+			}
 		}
-		return next
+		return next, nil
+	case []yamlOrdered:
+		next := make([]interface{}, len(value))
+		for i, item := range value {
+			v, err := stringifyMapKeys(item.v)
+			if err != nil {
+				return nil, err
+			}
+			next[i] = v
+		}
+		return next, nil
 	case []interface{}:
 		for i := 0; i < len(value); i++ {
-			value[i] = stringifyMapKeys(value[i])
+			v, err := stringifyMapKeys(value[i])
+			if err != nil {
+				return nil, err
+			}
+			value[i] = v
 		}
-		return value
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+func stringifyMapKey(key interface{}) (string, error) {
+	switch key := key.(type) {
+	case string:
+		return key, nil
+	case int, int64, uint, uint64, float64, bool:
+		return fmt.Sprint(key), nil
 	default:
-		return value
+		return "", fmt.Errorf("unsupported map key %v (map keys must be strings, numbers, or bools)", key)
 	}
 }
 
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+)
+
+func TestYaml(t *testing.T) {
+	run := func(t *testing.T, cmd, in string) (string, string, int) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		code := Main([]string{"refmt", cmd}, strings.NewReader(in), &stdout, &stderr)
+		return stdout.String(), stderr.String(), code
+	}
+	t.Run("map keeps key order", func(t *testing.T) {
+		out, _, code := run(t, "yaml=json", "z: 1\na:\n  c: 2\n  b: 3\n")
+		Wish(t, code, ShouldEqual, 0)
+		Wish(t, out, ShouldEqual, `{"z":1,"a":{"c":2,"b":3}}`)
+	})
+	t.Run("sequence at the top level", func(t *testing.T) {
+		out, _, code := run(t, "yaml=json", "- z: 1\n  a: 2\n- x\n")
+		Wish(t, code, ShouldEqual, 0)
+		Wish(t, out, ShouldEqual, `[{"z":1,"a":2},"x"]`)
+	})
+	t.Run("maps at every depth keep key order", func(t *testing.T) {
+		out, _, code := run(t, "yaml=json", "- b: 1\n  a: [{d: 1, c: 2}, [{f: 1, e: 2}]]\n- {}\n- []\n- ~\n")
+		Wish(t, code, ShouldEqual, 0)
+		Wish(t, out, ShouldEqual, `[{"b":1,"a":[{"d":1,"c":2},[{"f":1,"e":2}]]},{},[],null]`)
+	})
+	t.Run("scalar at the top level", func(t *testing.T) {
+		out, _, code := run(t, "yaml=json", "hello\n")
+		Wish(t, code, ShouldEqual, 0)
+		Wish(t, out, ShouldEqual, `"hello"`)
+	})
+	t.Run("non-string keys", func(t *testing.T) {
+		out, _, code := run(t, "yaml=json", "1: a\ntrue: b\n")
+		Wish(t, code, ShouldEqual, 0)
+		Wish(t, out, ShouldEqual, `{"1":"a","true":"b"}`)
+		_, errOut, code := run(t, "yaml=json", "- ~: a\n")
+		Wish(t, code, ShouldEqual, 1)
+		Wish(t, errOut, ShouldEqual, "error: refmt: error deserializing yaml: unsupported map key <nil> (map keys must be strings, numbers, or bools)\n")
+	})
+}
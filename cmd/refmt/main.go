@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/urfave/cli"
 
+	"github.com/polydawn/refmt"
 	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/infer"
 	"github.com/polydawn/refmt/json"
 	"github.com/polydawn/refmt/pretty"
 	"github.com/polydawn/refmt/shared"
@@ -151,6 +154,94 @@ func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 				}.Run()
 			},
 		},
+		//
+		// Queries
+		//
+		cli.Command{
+			Category:  "query",
+			Name:      "select",
+			Usage:     "read, emit only the value(s) at a path (a JSON Pointer, or jq-style like '.items[].id')",
+			ArgsUsage: "<path> <in>=<out>  (e.g. 'select .a.b json=json'; in is one of json, cbor, cbor.hex, yaml; out is one of json, cbor, cbor.hex, pretty)",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 2 {
+					return fmt.Errorf("select needs two arguments: a path, and a conversion like 'json=json'")
+				}
+				in, out, ok := strings.Cut(c.Args().Get(1), "=")
+				if !ok {
+					return fmt.Errorf("invalid conversion %q: should be like 'json=json'", c.Args().Get(1))
+				}
+				src, err := tokenSourceFor(in, stdin)
+				if err != nil {
+					return err
+				}
+				sink, err := tokenSinkFor(out, stdout)
+				if err != nil {
+					return err
+				}
+				sel, err := shared.NewSelector(src, c.Args().Get(0))
+				if err != nil {
+					return err
+				}
+				return shared.TokenPump{sel, sink}.Run()
+			},
+		},
+		//
+		// Schemas
+		//
+		cli.Command{
+			Category:  "schema",
+			Name:      "infer",
+			Usage:     "read a stream of documents, emit a schema inferred from them",
+			ArgsUsage: "<in>=<out>  (e.g. 'infer json=go'; in is one of json, cbor, cbor.hex, yaml; out is one of jsonschema, go)",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "type", Value: "Document", Usage: "name of the Go type for the documents"},
+				cli.StringFlag{Name: "package", Value: "main", Usage: "package of the Go source"},
+			},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("infer needs one argument: a conversion like 'json=jsonschema'")
+				}
+				in, out, ok := strings.Cut(c.Args().Get(0), "=")
+				if !ok {
+					return fmt.Errorf("invalid conversion %q: should be like 'json=jsonschema'", c.Args().Get(0))
+				}
+				if out != "jsonschema" && out != "go" {
+					return fmt.Errorf("unknown schema format %q", out)
+				}
+				src, err := tokenSourceFor(in, stdin)
+				if err != nil {
+					return err
+				}
+				var schema infer.Schema
+				if r, ok := src.(interface {
+					shared.TokenSource
+					Reset()
+				}); ok {
+					err = schema.AddAll(r)
+				} else {
+					err = schema.Add(src)
+				}
+				if err != nil {
+					return err
+				}
+				switch out {
+				case "jsonschema":
+					bs, err := refmt.Marshal(json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}, schema.JSONSchema())
+					if err != nil {
+						return err
+					}
+					_, err = stdout.Write(bs)
+					return err
+				default: // "go"
+					bs, err := schema.GoSource(c.String("package"), c.String("type"))
+					if err != nil {
+						return err
+					}
+					_, err = stdout.Write(bs)
+					return err
+				}
+			},
+		},
 	}
 	app.Writer = stdout
 	app.ErrWriter = stderr
@@ -161,3 +252,33 @@ func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	}
 	return 0
 }
+
+func tokenSourceFor(format string, stdin io.Reader) (shared.TokenSource, error) {
+	switch format {
+	case "json":
+		return json.NewDecoder(stdin), nil
+	case "cbor":
+		return cbor.NewDecoder(cbor.DecodeOptions{}, stdin), nil
+	case "cbor.hex":
+		return cbor.NewDecoder(cbor.DecodeOptions{}, hexReader(stdin)), nil
+	case "yaml":
+		return newYamlTokenSource(stdin), nil
+	default:
+		return nil, fmt.Errorf("unknown input format %q", format)
+	}
+}
+
+func tokenSinkFor(format string, stdout io.Writer) (shared.TokenSink, error) {
+	switch format {
+	case "json":
+		return json.NewEncoder(stdout, json.EncodeOptions{}), nil
+	case "cbor":
+		return cbor.NewEncoder(stdout), nil
+	case "cbor.hex":
+		return cbor.NewEncoder(hexWriter{stdout}), nil
+	case "pretty":
+		return pretty.NewEncoder(stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
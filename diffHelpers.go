@@ -0,0 +1,392 @@
+package refmt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/obj"
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Equal reports whether a and b marshal to the same tokens (with the
+	atlas), so they may be of different Go types -- a struct and a map with
+	the same entries are equal, for instance.
+
+	Map keys and struct fields are compared regardless of their order, and
+	the declared lengths of maps and arrays are ignored.  Ints and uints with
+	the same value are equal (they serialize the same way); ints and floats
+	are not.  Comparison stops at the first difference.
+*/
+func Equal(a, b interface{}, atl atlas.Atlas) (bool, error) {
+	d, err := newDiffer(a, b, atl, true)
+	if err != nil {
+		return false, err
+	}
+	if err := d.run(); err != nil {
+		return false, err
+	}
+	return !d.found, nil
+}
+
+/*
+	Diff compares a and b like Equal does, and returns every difference
+	between them, addressed by JSON Pointer, in the order they're found.
+	A nil result means they're equal.
+*/
+func Diff(a, b interface{}, atl atlas.Atlas) ([]Difference, error) {
+	d, err := newDiffer(a, b, atl, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.run(); err != nil {
+		return nil, err
+	}
+	return d.diffs, nil
+}
+
+// DiffKind says what sort of Difference a Difference is.
+type DiffKind string
+
+const (
+	DiffAdded   = DiffKind("added")   // Only in b.
+	DiffRemoved = DiffKind("removed") // Only in a.
+	DiffChanged = DiffKind("changed") // In both, but different.
+)
+
+/*
+	Difference is one difference found by Diff.
+
+	Path is a JSON Pointer to the value (for map entries and array elements
+	which are added or removed, to the entry or element itself).
+	A and B are the values in a and b, unmarshalled as with an `interface{}`
+	target (maps become `map[interface{}]interface{}`, since keys needn't be
+	strings); A is nil if the value was added, and B is nil if it was removed.
+	(For a change to or from null, the null side is nil too: check Kind.)
+*/
+type Difference struct {
+	Path string
+	Kind DiffKind
+	A, B interface{}
+}
+
+// String describes the difference in one line, rendering values as json.
+func (d Difference) String() string {
+	switch d.Kind {
+	case DiffAdded:
+		return fmt.Sprintf("added %s: %s", d.pathString(), renderDiffValue(d.B))
+	case DiffRemoved:
+		return fmt.Sprintf("removed %s: %s", d.pathString(), renderDiffValue(d.A))
+	default:
+		return fmt.Sprintf("changed %s: %s -> %s", d.pathString(), renderDiffValue(d.A), renderDiffValue(d.B))
+	}
+}
+
+func (d Difference) pathString() string {
+	if d.Path == "" {
+		return "(root)"
+	}
+	return d.Path
+}
+
+func renderDiffValue(v interface{}) string {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(bs)
+}
+
+type differ struct {
+	a, b      *obj.Marshaller
+	firstOnly bool // stop at the first difference (for Equal).
+	found     bool // whether there's any difference.
+	diffs     []Difference
+
+	rec    shared.TokenRecorder // for capturing values for Differences.
+	unm    *obj.Unmarshaller
+	keyBuf bytes.Buffer
+	keyEnc *cbor.Encoder
+}
+
+// Returned internally to unwind as soon as there's a difference, for Equal.
+var errDiffFound = fmt.Errorf("difference found")
+
+func newDiffer(a, b interface{}, atl atlas.Atlas, firstOnly bool) (*differ, error) {
+	opts := obj.MarshalOptions{CanonicalKeyOrder: true}
+	d := &differ{
+		a:         obj.NewMarshallerWithOptions(atl, opts),
+		b:         obj.NewMarshallerWithOptions(atl, opts),
+		firstOnly: firstOnly,
+		unm: obj.NewUnmarshallerWithOptions(atlas.MustBuild(), obj.UnmarshalOptions{
+			// Tags don't matter for showing values; drop them.
+			TagHook: func(_ int, v interface{}) (interface{}, error) { return v, nil },
+			// Whatever we compared had better be capturable, keys and all.
+			AnyKeyMaps: true,
+		}),
+	}
+	d.keyEnc = cbor.NewEncoder(&d.keyBuf)
+	if err := d.a.Bind(a); err != nil {
+		return nil, err
+	}
+	if err := d.b.Bind(b); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *differ) run() error {
+	var ta, tb Token
+	if _, err := d.a.Step(&ta); err != nil {
+		return err
+	}
+	if _, err := d.b.Step(&tb); err != nil {
+		return err
+	}
+	err := d.diffValue("", &ta, &tb)
+	if err == errDiffFound {
+		return nil
+	}
+	return err
+}
+
+// Compare the values starting with ta and tb, consuming the rest of both.
+func (d *differ) diffValue(path string, ta, tb *Token) error {
+	if ta.Type != tb.Type || ta.Tagged != tb.Tagged || (ta.Tagged && ta.Tag != tb.Tag) {
+		if !(isIntToken(ta) && isIntToken(tb) && !ta.Tagged && !tb.Tagged) {
+			return d.changed(path, ta, tb)
+		}
+	}
+	switch ta.Type {
+	case TMapOpen:
+		return d.diffMap(path, ta, tb)
+	case TArrOpen:
+		return d.diffArray(path, ta, tb)
+	}
+	if !scalarTokensEqual(ta, tb) {
+		return d.changed(path, ta, tb)
+	}
+	return nil
+}
+
+func (d *differ) diffMap(path string, ka, kb *Token) error {
+	// With canonical key order on both sides, this is a merge join.
+	var va, vb Token
+	readA, readB := true, true
+	for {
+		if readA {
+			if _, err := d.a.Step(ka); err != nil {
+				return err
+			}
+		}
+		if readB {
+			if _, err := d.b.Step(kb); err != nil {
+				return err
+			}
+		}
+		aDone, bDone := ka.Type == TMapClose, kb.Type == TMapClose
+		if aDone && bDone {
+			return nil
+		}
+		var cmp int
+		switch {
+		case aDone:
+			cmp = 1
+		case bDone:
+			cmp = -1
+		default:
+			cmp = d.compareKeys(ka, kb)
+		}
+		switch {
+		case cmp == 0:
+			p := shared.AppendPointer(path, keyString(ka))
+			if _, err := d.a.Step(&va); err != nil {
+				return err
+			}
+			if _, err := d.b.Step(&vb); err != nil {
+				return err
+			}
+			if err := d.diffValue(p, &va, &vb); err != nil {
+				return err
+			}
+			readA, readB = true, true
+		case cmp < 0: // ka is only in a.
+			p := shared.AppendPointer(path, keyString(ka))
+			if _, err := d.a.Step(&va); err != nil {
+				return err
+			}
+			if err := d.removed(p, &va); err != nil {
+				return err
+			}
+			readA, readB = true, false
+		default: // kb is only in b.
+			p := shared.AppendPointer(path, keyString(kb))
+			if _, err := d.b.Step(&vb); err != nil {
+				return err
+			}
+			if err := d.added(p, &vb); err != nil {
+				return err
+			}
+			readA, readB = false, true
+		}
+	}
+}
+
+func (d *differ) diffArray(path string, ta, tb *Token) error {
+	aDone, bDone := false, false
+	for i := 0; ; i++ {
+		if !aDone {
+			if _, err := d.a.Step(ta); err != nil {
+				return err
+			}
+			aDone = ta.Type == TArrClose
+		}
+		if !bDone {
+			if _, err := d.b.Step(tb); err != nil {
+				return err
+			}
+			bDone = tb.Type == TArrClose
+		}
+		p := shared.AppendPointer(path, strconv.Itoa(i))
+		var err error
+		switch {
+		case aDone && bDone:
+			return nil
+		case aDone:
+			err = d.added(p, tb)
+		case bDone:
+			err = d.removed(p, ta)
+		default:
+			err = d.diffValue(p, ta, tb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (d *differ) changed(path string, ta, tb *Token) error {
+	d.found = true
+	if d.firstOnly {
+		return errDiffFound
+	}
+	a, err := d.capture(d.a, ta)
+	if err != nil {
+		return err
+	}
+	b, err := d.capture(d.b, tb)
+	if err != nil {
+		return err
+	}
+	d.diffs = append(d.diffs, Difference{path, DiffChanged, a, b})
+	return nil
+}
+
+func (d *differ) added(path string, tb *Token) error {
+	d.found = true
+	if d.firstOnly {
+		return errDiffFound
+	}
+	b, err := d.capture(d.b, tb)
+	if err != nil {
+		return err
+	}
+	d.diffs = append(d.diffs, Difference{path, DiffAdded, nil, b})
+	return nil
+}
+
+func (d *differ) removed(path string, ta *Token) error {
+	d.found = true
+	if d.firstOnly {
+		return errDiffFound
+	}
+	a, err := d.capture(d.a, ta)
+	if err != nil {
+		return err
+	}
+	d.diffs = append(d.diffs, Difference{path, DiffRemoved, a, nil})
+	return nil
+}
+
+// Consume the rest of the value starting with tok from src,
+// and unmarshal it into a generic tree.
+func (d *differ) capture(src shared.TokenSource, tok *Token) (interface{}, error) {
+	d.rec.Reset()
+	for {
+		done, err := d.rec.Step(tok)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+		if _, err := src.Step(tok); err != nil {
+			return nil, err
+		}
+	}
+	var v interface{}
+	if err := d.unm.Bind(&v); err != nil {
+		return nil, err
+	}
+	replay, err := d.rec.Source()
+	if err != nil {
+		return nil, err
+	}
+	if err := (shared.TokenPump{replay, d.unm}).Run(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Compare map keys in the canonical order (the order CanonicalKeyOrder
+// emits them in): shorter cbor encodings first, then bytewise.
+func (d *differ) compareKeys(ka, kb *Token) int {
+	ea := d.encodeKey(ka)
+	eb := d.encodeKey(kb)
+	if len(ea) != len(eb) {
+		if len(ea) < len(eb) {
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(ea, eb)
+}
+
+func (d *differ) encodeKey(k *Token) []byte {
+	d.keyBuf.Reset()
+	d.keyEnc.Reset()
+	d.keyEnc.Step(k)
+	return append([]byte(nil), d.keyBuf.Bytes()...)
+}
+
+func isIntToken(tok *Token) bool {
+	return tok.Type == TInt || tok.Type == TUint
+}
+
+func scalarTokensEqual(ta, tb *Token) bool {
+	switch {
+	case ta.Type == TInt && tb.Type == TUint:
+		return ta.Int >= 0 && uint64(ta.Int) == tb.Uint
+	case ta.Type == TUint && tb.Type == TInt:
+		return tb.Int >= 0 && uint64(tb.Int) == ta.Uint
+	}
+	return IsTokenEqual(*ta, *tb)
+}
+
+func keyString(k *Token) string {
+	switch k.Type {
+	case TInt:
+		return strconv.FormatInt(k.Int, 10)
+	case TUint:
+		return strconv.FormatUint(k.Uint, 10)
+	case TBool:
+		return strconv.FormatBool(k.Bool)
+	default:
+		return k.Str
+	}
+}
@@ -0,0 +1,93 @@
+package refmt_test
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+func TestEqualAndDiff(t *testing.T) {
+	type tInner struct {
+		Tags []string
+	}
+	type tOuter struct {
+		Name  string
+		Count uint
+		Inner tInner
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(tOuter{}).StructMap().Autogenerate().Complete(),
+		atlas.BuildEntry(tInner{}).StructMap().Autogenerate().Complete(),
+	)
+	value := tOuter{"x", 2, tInner{[]string{"a", "b"}}}
+
+	t.Run("equal across types", func(t *testing.T) {
+		eq, err := refmt.Equal(value, map[string]interface{}{
+			"inner": map[string]interface{}{"tags": []interface{}{"a", "b"}},
+			"count": 2,
+			"name":  "x",
+		}, atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, eq, ShouldEqual, true)
+	})
+	t.Run("not equal", func(t *testing.T) {
+		eq, err := refmt.Equal(value, tOuter{"x", 3, tInner{[]string{"a", "b"}}}, atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, eq, ShouldEqual, false)
+		eq, err = refmt.Equal(1, 1.0, atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, eq, ShouldEqual, false)
+	})
+	t.Run("diff of equal values is nil", func(t *testing.T) {
+		diffs, err := refmt.Diff(value, value, atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, diffs, ShouldEqual, []refmt.Difference(nil))
+	})
+	t.Run("diff", func(t *testing.T) {
+		diffs, err := refmt.Diff(value, map[string]interface{}{
+			"inner": map[string]interface{}{"tags": []interface{}{"a", "c", "d"}},
+			"name":  map[string]interface{}{"first": "x"},
+			"new/key": true,
+		}, atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, diffs, ShouldEqual, []refmt.Difference{
+			{"/name", refmt.DiffChanged, "x", map[interface{}]interface{}{"first": "x"}},
+			{"/count", refmt.DiffRemoved, 2, nil},
+			{"/inner/tags/1", refmt.DiffChanged, "b", "c"},
+			{"/inner/tags/2", refmt.DiffAdded, nil, "d"},
+			{"/new~1key", refmt.DiffAdded, nil, true},
+		})
+		var strs []string
+		for _, d := range diffs {
+			strs = append(strs, d.String())
+		}
+		Wish(t, strs, ShouldEqual, []string{
+			`changed /name: "x" -> {"first":"x"}`,
+			`removed /count: 2`,
+			`changed /inner/tags/1: "b" -> "c"`,
+			`added /inner/tags/2: "d"`,
+			`added /new~1key: true`,
+		})
+	})
+	t.Run("diff of maps with non-string keys", func(t *testing.T) {
+		diffs, err := refmt.Diff(
+			map[string]interface{}{"a": map[int]int{1: 1}, "b": map[int]int{2: 2}},
+			map[string]interface{}{"a": "x", "b": map[int]int{2: 3}},
+			atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, diffs, ShouldEqual, []refmt.Difference{
+			{"/a", refmt.DiffChanged, map[interface{}]interface{}{1: 1}, "x"},
+			{"/b/2", refmt.DiffChanged, 2, 3},
+		})
+		Wish(t, diffs[0].String(), ShouldEqual, `changed /a: {"1":1} -> "x"`)
+	})
+	t.Run("diff at the root", func(t *testing.T) {
+		diffs, err := refmt.Diff([]int{1}, "x", atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, diffs, ShouldEqual, []refmt.Difference{{"", refmt.DiffChanged, []interface{}{1}, "x"}})
+		Wish(t, diffs[0].String(), ShouldEqual, `changed (root): [1] -> "x"`)
+	})
+}
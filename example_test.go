@@ -7,6 +7,7 @@ import (
 
 	"github.com/polydawn/refmt"
 	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/obj"
 	"github.com/polydawn/refmt/obj/atlas"
 )
 
@@ -140,3 +141,24 @@ func ExampleNewMarshallerAtlased_transformFuncs() {
 	// "serializes:as:string!"
 	// <nil>
 }
+
+func Example_unmarshalEach() {
+	type Record struct {
+		Name string
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(Record{}).StructMap().Autogenerate().Complete(),
+	)
+
+	dec := json.NewDecoder(strings.NewReader(`{"items":[{"name":"a"},{"name":"b"}]}`))
+	err := obj.UnmarshalEach(dec, atl, "/items", func(rec *Record) error {
+		fmt.Println(rec.Name)
+		return nil
+	})
+	fmt.Printf("%v\n", err)
+
+	// Output:
+	// a
+	// b
+	// <nil>
+}
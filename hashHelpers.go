@@ -0,0 +1,49 @@
+package refmt
+
+import (
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/obj"
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
+)
+
+/*
+	Hash returns the SHA-256 digest of the canonical cbor encoding of v.
+
+	Map keys and struct fields are put in canonical order regardless of
+	the atlas (see obj.MarshalOptions.CanonicalKeyOrder), so values which
+	are equal hash equally, however their atlases sort them.
+	The encoding is streamed into the hash; it's never held in memory.
+*/
+func Hash(v interface{}, atl atlas.Atlas) ([]byte, error) {
+	sink, err := hashWith(v, atl)
+	if err != nil {
+		return nil, err
+	}
+	return sink.Sum(nil), nil
+}
+
+/*
+	HashCID is like Hash, but returns a CIDv1 (in binary form) with the
+	dag-cbor codec and a sha2-256 multihash.  Use cbor.CIDString for its
+	string form, or cbor.CIDToken to link to it from another value.
+*/
+func HashCID(v interface{}, atl atlas.Atlas) ([]byte, error) {
+	sink, err := hashWith(v, atl)
+	if err != nil {
+		return nil, err
+	}
+	return sink.CID(cbor.MultihashSHA2_256), nil
+}
+
+func hashWith(v interface{}, atl atlas.Atlas) (*cbor.HashSink, error) {
+	marshaller := obj.NewMarshallerWithOptions(atl, obj.MarshalOptions{CanonicalKeyOrder: true})
+	if err := marshaller.Bind(v); err != nil {
+		return nil, err
+	}
+	sink := cbor.NewHashSink(nil)
+	if err := (shared.TokenPump{marshaller, sink}).Run(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
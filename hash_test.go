@@ -0,0 +1,40 @@
+package refmt_test
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+func TestHash(t *testing.T) {
+	type tRecord struct {
+		Name string
+		Id   int
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(tRecord{}).StructMap().Autogenerate().Complete(),
+	)
+	digest, err := refmt.Hash(tRecord{"x", 1}, atl)
+	Wish(t, err, ShouldEqual, nil)
+
+	// The canonical encoding is {"id": 1, "name": "x"}.
+	expect := sha256.Sum256([]byte("\xa2\x62id\x01\x64name\x61x"))
+	Wish(t, digest, ShouldEqual, expect[:])
+
+	t.Run("a map with the same entries hashes the same", func(t *testing.T) {
+		digest2, err := refmt.Hash(map[string]interface{}{"name": "x", "id": 1}, atlas.MustBuild())
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, digest2, ShouldEqual, digest)
+	})
+	t.Run("cid", func(t *testing.T) {
+		cid, err := refmt.HashCID(tRecord{"x", 1}, atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, cid, ShouldEqual, append([]byte{0x01, 0x71, 0x12, 0x20}, expect[:]...))
+		Wish(t, cbor.CIDString(cid)[:4], ShouldEqual, "bafy")
+	})
+}
@@ -0,0 +1,14 @@
+/*
+	The `infer` package works out the shape of documents from samples
+	of them: what keys maps have, which are always present and which are
+	optional, what types of values appear at each path, and what arrays
+	contain.  It's meant for getting started with legacy payloads which
+	have no schema written down.
+
+	Samples can come from any token source (json, cbor, or anything else
+	refmt can tokenize); add each document to a Schema, then emit what
+	was learned either as JSON Schema, or as Go source: struct types with
+	`refmt` tags, and an atlas for them (which is, of course, only a first
+	draft -- samples can't tell you about fields they don't have).
+*/
+package infer
@@ -0,0 +1,241 @@
+package infer
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	GoSource returns the source of a Go file (in package pkg) declaring
+	types for the documents seen so far, and an atlas for them.
+
+	The documents must be maps, or arrays of maps; the type for those maps
+	is a struct named typeName, and maps within them get struct types named
+	after the keys they're at.  Each struct field has a `refmt` tag (so
+	atlas.AutogenerateStructMapEntry would work too), and a variable named
+	typeName+"Atlas" holds an atlas built from explicit StructMaps
+	(so the field names can be changed freely).
+
+	Fields which weren't in every map are "omitempty", and are pointers if
+	they're structs (so they can be empty).  Scalars which were sometimes
+	null are pointers.  Places which have had values of several types
+	(other than ints and floats together, which make a float64) are
+	interface{}, as are places which have only ever been null; maps which
+	have only ever been empty are map[string]interface{}.
+*/
+func (s *Schema) GoSource(pkg, typeName string) ([]byte, error) {
+	root := s.Root
+	switch {
+	case root == nil:
+		return nil, fmt.Errorf("no documents have been added")
+	case root.only(TArrOpen) && root.Elem.only(TMapOpen):
+		root = root.Elem
+	case !root.only(TMapOpen):
+		return nil, fmt.Errorf("documents must be maps (or arrays of maps) to have struct types")
+	}
+	g := goGen{names: map[string]bool{typeName: true}}
+	g.addStruct(root, typeName)
+
+	var buf bytes.Buffer
+	plural := "s"
+	if s.Documents == 1 {
+		plural = ""
+	}
+	fmt.Fprintf(&buf, "// Types inferred by refmt from %d sample document%s.\n\n", s.Documents, plural)
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import \"github.com/polydawn/refmt/obj/atlas\"\n\n")
+	for _, st := range g.structs {
+		fmt.Fprintf(&buf, "type %s struct {\n", st.name)
+		for _, f := range st.fields {
+			fmt.Fprintf(&buf, "\t%s %s %s\n", f.goName, f.goType, f.tag())
+		}
+		fmt.Fprintf(&buf, "}\n\n")
+	}
+	fmt.Fprintf(&buf, "// %sAtlas maps %s (and the types within it) to and from tokens.\n", typeName, typeName)
+	fmt.Fprintf(&buf, "var %sAtlas = atlas.MustBuild(\n", typeName)
+	for _, st := range g.structs {
+		fmt.Fprintf(&buf, "\tatlas.BuildEntry(%s{}).StructMap().\n", st.name)
+		for _, f := range st.fields {
+			fmt.Fprintf(&buf, "\t\tAddField(%q, %s).\n", f.goName, f.entry())
+		}
+		fmt.Fprintf(&buf, "\t\tComplete(),\n")
+	}
+	fmt.Fprintf(&buf, ")\n")
+	return format.Source(buf.Bytes())
+}
+
+type goGen struct {
+	names   map[string]bool // type names taken.
+	structs []*goStruct     // in the order they were named.
+}
+
+type goStruct struct {
+	name   string
+	fields []goField
+}
+
+type goField struct {
+	*Field
+	goName    string
+	goType    string
+	omitEmpty bool
+}
+
+// The struct tag for the field.
+func (f goField) tag() string {
+	opts := f.Name
+	if f.IntKey {
+		opts += ",keyasint"
+	}
+	if f.omitEmpty {
+		opts += ",omitempty"
+	}
+	tag := "refmt:" + strconv.Quote(opts)
+	if strings.ContainsRune(tag, '`') {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
+
+// The atlas.StructMapEntry for the field, as source.
+func (f goField) entry() string {
+	var parts []string
+	if f.IntKey {
+		parts = append(parts, "KeyAsInt: true", "SerialInt: "+f.Name)
+	} else {
+		parts = append(parts, "SerialName: "+strconv.Quote(f.Name))
+	}
+	if f.omitEmpty {
+		parts = append(parts, "OmitEmpty: true")
+	}
+	return "atlas.StructMapEntry{" + strings.Join(parts, ", ") + "}"
+}
+
+// Declare a struct type for the maps seen at s (with a name already taken).
+func (g *goGen) addStruct(s *Shape, name string) {
+	st := &goStruct{name: name}
+	g.structs = append(g.structs, st)
+	taken := map[string]bool{}
+	for _, f := range s.Fields {
+		gf := goField{Field: f, goName: goFieldName(f)}
+		for i := 2; taken[gf.goName]; i++ {
+			gf.goName = goFieldName(f) + strconv.Itoa(i)
+		}
+		taken[gf.goName] = true
+		gf.omitEmpty = !s.Required(f)
+		gf.goType = g.typeFor(f.Value, gf.goName, name)
+		if gf.omitEmpty && g.isStruct(gf.goType) {
+			gf.goType = "*" + gf.goType
+		}
+		st.fields = append(st.fields, gf)
+	}
+}
+
+// The Go type for the values seen at s; if it's a struct,
+// its name is based on hint (and the name of the struct s is in).
+func (g *goGen) typeFor(s *Shape, hint, parent string) string {
+	var typ string
+	switch {
+	case s.only(TMapOpen):
+		if len(s.Fields) == 0 {
+			return "map[string]interface{}"
+		}
+		typ = g.name(hint, parent)
+		g.addStruct(s, typ)
+	case s.only(TArrOpen):
+		if s.Elem.Seen == 0 {
+			return "[]interface{}"
+		}
+		return "[]" + g.typeFor(s.Elem, hint, parent)
+	case s.only(TString):
+		typ = "string"
+	case s.only(TBytes):
+		return "[]byte"
+	case s.only(TBool):
+		typ = "bool"
+	case s.only(TInt, TUint):
+		switch {
+		case !s.bigUint:
+			typ = "int64"
+		case s.Types[TInt] == 0:
+			typ = "uint64"
+		default:
+			return "interface{}" // no integer type fits both.
+		}
+	case s.only(TInt, TUint, TFloat64):
+		typ = "float64"
+	default:
+		return "interface{}"
+	}
+	if s.Types[TNull] > 0 {
+		return "*" + typ
+	}
+	return typ
+}
+
+// Whether the type (as source) is one of the structs declared.
+func (g *goGen) isStruct(typ string) bool {
+	for _, st := range g.structs {
+		if st.name == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Pick an unused type name: hint if possible, or else parent+hint,
+// or else that with a number on the end.
+func (g *goGen) name(hint, parent string) string {
+	name := hint
+	if g.names[name] {
+		name = parent + hint
+	}
+	for i := 2; g.names[name]; i++ {
+		name = parent + hint + strconv.Itoa(i)
+	}
+	g.names[name] = true
+	return name
+}
+
+// Initialisms which Go style writes in all caps.
+var goInitialisms = map[string]bool{
+	"api": true, "cpu": true, "css": true, "dns": true, "html": true, "http": true,
+	"https": true, "id": true, "ip": true, "json": true, "sql": true, "ssh": true,
+	"tls": true, "ttl": true, "ui": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// An exported Go name for the field, e.g. "OwnerID" for "owner_id".
+func goFieldName(f *Field) string {
+	if f.IntKey {
+		if strings.HasPrefix(f.Name, "-") {
+			return "KeyNeg" + f.Name[1:]
+		}
+		return "Key" + f.Name
+	}
+	var sb strings.Builder
+	for _, word := range strings.FieldsFunc(f.Name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if goInitialisms[strings.ToLower(word)] {
+			sb.WriteString(strings.ToUpper(word))
+			continue
+		}
+		rs := []rune(word)
+		rs[0] = unicode.ToUpper(rs[0])
+		sb.WriteString(string(rs))
+	}
+	name := sb.String()
+	switch {
+	case name == "":
+		return "Field"
+	case !unicode.IsLetter([]rune(name)[0]):
+		return "F" + name
+	}
+	return name
+}
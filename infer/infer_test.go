@@ -0,0 +1,232 @@
+package infer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func inferJson(t *testing.T, docs ...string) *Schema {
+	t.Helper()
+	var s Schema
+	for _, doc := range docs {
+		Wish(t, s.Add(json.NewDecoder(strings.NewReader(doc))), ShouldEqual, nil)
+	}
+	return &s
+}
+
+var samples = []string{
+	`{"id":1,"user_name":"a","tags":["x"],"owner":{"id":2,"url":"u"},"meta":{}}`,
+	`{"id":2,"user_name":null,"score":1.5,"tags":[],"owner":{"id":3},"meta":{}}`,
+	`{"id":3,"user_name":"c","score":2,"tags":["y","z"],"owner":{"id":4},"meta":{},"extra":[{"k":true}]}`,
+}
+
+func TestShapes(t *testing.T) {
+	s := inferJson(t, samples...)
+	Wish(t, s.Documents, ShouldEqual, 3)
+	root := s.Root
+	Wish(t, root.Types, ShouldEqual, map[TokenType]int{TMapOpen: 3})
+	var names []string
+	for _, f := range root.Fields {
+		names = append(names, f.Name)
+	}
+	Wish(t, names, ShouldEqual, []string{"id", "user_name", "tags", "owner", "meta", "score", "extra"})
+	Wish(t, root.Required(root.Fields[1]), ShouldEqual, true)
+	Wish(t, root.Fields[1].Value.Types, ShouldEqual, map[TokenType]int{TString: 2, TNull: 1})
+	Wish(t, root.Required(root.Fields[5]), ShouldEqual, false)
+	Wish(t, root.Fields[5].Value.Types, ShouldEqual, map[TokenType]int{TFloat64: 1, TInt: 1})
+	Wish(t, root.Fields[2].Value.Elem.Seen, ShouldEqual, 3)
+}
+
+func TestAddAll(t *testing.T) {
+	var s Schema
+	err := s.AddAll(json.NewDecoder(strings.NewReader("{\"a\":1}\n{\"a\":2,\"b\":[]} {}\n")))
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, s.Documents, ShouldEqual, 3)
+	Wish(t, len(s.Root.Fields), ShouldEqual, 2)
+
+	var buf bytes.Buffer
+	for _, doc := range []string{`[1]`, `{"x":"y"}`} {
+		Wish(t, shared.TokenPump{json.NewDecoder(strings.NewReader(doc)), cbor.NewEncoder(&buf)}.Run(), ShouldEqual, nil)
+	}
+	s = Schema{}
+	err = s.AddAll(cbor.NewDecoder(cbor.DecodeOptions{}, &buf))
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, s.Documents, ShouldEqual, 2)
+	Wish(t, s.Root.Types, ShouldEqual, map[TokenType]int{TArrOpen: 1, TMapOpen: 1})
+
+	s = Schema{}
+	err = s.AddAll(json.NewDecoder(strings.NewReader(`{"a":1} {"a":`)))
+	Wish(t, err, ShouldEqual, io.EOF)
+	Wish(t, s.Documents, ShouldEqual, 1)
+}
+
+func TestJSONSchema(t *testing.T) {
+	s := inferJson(t, samples...)
+	Wish(t, s.JSONSchema(), ShouldEqual, map[string]interface{}{
+		"$schema": JSONSchemaDialect,
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"id":        map[string]interface{}{"type": "integer"},
+			"user_name": map[string]interface{}{"type": []string{"string", "null"}},
+			"score":     map[string]interface{}{"type": "number"},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+			"owner": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":  map[string]interface{}{"type": "integer"},
+					"url": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"id"},
+			},
+			"meta": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+			"extra": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"k": map[string]interface{}{"type": "boolean"},
+					},
+					"required": []string{"k"},
+				},
+			},
+		},
+		"required": []string{"id", "user_name", "tags", "owner", "meta"},
+	})
+	t.Run("no documents", func(t *testing.T) {
+		var s Schema
+		Wish(t, s.JSONSchema(), ShouldEqual, map[string]interface{}{"$schema": JSONSchemaDialect})
+	})
+	t.Run("bytes and mixed types", func(t *testing.T) {
+		var s Schema
+		Wish(t, s.Add(shared.NewTokenSlice([]Token{{Type: TBytes, Bytes: []byte{1}}})), ShouldEqual, nil)
+		Wish(t, s.JSONSchema(), ShouldEqual, map[string]interface{}{
+			"$schema": JSONSchemaDialect, "type": "string", "contentEncoding": "base64",
+		})
+		Wish(t, s.Add(shared.NewTokenSlice([]Token{{Type: TArrOpen, Length: 0}, {Type: TArrClose}})), ShouldEqual, nil)
+		Wish(t, s.JSONSchema(), ShouldEqual, map[string]interface{}{
+			"$schema": JSONSchemaDialect, "type": []string{"array", "string"}, "contentEncoding": "base64",
+		})
+	})
+}
+
+func TestGoSource(t *testing.T) {
+	s := inferJson(t, samples...)
+	src, err := s.GoSource("things", "Thing")
+	Wish(t, err, ShouldEqual, nil)
+	// (Struct tags are written with ' here, since this is a raw string.)
+	Wish(t, string(src), ShouldEqual, strings.ReplaceAll(`// Types inferred by refmt from 3 sample documents.
+
+package things
+
+import "github.com/polydawn/refmt/obj/atlas"
+
+type Thing struct {
+	ID       int64                  'refmt:"id"'
+	UserName *string                'refmt:"user_name"'
+	Tags     []string               'refmt:"tags"'
+	Owner    Owner                  'refmt:"owner"'
+	Meta     map[string]interface{} 'refmt:"meta"'
+	Score    float64                'refmt:"score,omitempty"'
+	Extra    []Extra                'refmt:"extra,omitempty"'
+}
+
+type Owner struct {
+	ID  int64  'refmt:"id"'
+	URL string 'refmt:"url,omitempty"'
+}
+
+type Extra struct {
+	K bool 'refmt:"k"'
+}
+
+// ThingAtlas maps Thing (and the types within it) to and from tokens.
+var ThingAtlas = atlas.MustBuild(
+	atlas.BuildEntry(Thing{}).StructMap().
+		AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
+		AddField("UserName", atlas.StructMapEntry{SerialName: "user_name"}).
+		AddField("Tags", atlas.StructMapEntry{SerialName: "tags"}).
+		AddField("Owner", atlas.StructMapEntry{SerialName: "owner"}).
+		AddField("Meta", atlas.StructMapEntry{SerialName: "meta"}).
+		AddField("Score", atlas.StructMapEntry{SerialName: "score", OmitEmpty: true}).
+		AddField("Extra", atlas.StructMapEntry{SerialName: "extra", OmitEmpty: true}).
+		Complete(),
+	atlas.BuildEntry(Owner{}).StructMap().
+		AddField("ID", atlas.StructMapEntry{SerialName: "id"}).
+		AddField("URL", atlas.StructMapEntry{SerialName: "url", OmitEmpty: true}).
+		Complete(),
+	atlas.BuildEntry(Extra{}).StructMap().
+		AddField("K", atlas.StructMapEntry{SerialName: "k"}).
+		Complete(),
+)
+`, "'", "`"))
+
+	t.Run("arrays of maps, int keys, and bytes", func(t *testing.T) {
+		var s Schema
+		Wish(t, s.Add(shared.NewTokenSlice([]Token{
+			{Type: TArrOpen, Length: 1},
+			{Type: TMapOpen, Length: 4},
+			{Type: TUint, Uint: 1}, {Type: TBytes, Bytes: []byte{1}},
+			{Type: TInt, Int: -7}, {Type: TNull},
+			{Type: TString, Str: "2fa"}, {Type: TBool, Bool: true},
+			{Type: TString, Str: "owner"}, {Type: TMapOpen, Length: 1}, {Type: TString, Str: "owner"}, {Type: TNull}, {Type: TMapClose},
+			{Type: TMapClose},
+			{Type: TArrClose},
+		})), ShouldEqual, nil)
+		Wish(t, s.Add(shared.NewTokenSlice([]Token{{Type: TArrOpen, Length: 0}, {Type: TArrClose}})), ShouldEqual, nil)
+		src, err := s.GoSource("p", "Owner")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, string(src), ShouldEqual, strings.ReplaceAll(`// Types inferred by refmt from 2 sample documents.
+
+package p
+
+import "github.com/polydawn/refmt/obj/atlas"
+
+type Owner struct {
+	Key1    []byte      'refmt:"1,keyasint"'
+	KeyNeg7 interface{} 'refmt:"-7,keyasint"'
+	F2fa    bool        'refmt:"2fa"'
+	Owner   OwnerOwner  'refmt:"owner"'
+}
+
+type OwnerOwner struct {
+	Owner interface{} 'refmt:"owner"'
+}
+
+// OwnerAtlas maps Owner (and the types within it) to and from tokens.
+var OwnerAtlas = atlas.MustBuild(
+	atlas.BuildEntry(Owner{}).StructMap().
+		AddField("Key1", atlas.StructMapEntry{KeyAsInt: true, SerialInt: 1}).
+		AddField("KeyNeg7", atlas.StructMapEntry{KeyAsInt: true, SerialInt: -7}).
+		AddField("F2fa", atlas.StructMapEntry{SerialName: "2fa"}).
+		AddField("Owner", atlas.StructMapEntry{SerialName: "owner"}).
+		Complete(),
+	atlas.BuildEntry(OwnerOwner{}).StructMap().
+		AddField("Owner", atlas.StructMapEntry{SerialName: "owner"}).
+		Complete(),
+)
+`, "'", "`"))
+	})
+	t.Run("not maps", func(t *testing.T) {
+		var s Schema
+		_, err := s.GoSource("p", "T")
+		Wish(t, err.Error(), ShouldEqual, "no documents have been added")
+		s = *inferJson(t, `{"a":1}`, `[1]`)
+		_, err = s.GoSource("p", "T")
+		Wish(t, err.Error(), ShouldEqual, "documents must be maps (or arrays of maps) to have struct types")
+	})
+}
@@ -0,0 +1,80 @@
+package infer
+
+import (
+	. "github.com/polydawn/refmt/tok"
+)
+
+// The JSON Schema dialect JSONSchema emits.
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+/*
+	JSONSchema returns a JSON Schema document describing the documents
+	seen so far, as a tree of maps and slices, ready to be marshalled
+	(with any encoder, and no atlas needed).
+
+	Keys which were in every map seen at a place are "required";
+	places which have had values of several types list them all.
+	Byte strings (which only cbor has) are described as base64 strings,
+	since that's how they'd look converted to json.  Integers are
+	"integer"; integers and floats seen in the same place are "number".
+*/
+func (s *Schema) JSONSchema() map[string]interface{} {
+	doc := map[string]interface{}{}
+	if s.Root != nil {
+		doc = s.Root.jsonSchema()
+	}
+	doc["$schema"] = JSONSchemaDialect
+	return doc
+}
+
+func (s *Shape) jsonSchema() map[string]interface{} {
+	js := map[string]interface{}{}
+	var types []string
+	if s.Types[TMapOpen] > 0 {
+		types = append(types, "object")
+		props := map[string]interface{}{}
+		var required []string
+		for _, f := range s.Fields {
+			props[f.Name] = f.Value.jsonSchema()
+			if s.Required(f) {
+				required = append(required, f.Name)
+			}
+		}
+		js["properties"] = props
+		if len(required) > 0 {
+			js["required"] = required
+		}
+	}
+	if s.Types[TArrOpen] > 0 {
+		types = append(types, "array")
+		if s.Elem.Seen > 0 {
+			js["items"] = s.Elem.jsonSchema()
+		}
+	}
+	if s.Types[TString] > 0 || s.Types[TBytes] > 0 {
+		types = append(types, "string")
+		if s.Types[TString] == 0 {
+			js["contentEncoding"] = "base64"
+		}
+	}
+	switch {
+	case s.Types[TFloat64] > 0:
+		types = append(types, "number")
+	case s.Types[TInt] > 0 || s.Types[TUint] > 0:
+		types = append(types, "integer")
+	}
+	if s.Types[TBool] > 0 {
+		types = append(types, "boolean")
+	}
+	if s.Types[TNull] > 0 {
+		types = append(types, "null")
+	}
+	switch len(types) {
+	case 0: // nothing seen here: anything goes.
+	case 1:
+		js["type"] = types[0]
+	default:
+		js["type"] = types
+	}
+	return js
+}
@@ -0,0 +1,210 @@
+package infer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Schema accumulates what's been seen in sample documents.
+	Add documents to it, then use JSONSchema or GoSource.
+*/
+type Schema struct {
+	Documents int    // How many documents have been added.
+	Root      *Shape // The top-level values of the documents (nil until a document is added).
+}
+
+/*
+	Shape is what's been seen of the values at one place in the documents
+	(e.g. at the key "id" in the maps which are the elements of the array
+	at the key "users").  A place may have values of more than one type.
+*/
+type Shape struct {
+	// How many values have been seen here.
+	Seen int
+
+	// How many values of each type have been seen here.  Maps and arrays
+	// are counted by their open tokens (TMapOpen and TArrOpen).
+	Types map[TokenType]int
+
+	// The keys seen in maps here, in the order they first appeared.
+	Fields []*Field
+
+	// The elements of all the arrays seen here, together.
+	// Nil if no arrays have been seen; if only empty arrays have been seen,
+	// it's a Shape which has seen nothing.
+	Elem *Shape
+
+	fieldIndex map[fieldKey]int // indexes of Fields.
+	bigUint    bool             // whether any uint seen here doesn't fit in an int64.
+}
+
+/*
+	Field is a key which has been seen in maps, and what's been seen of
+	the values for it.  The key is optional if its Value has Seen fewer
+	values than the maps it's in (see Shape.Required).
+*/
+type Field struct {
+	Name   string // The key (in decimal, if it's an int).
+	IntKey bool   // Whether the key was an int (as e.g. in cbor COSE structures) rather than a string.
+	Value  *Shape
+}
+
+/*
+	Add a document from the token source to the schema.
+	The source is read through exactly one complete value.
+
+	If an error is returned (e.g. the source couldn't be read), the schema
+	may have been partly updated with the document.
+*/
+func (s *Schema) Add(src shared.TokenSource) error {
+	r := shared.NewTokenReader(src)
+	var tok Token
+	if err := r.Next(&tok); err != nil {
+		return err
+	}
+	return s.add(r, &tok)
+}
+
+/*
+	AddAll adds each of a stream of documents from the token source to the
+	schema, until the source runs out.  The source is Reset between documents,
+	so it can be a json or cbor Decoder reading concatenated (or
+	newline-delimited) documents.
+
+	Running out means io.EOF instead of the first token of a document;
+	running out in the middle of a document is an error, like any other.
+*/
+func (s *Schema) AddAll(src interface {
+	shared.TokenSource
+	Reset()
+}) error {
+	for {
+		r := shared.NewTokenReader(src)
+		var tok Token
+		if err := r.Next(&tok); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := s.add(r, &tok); err != nil {
+			return err
+		}
+		src.Reset()
+	}
+}
+
+// Given tok holding the first token of a document, take the rest of it
+// from r, and add it to the schema.
+func (s *Schema) add(r *shared.TokenReader, tok *Token) error {
+	if s.Root == nil {
+		s.Root = &Shape{}
+	}
+	if err := s.Root.add(r, tok); err != nil {
+		return err
+	}
+	s.Documents++
+	return nil
+}
+
+// Whether every one of the maps seen here had the field.
+func (s *Shape) Required(f *Field) bool {
+	return f.Value.Seen == s.Types[TMapOpen]
+}
+
+// Whether values of only the given types (and maybe nulls) have been seen here.
+func (s *Shape) only(types ...TokenType) bool {
+	n := s.Types[TNull]
+	for _, t := range types {
+		n += s.Types[t]
+	}
+	return n == s.Seen && n > s.Types[TNull]
+}
+
+// Given tok holding the start of a value, take the rest of it from r,
+// and add it to what's been seen.
+func (s *Shape) add(r *shared.TokenReader, tok *Token) error {
+	if s.Types == nil {
+		s.Types = make(map[TokenType]int)
+	}
+	s.Seen++
+	s.Types[tok.Type]++
+	switch tok.Type {
+	case TMapOpen:
+		for {
+			if err := r.Next(tok); err != nil {
+				return err
+			}
+			if tok.Type == TMapClose {
+				return nil
+			}
+			var key fieldKey
+			switch tok.Type {
+			case TString:
+				key.name = tok.Str
+			case TInt:
+				key.name, key.intKey = strconv.FormatInt(tok.Int, 10), true
+			case TUint:
+				key.name, key.intKey = strconv.FormatUint(tok.Uint, 10), true
+			default:
+				return fmt.Errorf("unsupported map key %s", tok)
+			}
+			f := s.field(key)
+			if err := r.Next(tok); err != nil {
+				return err
+			}
+			if err := f.Value.add(r, tok); err != nil {
+				return err
+			}
+		}
+	case TArrOpen:
+		if s.Elem == nil {
+			s.Elem = &Shape{}
+		}
+		for {
+			if err := r.Next(tok); err != nil {
+				return err
+			}
+			if tok.Type == TArrClose {
+				return nil
+			}
+			if err := s.Elem.add(r, tok); err != nil {
+				return err
+			}
+		}
+	case TUint:
+		if tok.Uint > math.MaxInt64 {
+			s.bigUint = true
+		}
+		return nil
+	case TNull, TString, TBytes, TBool, TInt, TFloat64:
+		return nil
+	default:
+		return fmt.Errorf("unexpected %s; expected start of value", tok.Type)
+	}
+}
+
+type fieldKey struct {
+	name   string
+	intKey bool
+}
+
+// Find the field for the key, adding it if it's new.
+func (s *Shape) field(key fieldKey) *Field {
+	if i, ok := s.fieldIndex[key]; ok {
+		return s.Fields[i]
+	}
+	if s.fieldIndex == nil {
+		s.fieldIndex = make(map[fieldKey]int)
+	}
+	s.fieldIndex[key] = len(s.Fields)
+	f := &Field{Name: key.name, IntKey: key.intKey, Value: &Shape{}}
+	s.Fields = append(s.Fields, f)
+	return f
+}
@@ -66,8 +66,7 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 			return true, fmt.Errorf("unexpected arrClose; expected start of value")
 		default:
 			// It's a value; handle it.
-			d.flushValue(tok)
-			return true, nil
+			return true, d.flushValue(tok)
 		}
 	case phase_mapExpectKeyOrEnd:
 		switch tok.Type {
@@ -88,19 +87,29 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 			return true, fmt.Errorf("unexpected arrClose; expected start of key or end of map")
 		default:
 			// It's a key.  It'd better be a string.
+			//  Ints, uints, and bools are stringified, since json has no other kind of key.
 			switch tok.Type {
 			case TString:
 				d.entrySep()
 				d.emitString(tok.Str)
-				d.wr.Write(wordColon)
-				if d.cfg.Line != nil {
-					d.wr.Write(wordSpace)
-				}
-				d.current = phase_mapExpectValue
-				return false, nil
+			case TInt:
+				d.entrySep()
+				d.emitString(strconv.FormatInt(tok.Int, 10))
+			case TUint:
+				d.entrySep()
+				d.emitString(strconv.FormatUint(tok.Uint, 10))
+			case TBool:
+				d.entrySep()
+				d.emitString(strconv.FormatBool(tok.Bool))
 			default:
-				return true, fmt.Errorf("unexpected token of type %T; expected map key", *tok)
+				return true, fmt.Errorf("unexpected %s; expected map key", tok.Type)
+			}
+			d.wr.Write(wordColon)
+			if d.cfg.Line != nil {
+				d.wr.Write(wordSpace)
 			}
+			d.current = phase_mapExpectValue
+			return false, nil
 		}
 	case phase_mapExpectValue:
 		switch tok.Type {
@@ -118,8 +127,10 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 			return true, fmt.Errorf("unexpected arrClose; expected start of value")
 		default:
 			// It's a value; handle it.
-			d.flushValue(tok)
 			d.current = phase_mapExpectKeyOrEnd
+			if err := d.flushValue(tok); err != nil {
+				return true, err
+			}
 			return false, nil
 		}
 	case phase_arrExpectValueOrEnd:
@@ -148,11 +159,13 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 		default:
 			// It's a value; handle it.
 			d.entrySep()
-			d.flushValue(tok)
+			if err := d.flushValue(tok); err != nil {
+				return true, err
+			}
 			return false, nil
 		}
 	default:
-		panic("Unreachable")
+		return true, fmt.Errorf("json encoder in invalid phase %d", d.current)
 	}
 }
 
@@ -170,7 +183,7 @@ func (d *Encoder) popPhase() (bool, error) {
 		return true, nil
 	}
 	if n < 0 { // the state machines are supposed to have already errored better
-		panic("jsonEncoder stack overpopped")
+		return true, fmt.Errorf("json encoder stack overpopped")
 	}
 	d.current = d.stack[n-1]
 	d.stack = d.stack[0:n]
@@ -191,7 +204,7 @@ func (d *Encoder) entrySep() {
 	}
 }
 
-func (d *Encoder) flushValue(tok *Token) {
+func (d *Encoder) flushValue(tok *Token) error {
 	switch tok.Type {
 	case TString:
 		d.emitString(tok.Str)
@@ -205,11 +218,19 @@ func (d *Encoder) flushValue(tok *Token) {
 	case TInt:
 		b := strconv.AppendInt(d.scratch[:0], tok.Int, 10)
 		d.wr.Write(b)
+	case TUint:
+		b := strconv.AppendUint(d.scratch[:0], tok.Uint, 10)
+		d.wr.Write(b)
+	case TFloat64:
+		return d.emitFloat(tok.Float64)
 	case TNull:
 		d.wr.Write(wordNull)
+	case TBytes:
+		return fmt.Errorf("json cannot represent bytes (transform them to a string first)")
 	default:
-		panic(fmt.Errorf("TODO finish more jsonEncoder primitives support: unhandled token %s", tok))
+		return fmt.Errorf("unexpected %s; expected start of value", tok.Type)
 	}
+	return nil
 }
 
 func (d *Encoder) writeByte(b byte) {
@@ -1,7 +1,10 @@
 package json
 
 import (
+	"fmt"
 	"io"
+	"math"
+	"strconv"
 	"unicode/utf8"
 )
 
@@ -76,3 +79,27 @@ func (d *Encoder) emitString(s string) {
 	}
 	d.writeByte('"')
 }
+
+// Floats are formatted like encoding/json does: the shortest representation
+// that roundtrips, in exponent form only for very large or small magnitudes.
+func (d *Encoder) emitFloat(f float64) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("json cannot represent float %v", f)
+	}
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b := strconv.AppendFloat(d.scratch[:0], f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	d.wr.Write(b)
+	return nil
+}
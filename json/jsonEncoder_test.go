@@ -0,0 +1,36 @@
+package json
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestEncoderErrors(t *testing.T) {
+	for _, tr := range []struct {
+		title  string
+		toks   []Token
+		expect string
+	}{
+		{"bytes", []Token{{Type: TBytes, Bytes: []byte("x")}}, "json cannot represent bytes (transform them to a string first)"},
+		{"NaN", []Token{{Type: TFloat64, Float64: math.NaN()}}, "json cannot represent float NaN"},
+		{"invalid token type", []Token{{Type: TArrOpen}, {}}, "unexpected invalid; expected start of value"},
+		{"invalid map key", []Token{{Type: TMapOpen}, {Type: TFloat64}}, "unexpected float; expected map key"},
+		{"stray close", []Token{{Type: TArrClose}}, "unexpected arrClose; expected start of value"},
+	} {
+		t.Run(tr.title, func(t *testing.T) {
+			enc := NewEncoder(&bytes.Buffer{}, EncodeOptions{})
+			var err error
+			for _, tok := range tr.toks {
+				if _, err = enc.Step(&tok); err != nil {
+					break
+				}
+			}
+			Wish(t, err.Error(), ShouldEqual, tr.expect)
+		})
+	}
+}
@@ -30,9 +30,23 @@ func testNumber(t *testing.T) {
 	})
 	t.Run("float 1 e+100", func(t *testing.T) {
 		seq := fixtures.Sequence{Tokens: fixtures.Tokens{{Type: TFloat64, Float64: 1.0e+300}}}
-		// TODO this should probably be canonical.  pending finish encoding support for float.
-		t.Run("decode", func(t *testing.T) {
-			checkDecoding(t, seq, `1e+300`, nil)
-		})
+		checkCanonical(t, seq, "1e+300")
+	})
+	t.Run("float 1.5", func(t *testing.T) {
+		seq := fixtures.Sequence{Tokens: fixtures.Tokens{{Type: TFloat64, Float64: 1.5}}}
+		checkCanonical(t, seq, "1.5")
+	})
+	t.Run("float 1 e-9", func(t *testing.T) {
+		seq := fixtures.Sequence{Tokens: fixtures.Tokens{{Type: TFloat64, Float64: 1e-9}}}
+		checkCanonical(t, seq, "1e-9")
+	})
+	t.Run("float 1", func(t *testing.T) {
+		// Floats that happen to be integers lose their float-ness; json can't say.
+		seq := fixtures.Sequence{Tokens: fixtures.Tokens{{Type: TFloat64, Float64: 1}}}
+		checkEncoding(t, seq, "1", nil)
+	})
+	t.Run("uint", func(t *testing.T) {
+		seq := fixtures.Sequence{Tokens: fixtures.Tokens{{Type: TUint, Uint: 1<<64 - 1}}}
+		checkEncoding(t, seq, "18446744073709551615", nil)
 	})
 }
@@ -0,0 +1,51 @@
+package obj
+
+import (
+	"reflect"
+)
+
+/*
+	ArrayStream is a value which marshals as an array whose elements are
+	pulled from a producer one at a time, as the tokens are consumed --
+	so a huge array can be emitted without ever materializing a slice.
+
+	The array is emitted with an indefinite length (`Length: -1`), since the
+	number of elements isn't known until the producer is exhausted;
+	cbor encodes this as an indefinite-length array, and json doesn't care.
+
+	An ArrayStream can be marshalled directly, or used as a struct field.
+	It's consumed by marshalling, so it can only be marshalled once.
+	It can't be unmarshalled into; see UnmarshalEach for the mirror of this.
+	The zero value marshals as null.
+*/
+type ArrayStream struct {
+	elem_rt reflect.Type
+	next    func() (reflect.Value, bool)
+}
+
+var rt_arrayStream = reflect.TypeOf(ArrayStream{})
+
+/*
+	NewArrayStream returns an ArrayStream that calls next for each element,
+	until it returns false.
+*/
+func NewArrayStream[T any](next func() (T, bool)) ArrayStream {
+	return ArrayStream{
+		elem_rt: reflect.TypeOf((*T)(nil)).Elem(),
+		next: func() (reflect.Value, bool) {
+			v, ok := next()
+			return reflect.ValueOf(&v).Elem(), ok
+		},
+	}
+}
+
+/*
+	NewArrayStreamFromChan returns an ArrayStream that receives each element
+	from the channel, until it is closed.
+*/
+func NewArrayStreamFromChan[T any](ch <-chan T) ArrayStream {
+	return NewArrayStream(func() (T, bool) {
+		v, ok := <-ch
+		return v, ok
+	})
+}
@@ -33,6 +33,9 @@ func Build(entries ...*AtlasEntry) (Atlas, error) {
 		defaultMapMorphism: &MapMorphism{KeySortMode_Default},
 	}
 	for _, entry := range entries {
+		if entry == nil || entry.Type == nil {
+			return Atlas{}, ErrInvalidEntry{"<nil>", "missing type info"}
+		}
 		rtid := reflect.ValueOf(entry.Type).Pointer()
 		if _, exists := atl.mappings[rtid]; exists {
 			return Atlas{}, fmt.Errorf("repeated entry for type %v", entry.Type)
@@ -46,8 +49,42 @@ func Build(entries ...*AtlasEntry) (Atlas, error) {
 			atl.tagMappings[entry.Tag] = entry
 		}
 	}
+	for _, entry := range entries {
+		if err := atl.validateEntry(entry, false); err != nil {
+			return Atlas{}, err
+		}
+		if err := atl.checkMemberTags(entry); err != nil {
+			return Atlas{}, err
+		}
+	}
 	return atl, nil
 }
+
+// Union members aren't in the tag index (it's only consulted for top-level
+// entries during unmarshal), but they still emit their tags during marshal:
+// if those collide with other tags, we'd produce streams we can't read back.
+func (atl Atlas) checkMemberTags(entry *AtlasEntry) error {
+	var members []*AtlasEntry
+	switch {
+	case entry.UnionKeyedMorphism != nil:
+		for _, ent := range entry.UnionKeyedMorphism.Elements {
+			members = append(members, ent)
+		}
+	case entry.UnionKindedMorphism != nil:
+		for _, ent := range entry.UnionKindedMorphism.Elements {
+			members = append(members, ent)
+		}
+	}
+	for _, ent := range members {
+		if !ent.Tagged {
+			continue
+		}
+		if prev, exists := atl.tagMappings[ent.Tag]; exists && prev.Type != ent.Type {
+			return ErrInvalidEntry{entry.Type.String(), fmt.Sprintf("union member type %v uses tag %v, which is already mapped to type %v", ent.Type, ent.Tag, prev.Type)}
+		}
+	}
+	return nil
+}
 func MustBuild(entries ...*AtlasEntry) Atlas {
 	atl, err := Build(entries...)
 	if err != nil {
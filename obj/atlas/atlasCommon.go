@@ -1,10 +1,19 @@
 package atlas
 
-// A type to enumerate key sorting modes.
+/*
+	A type to enumerate key sorting modes.
+
+	Maps may have string, int, uint, or bool keys (or keys of a type with an
+	atlas transform to one of those).  In the default mode, non-string keys
+	sort by their natural order (numerically; false before true);
+	in the "strings" mode, they sort by their decimal string form
+	(which is how they appear in json); in the rfc7049 mode, by their
+	cbor encoding.
+*/
 type KeySortMode string
 
 const (
-	KeySortMode_Default = KeySortMode("default") // the default mode -- for structs, this is the source-order of the fields; for maps, it's identify to "strings" sort mode.
-	KeySortMode_Strings = KeySortMode("strings") // lexical sort by strings.  this *is* the default for maps; it overrides source-order sorting for structs.
+	KeySortMode_Default = KeySortMode("default") // the default mode -- for structs, this is the source-order of the fields; for maps, it's the natural order of the keys (lexical for strings, numeric for ints).
+	KeySortMode_Strings = KeySortMode("strings") // lexical sort by strings (non-string map keys by their decimal form).  it overrides source-order sorting for structs.
 	KeySortMode_RFC7049 = KeySortMode("rfc7049") // "Canonical" as proposed by rfc7049 § 3.9 (shorter byte sequences sort to top).
 )
@@ -37,13 +37,15 @@ type AtlasEntry struct {
 	// The target type may be anything, even of a completely different Kind!
 	//
 	// This transform func runs first, then the resulting value is
-	// serialized (by running through the path through Atlas again, so
-	// chaining of transform funcs is supported, though not recommended).
+	// serialized (by running through the path through Atlas again;
+	// however, chaining into another transform func is not supported,
+	// and will be rejected when building the Atlas).
 	MarshalTransformFunc MarshalTransformFunc
 	// The type of value we expect after using the MarshalTransformFunc.
 	//
 	// The match between transform func and target type should be checked
-	// during construction of this AtlasEntry.
+	// during construction of this AtlasEntry; the target type is further
+	// checked against the rest of the Atlas when building it.
 	MarshalTransformTargetType reflect.Type
 
 	// Expects a different type (the 'serialable' value -- which will be of
@@ -64,9 +66,18 @@ type AtlasEntry struct {
 	// into, then when done provide to the UnmarshalTransformFunc.
 	//
 	// The match between transform func and target type should be checked
-	// during construction of this AtlasEntry.
+	// during construction of this AtlasEntry; the target type is further
+	// checked against the rest of the Atlas when building it.
 	UnmarshalTransformTargetType reflect.Type
 
+	// What the transform builder knew about the transform funcs (when given
+	// the user's func, as by TransformMarshalFunc): the type on the live side
+	// of each, and why the func is unusable (if it is).  Checked by `atlas.Build`.
+	marshalTransformLiveType   reflect.Type
+	marshalTransformErr        error
+	unmarshalTransformLiveType reflect.Type
+	unmarshalTransformErr      error
+
 	// --------------------------------------------------------
 	// Standard options for how to map (varies by Kind)
 	// --------------------------------------------------------
@@ -90,8 +101,16 @@ type AtlasEntry struct {
 	// Only valid if `this.Type.Kind() == Interface`.
 	UnionKeyedMorphism *UnionKeyedMorphism
 
-	// FUTURE: enum-ish primitives, multiplexers for interfaces,
-	//  lots of such things will belong here.
+	// Configuration for how to pick concrete types to fill a union interface
+	// based on the kind of token seen.
+	// Only valid if `this.Type.Kind() == Interface`.
+	UnionKindedMorphism *UnionKindedMorphism
+
+	// Configuration for mapping a fixed set of values to serial strings or ints.
+	// Only valid if `this.Type` is comparable.
+	EnumMorphism *EnumMorphism
+
+	// FUTURE: lots more such things will belong here.
 
 	// --------------------------------------------------------
 	// Hooks, validate helpers
@@ -148,3 +167,15 @@ func (x *BuilderCore) UseTag(tag int) *BuilderCore {
 	x.entry.Tag = tag
 	return x
 }
+
+/*
+	Finish the entry without choosing any specialized behavior.
+	The type will be handled the same way refmt handles it by default.
+
+	This is only useful when declaring members of another entry
+	(for example, a plain string as a member of a kinded union);
+	such an entry has nothing to do on its own.
+*/
+func (x *BuilderCore) Complete() *AtlasEntry {
+	return x.entry
+}
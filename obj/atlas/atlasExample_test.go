@@ -1,6 +1,11 @@
 package atlas_test
 
 import (
+	"fmt"
+	"reflect"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
 	"github.com/polydawn/refmt/obj/atlas"
 )
 
@@ -36,3 +41,60 @@ func ExampleAtlasBuilding() {
 
 	// Output:
 }
+
+func ExampleAtlas_JSONSchema() {
+	type Point struct {
+		X, Y  int
+		Label string
+	}
+
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(Point{}).StructMap().
+			AddField("X", atlas.StructMapEntry{SerialName: "x"}).
+			AddField("Y", atlas.StructMapEntry{SerialName: "y"}).
+			AddField("Label", atlas.StructMapEntry{SerialName: "label", OmitEmpty: true}).
+			Complete(),
+	)
+	schema, err := atl.JSONSchema(reflect.TypeOf([]Point{}))
+	if err != nil {
+		panic(err)
+	}
+	bs, err := refmt.Marshal(json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}, schema)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(bs))
+
+	// Output:
+	// {
+	// 	"$defs": {
+	// 		"atlas_test.Point": {
+	// 			"additionalProperties": false,
+	// 			"properties": {
+	// 				"label": {
+	// 					"type": "string"
+	// 				},
+	// 				"x": {
+	// 					"type": "integer"
+	// 				},
+	// 				"y": {
+	// 					"type": "integer"
+	// 				}
+	// 			},
+	// 			"required": [
+	// 				"x",
+	// 				"y"
+	// 			],
+	// 			"type": "object"
+	// 		}
+	// 	},
+	// 	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	// 	"items": {
+	// 		"$ref": "#/$defs/atlas_test.Point"
+	// 	},
+	// 	"type": [
+	// 		"array",
+	// 		"null"
+	// 	]
+	// }
+}
@@ -0,0 +1,219 @@
+package atlas
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+/*
+	Check an entry both for internal consistency, and that everything
+	it delegates to can be resolved by the atlas.
+
+	Entries used as members of unions are checked as part of the union
+	entry, and those may be bare entries (with no behavior configured),
+	so long as the default behavior for their type is usable.
+*/
+func (atl Atlas) validateEntry(entry *AtlasEntry, member bool) error {
+	fail := func(format string, args ...interface{}) error {
+		return ErrInvalidEntry{entry.Type.String(), fmt.Sprintf(format, args...)}
+	}
+
+	// Count behaviors.  Transforms may co-exist with any one other behavior
+	//  (the transform wins in whichever direction it's set), but the others are exclusive.
+	nBehaviors := 0
+	for _, set := range []bool{
+		entry.StructMap != nil,
+		entry.MapMorphism != nil,
+		entry.UnionKeyedMorphism != nil,
+		entry.UnionKindedMorphism != nil,
+		entry.EnumMorphism != nil,
+	} {
+		if set {
+			nBehaviors++
+		}
+	}
+	hasTransform := entry.MarshalTransformFunc != nil || entry.UnmarshalTransformFunc != nil
+	switch {
+	case nBehaviors > 1:
+		return fail("more than one behavior configured (only one of structMap, mapMorphism, union, or enum may be used)")
+	case nBehaviors == 0 && !hasTransform && !member:
+		return fail("no behavior configured (entries with no behavior are only usable as members of a union)")
+	case nBehaviors == 0 && !hasTransform && member:
+		if err := atl.checkResolvable(entry.Type, nil); err != nil {
+			return fail("%s", err)
+		}
+	}
+
+	// Check the kinds are sane for the behaviors.
+	switch {
+	case entry.StructMap != nil && entry.Type.Kind() != reflect.Struct:
+		return fail("cannot use structMap for kind %s", entry.Type.Kind())
+	case entry.MapMorphism != nil && entry.Type.Kind() != reflect.Map:
+		return fail("cannot use mapMorphism for kind %s", entry.Type.Kind())
+	case entry.UnionKeyedMorphism != nil && entry.Type.Kind() != reflect.Interface,
+		entry.UnionKindedMorphism != nil && entry.Type.Kind() != reflect.Interface:
+		return fail("cannot use union morphisms for kind %s", entry.Type.Kind())
+	}
+
+	// Check transforms.
+	if err := atl.validateTransform(entry, "marshal", entry.MarshalTransformFunc != nil, entry.MarshalTransformTargetType, entry.marshalTransformErr, func(other *AtlasEntry) bool {
+		return other.MarshalTransformFunc != nil
+	}); err != nil {
+		return fail("%s", err)
+	}
+	if err := atl.validateTransform(entry, "unmarshal", entry.UnmarshalTransformFunc != nil, entry.UnmarshalTransformTargetType, entry.unmarshalTransformErr, func(other *AtlasEntry) bool {
+		return other.UnmarshalTransformFunc != nil
+	}); err != nil {
+		return fail("%s", err)
+	}
+	// The live side of the funcs has to fit the entry's type (if we know it; hand-written funcs are on their own).
+	if live_rt := entry.marshalTransformLiveType; live_rt != nil && entry.MarshalTransformFunc != nil && !entry.Type.AssignableTo(live_rt) {
+		return fail("marshal transform func takes %v, which is not assignable from %v", live_rt, entry.Type)
+	}
+	if live_rt := entry.unmarshalTransformLiveType; live_rt != nil && entry.UnmarshalTransformFunc != nil && !live_rt.AssignableTo(entry.Type) {
+		return fail("unmarshal transform func yields %v, which is not assignable to %v", live_rt, entry.Type)
+	}
+
+	// Check each of the other behaviors.
+	switch {
+	case entry.StructMap != nil:
+		seen := make(map[string]struct{}, len(entry.StructMap.Fields))
+		for _, field := range entry.StructMap.Fields {
+			if _, exists := seen[field.SerialName]; exists {
+				return fail("repeated serial name %q", field.SerialName)
+			}
+			seen[field.SerialName] = struct{}{}
+			if field.KeyAsInt && field.SerialName != strconv.FormatInt(field.SerialInt, 10) {
+				return fail("field %q is keyed as int, but its serial name is not the int %d", field.SerialName, field.SerialInt)
+			}
+			if field.Ignore {
+				continue
+			}
+			if field.Type == nil {
+				return fail("field %q is missing type info", field.SerialName)
+			}
+			if err := atl.checkResolvable(field.Type, nil); err != nil {
+				return fail("field %q: %s", field.SerialName, err)
+			}
+		}
+	case entry.MapMorphism != nil:
+		if err := atl.checkResolvable(entry.Type.Elem(), nil); err != nil {
+			return fail("map values: %s", err)
+		}
+	case entry.UnionKeyedMorphism != nil:
+		seen := make(map[reflect.Type]string, len(entry.UnionKeyedMorphism.Elements))
+		for hint, ent := range entry.UnionKeyedMorphism.Elements {
+			if err := atl.validateUnionMember(entry, ent); err != nil {
+				return fail("union member %q: %s", hint, err)
+			}
+			if prev, exists := seen[ent.Type]; exists {
+				return fail("union members %q and %q are both type %v, so marshalling would be ambiguous", prev, hint, ent.Type)
+			}
+			seen[ent.Type] = hint
+		}
+	case entry.UnionKindedMorphism != nil:
+		for tt, ent := range entry.UnionKindedMorphism.Elements {
+			if err := atl.validateUnionMember(entry, ent); err != nil {
+				return fail("union member for %s tokens: %s", tt, err)
+			}
+		}
+		if err := entry.UnionKindedMorphism.validate(); err != nil {
+			return fail("%s", err)
+		}
+	case entry.EnumMorphism != nil:
+		if len(entry.EnumMorphism.Serials) == 0 && !entry.EnumMorphism.Fallback.IsValid() {
+			return fail("enum has no members")
+		}
+	}
+	return nil
+}
+
+func (atl Atlas) validateTransform(
+	entry *AtlasEntry,
+	direction string,
+	hasFunc bool,
+	target_rt reflect.Type,
+	madeErr error,
+	isTransform func(*AtlasEntry) bool,
+) error {
+	switch {
+	case !hasFunc && target_rt == nil:
+		return nil
+	case !hasFunc:
+		return fmt.Errorf("%s transform has a target type but no func", direction)
+	case target_rt == nil:
+		// Funcs given to TransformMarshalFunc (et al) say why they didn't yield a type.
+		if madeErr != nil {
+			return fmt.Errorf("%s transform: %s", direction, madeErr)
+		}
+		return fmt.Errorf("%s transform has a func but no target type", direction)
+	}
+	peeled_rt := target_rt
+	for peeled_rt.Kind() == reflect.Ptr {
+		peeled_rt = peeled_rt.Elem()
+	}
+	if peeled_rt == entry.Type {
+		return fmt.Errorf("%s transform targets its own type", direction)
+	}
+	if other, ok := atl.mappings[reflect.ValueOf(peeled_rt).Pointer()]; ok && isTransform(other) {
+		return fmt.Errorf("%s transform targets type %v, which also has a %s transform (chained transforms are not supported)", direction, peeled_rt, direction)
+	}
+	if err := atl.checkResolvable(target_rt, nil); err != nil {
+		return fmt.Errorf("%s transform target: %s", direction, err)
+	}
+	return nil
+}
+
+func (atl Atlas) validateUnionMember(union *AtlasEntry, member *AtlasEntry) error {
+	if member == nil || member.Type == nil {
+		return fmt.Errorf("missing type info")
+	}
+	if !member.Type.AssignableTo(union.Type) {
+		return fmt.Errorf("type %v is not assignable to the interface", member.Type)
+	}
+	if member.UnionKindedMorphism != nil || member.UnionKeyedMorphism != nil && union.UnionKeyedMorphism != nil {
+		return fmt.Errorf("type %v is itself a union, which can't be nested in this kind of union", member.Type)
+	}
+	return atl.validateEntry(member, true)
+}
+
+/*
+	Check that the machinery in the obj package will be able to find a
+	way to handle the type: either it's in the atlas, or there's a usable
+	default behavior for its kind (checking recursively into the contents
+	of slices, maps, etc).
+*/
+func (atl Atlas) checkResolvable(rt reflect.Type, seen map[reflect.Type]struct{}) error {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if _, ok := atl.mappings[reflect.ValueOf(rt).Pointer()]; ok {
+		return nil
+	}
+	if _, ok := seen[rt]; ok {
+		return nil
+	}
+	if seen == nil {
+		seen = make(map[reflect.Type]struct{})
+	}
+	seen[rt] = struct{}{}
+	if _, ok := nativeType(rt); ok {
+		return nil
+	}
+	switch rt.Kind() {
+	case reflect.Bool,
+		reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface:
+		return nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return atl.checkResolvable(rt.Elem(), seen)
+	case reflect.Struct:
+		return fmt.Errorf("missing an atlas entry describing how to handle type %v", rt)
+	default:
+		return fmt.Errorf("type %v is of kind %s, which cannot be serialized", rt, rt.Kind())
+	}
+}
@@ -0,0 +1,161 @@
+package atlas
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/polydawn/refmt/tok"
+)
+
+type tUnion interface {
+	_tUnion()
+}
+
+type tUnionMemberA struct{ X string }
+
+func (tUnionMemberA) _tUnion() {}
+
+type tObjNested struct {
+	N tObjStr
+}
+
+func TestAtlasValidation(t *testing.T) {
+	Convey("Building atlases should validate entries:", t, func() {
+		Convey("transform funcs of the wrong shape are an error, not a panic", func() {
+			_, err := Build(
+				BuildEntry(tObjStr{}).Transform().
+					TransformMarshalFunc(
+						func(x tObjStr) string {
+							return x.X
+						}).
+					Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjStr", "marshal transform: invalid transform func func(atlas.tObjStr) string: must return exactly two values (should be of the form `func(T1) (T2, error)`)"})
+			_, err = Build(
+				BuildEntry(tObjStr{}).Transform().
+					TransformMarshal(MakeMarshalTransformFunc(
+						func(x tObjStr) string {
+							return x.X
+						})).
+					Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjStr", "marshal transform has a func but no target type"})
+		})
+		Convey("chained transforms are an error", func() {
+			_, err := Build(
+				BuildEntry(tObjStr{}).Transform().
+					TransformMarshal(MakeMarshalTransformFunc(
+						func(x tObjStr) (tObjNested, error) {
+							return tObjNested{x}, nil
+						})).
+					Complete(),
+				BuildEntry(tObjNested{}).Transform().
+					TransformMarshal(MakeMarshalTransformFunc(
+						func(x tObjNested) (string, error) {
+							return x.N.X, nil
+						})).
+					Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjStr", "marshal transform targets type atlas.tObjNested, which also has a marshal transform (chained transforms are not supported)"})
+		})
+		Convey("transform funcs must agree with the entry's type", func() {
+			_, err := Build(
+				BuildEntry(tObjStr{}).Transform().
+					TransformMarshalFunc(
+						func(x int) (string, error) {
+							return "", nil
+						}).
+					TransformUnmarshalFunc(
+						func(x string) (int, error) {
+							return 0, nil
+						}).
+					Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjStr", "marshal transform func takes int, which is not assignable from atlas.tObjStr"})
+			_, err = Build(
+				BuildEntry(tObjStr{}).Transform().
+					TransformUnmarshalFunc(
+						func(x string) (int, error) {
+							return 0, nil
+						}).
+					Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjStr", "unmarshal transform func yields int, which is not assignable to atlas.tObjStr"})
+		})
+		Convey("the typeinfo from making transform funcs is just the target type", func() {
+			_, rt := MakeMarshalTransformFunc(func(x tObjStr) (string, error) { return x.X, nil })
+			So(rt == reflect.TypeOf(""), ShouldBeTrue)
+			_, rt = MakeUnmarshalTransformFunc(func(x string) (tObjStr, error) { return tObjStr{x}, nil })
+			So(rt == reflect.TypeOf(""), ShouldBeTrue)
+			_, rt = MakeTypedMarshalTransformFunc(func(x tObjStr) (string, error) { return x.X, nil })
+			So(rt == reflect.TypeOf(""), ShouldBeTrue)
+			_, rt = MakeMarshalTransformFunc("not a func")
+			So(rt, ShouldBeNil)
+		})
+		Convey("transform funcs are not called while validating", func() {
+			_, err := Build(
+				BuildEntry(tObjStr{}).Transform().
+					TransformMarshal(func(reflect.Value) (reflect.Value, error) {
+						panic("should not be called")
+					}, nil).
+					Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjStr", "marshal transform has a func but no target type"})
+		})
+		Convey("struct fields need entries for struct types", func() {
+			_, err := Build(
+				BuildEntry(tObjNested{}).StructMap().Autogenerate().Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjNested", "field \"n\": missing an atlas entry describing how to handle type atlas.tObjStr"})
+		})
+		Convey("union members must be assignable to the interface", func() {
+			_, err := Build(
+				BuildEntry((*tUnion)(nil)).KeyedUnion().Of(map[string]*AtlasEntry{
+					"a": BuildEntry(tUnionMemberA{}).StructMap().Autogenerate().Complete(),
+					"b": BuildEntry(tObjStr{}).StructMap().Autogenerate().Complete(),
+				}),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tUnion", "union member \"b\": type atlas.tObjStr is not assignable to the interface"})
+		})
+		Convey("nil union members are an error, not a panic", func() {
+			_, err := Build(
+				BuildEntry((*tUnion)(nil)).KindedUnion().Of(map[tok.TokenType]*AtlasEntry{
+					tok.TMapOpen: nil,
+				}),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tUnion", "union member for map open tokens: missing type info"})
+			_, err = Build(
+				BuildEntry((*tUnion)(nil)).KeyedUnion().Of(map[string]*AtlasEntry{
+					"a": nil,
+				}),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tUnion", "union member \"a\": missing type info"})
+		})
+		Convey("union member tags must not collide with other entries", func() {
+			_, err := Build(
+				BuildEntry((*tUnion)(nil)).KeyedUnion().Of(map[string]*AtlasEntry{
+					"a": BuildEntry(tUnionMemberA{}).UseTag(40).StructMap().Autogenerate().Complete(),
+				}),
+				BuildEntry(tObjStr{}).UseTag(40).StructMap().Autogenerate().Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tUnion", "union member type atlas.tUnionMemberA uses tag 40, which is already mapped to type atlas.tObjStr"})
+		})
+		Convey("entries with no behavior are an error at the top level", func() {
+			_, err := Build(
+				BuildEntry(tObjStr{}).Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjStr", "no behavior configured (entries with no behavior are only usable as members of a union)"})
+		})
+		Convey("fields keyed as int must have an int serial name", func() {
+			type tObjBadKey struct {
+				X string `refmt:"x,keyasint"`
+			}
+			_, err := Build(
+				BuildEntry(tObjBadKey{}).StructMap().Autogenerate().Complete(),
+			)
+			So(err, ShouldResemble, ErrInvalidEntry{"atlas.tObjBadKey", "field \"x\" is keyed as int, but its serial name is not the int 0"})
+		})
+	})
+}
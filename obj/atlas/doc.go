@@ -26,6 +26,13 @@
 	The final function in the chain is always called `Complete`, and returns
 	a ready-to-use AtlasEntry.
 
+	Transforms can also be declared in one step with type-checked funcs:
+
+		atlas.TransformEntry(
+			func(x Formula) (string, error) { ... },
+			func(x string) (Formula, error) { ... },
+		)
+
 	Building a complete Atlas for a whole suite of serializable types is as
 	easy as putting a bunch of them together:
 
@@ -0,0 +1,129 @@
+package atlas
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/polydawn/refmt/tok"
+)
+
+/*
+	EnumMorphism maps a fixed set of Go values (typically consts of some
+	typedef'd int or string) to a fixed set of serial values, which may
+	be either strings or ints (but all members of one enum use the same).
+
+	Unmarshalling a serial value which isn't one of the members is an error,
+	unless a fallback member is configured, in which case the fallback
+	is used instead.
+*/
+type EnumMorphism struct {
+	// Mapping of live values to serial values (which are either string or int64).
+	Serials map[interface{}]interface{}
+	// Mapping of serial values to live values (the dual of the Serials map).
+	Lives map[interface{}]reflect.Value
+	// Either tok.TString or tok.TInt; all serial values are of this kind.
+	SerialType tok.TokenType
+	// If valid, unmarshal of an unknown serial value yields this instead of erroring.
+	Fallback reflect.Value
+	// Purely to have in readiness for error messaging.
+	KnownMembers []string
+}
+
+func (x *BuilderCore) Enum() *BuilderEnumMorphism {
+	if !x.entry.Type.Comparable() {
+		panic(fmt.Errorf("cannot use enum morphism for type %q, which is not comparable", x.entry.Type))
+	}
+	x.entry.EnumMorphism = &EnumMorphism{
+		Serials: make(map[interface{}]interface{}),
+		Lives:   make(map[interface{}]reflect.Value),
+	}
+	return &BuilderEnumMorphism{x.entry}
+}
+
+type BuilderEnumMorphism struct {
+	entry *AtlasEntry
+}
+
+func (x *BuilderEnumMorphism) Complete() *AtlasEntry {
+	sort.Strings(x.entry.EnumMorphism.KnownMembers)
+	return x.entry
+}
+
+/*
+	Add a member to the enum.
+
+	The live value must be of the type the entry is for;
+	the serial value must be a string or some kind of int,
+	and must be the same kind as all other members of the enum.
+
+	Returns the mutated builder for convenient call chaining.
+
+	If the values are of the wrong types, or either value has already
+	been used for another member, a panic will be raised.
+*/
+func (x *BuilderEnumMorphism) AddMember(live interface{}, serial interface{}) *BuilderEnumMorphism {
+	cfg := x.entry.EnumMorphism
+	live_rv := reflect.ValueOf(live)
+	if live_rv.Type() != x.entry.Type {
+		panic(fmt.Errorf("enum member %v is of type %v, not %v", live, live_rv.Type(), x.entry.Type))
+	}
+	serial, tt, err := normalizeEnumSerial(serial)
+	if err != nil {
+		panic(fmt.Errorf("enum member %v: %s", live, err))
+	}
+	switch cfg.SerialType {
+	case 0:
+		cfg.SerialType = tt
+	case tt:
+		// pass
+	default:
+		panic(fmt.Errorf("enum member %v: serial value %v is %s, but other members are %s", live, serial, tt, cfg.SerialType))
+	}
+	if _, exists := cfg.Serials[live]; exists {
+		panic(fmt.Errorf("repeated enum member %v", live))
+	}
+	if _, exists := cfg.Lives[serial]; exists {
+		panic(fmt.Errorf("repeated enum serial value %v", serial))
+	}
+	cfg.Serials[live] = serial
+	cfg.Lives[serial] = live_rv
+	cfg.KnownMembers = append(cfg.KnownMembers, fmt.Sprint(serial))
+	return x
+}
+
+/*
+	Set a member which unmarshal will use when the serial value is not
+	one of the known members.  (By default, that's an error.)
+
+	The fallback value does not have to be one of the members added
+	by AddMember, but if it isn't, it can't be marshalled.
+*/
+func (x *BuilderEnumMorphism) Fallback(live interface{}) *BuilderEnumMorphism {
+	live_rv := reflect.ValueOf(live)
+	if live_rv.Type() != x.entry.Type {
+		panic(fmt.Errorf("enum fallback %v is of type %v, not %v", live, live_rv.Type(), x.entry.Type))
+	}
+	x.entry.EnumMorphism.Fallback = live_rv
+	return x
+}
+
+// Flip ints of all sizes into int64 so they can be used as consistent map keys.
+func normalizeEnumSerial(serial interface{}) (interface{}, tok.TokenType, error) {
+	rv := reflect.ValueOf(serial)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), tok.TString, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), tok.TInt, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u > 1<<63-1 {
+			return nil, 0, fmt.Errorf("serial value %s overflows int64", strconv.FormatUint(u, 10))
+		}
+		return int64(u), tok.TInt, nil
+	default:
+		return nil, 0, fmt.Errorf("serial value must be a string or int, not %T", serial)
+	}
+}
@@ -12,3 +12,29 @@ type ErrStructureMismatch struct {
 func (e ErrStructureMismatch) Error() string {
 	return "structure mismatch: " + e.TypeName + " " + e.Reason
 }
+
+// Error type raised when initializing an Atlas, and an AtlasEntry is
+// inconsistent -- either with itself (for example, a union member which can't
+// be assigned to the union's interface), or with the rest of the Atlas
+// (for example, a transform to a struct type which the Atlas has no entry for).
+type ErrInvalidEntry struct {
+	TypeName string
+	Reason   string
+}
+
+func (e ErrInvalidEntry) Error() string {
+	return "invalid atlas entry for " + e.TypeName + ": " + e.Reason
+}
+
+// Error type returned by transform funcs made with MakeMarshalTransformFunc
+// or MakeUnmarshalTransformFunc if they were given something that's not a
+// function of the right shape.
+// (Initializing an Atlas with such an entry will also return this error.)
+type ErrInvalidTransformFunc struct {
+	FuncType string
+	Reason   string
+}
+
+func (e ErrInvalidTransformFunc) Error() string {
+	return "invalid transform func " + e.FuncType + ": " + e.Reason + " (should be of the form `func(T1) (T2, error)`)"
+}
@@ -0,0 +1,322 @@
+package atlas
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/polydawn/refmt/shared"
+	"github.com/polydawn/refmt/tok"
+)
+
+// The JSON Schema dialect JSONSchema emits.  (The same as infer.JSONSchemaDialect.)
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+/*
+	JSONSchema returns a JSON Schema document describing the serial form
+	of values of rootType when they're marshalled with this atlas.
+	The document is a tree of maps and slices, ready to be marshalled
+	(with any encoder, and no atlas needed).
+
+	The schema is worked out from the atlas the same way the obj package
+	picks how to marshal each type, so a published schema derived from
+	the atlas in use can't drift from what's actually emitted:
+
+	  - Each type with an atlas entry gets a definition in "$defs"
+	     (named after the Go type), and is referred to by "$ref"
+	     wherever it's used, so recursive types are fine.
+	  - Struct maps are objects with the fields' serial names as properties;
+	     fields are "required" unless they're omitempty, and other keys
+	     aren't allowed (since unmarshalling rejects them).
+	  - Keyed unions are a "oneOf" of single-entry objects, one per member,
+	     keyed by the member's discriminator.  Kinded unions are an "anyOf"
+	     of their members (which JSON can't always tell apart -- e.g. a
+	     float which happens to be integral, or bytes and strings).
+	  - Enums list their serial values in an "enum".
+	  - Transformed types are described by their marshal transform's
+	     target type.
+	  - Entries which emit a tag (structs, enums, and transforms) are
+	     annotated with "x-cbor-tag".
+	  - Pointers, slices and maps are nullable, since nil ones are
+	     marshalled as null.  Bytes are strings with a "contentEncoding"
+	     of "base64", since that's how they'd look converted to json.
+
+	An error is returned if some type reachable from rootType couldn't be
+	marshalled by the atlas (e.g. a struct with no entry).
+*/
+func (atl Atlas) JSONSchema(rootType reflect.Type) (map[string]interface{}, error) {
+	g := jsonSchemaGen{
+		atl:   atl,
+		defs:  make(map[string]interface{}),
+		names: make(map[*AtlasEntry]string),
+		taken: make(map[string]bool),
+	}
+	doc, err := g.schemaFor(rootType)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.defs) > 0 {
+		doc["$defs"] = g.defs
+	}
+	doc["$schema"] = jsonSchemaDialect
+	return doc, nil
+}
+
+type jsonSchemaGen struct {
+	atl   Atlas
+	defs  map[string]interface{} // schemas of the atlas entries seen so far, by name.
+	names map[*AtlasEntry]string // names in defs of the atlas entries seen so far.
+	taken map[string]bool        // names in defs used so far.
+}
+
+var rt_bytes = reflect.TypeOf([]byte{})
+
+// The schema for values of the type, following the same precedence
+// as the obj package does when picking a marshal machine.
+func (g *jsonSchemaGen) schemaFor(rt reflect.Type) (map[string]interface{}, error) {
+	if rt.Kind() == reflect.Ptr {
+		js, err := g.schemaFor(rt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(js), nil
+	}
+	// Builtin primitives can't be overridden by the atlas.
+	if rt.PkgPath() == "" && rt.Name() != "" && rt.Kind() != reflect.Interface || rt == rt_bytes {
+		return g.kindSchema(rt)
+	}
+	if entry, ok := g.atl.mappings[reflect.ValueOf(rt).Pointer()]; ok {
+		return g.ref(entry)
+	}
+	if js, ok := nativeType(rt); ok && js != nil {
+		return js, nil
+	}
+	return g.kindSchema(rt)
+}
+
+// A reference to the definition of a top-level atlas entry,
+// adding the definition if it's not there yet.
+func (g *jsonSchemaGen) ref(entry *AtlasEntry) (map[string]interface{}, error) {
+	name, ok := g.names[entry]
+	if !ok {
+		name = entry.Type.String()
+		for i := 2; g.taken[name]; i++ {
+			name = entry.Type.String() + "_" + strconv.Itoa(i)
+		}
+		g.names[entry] = name
+		g.taken[name] = true
+		js, err := g.entrySchema(entry)
+		if err != nil {
+			return nil, err
+		}
+		g.defs[name] = js
+	}
+	// Escaped as a JSON Pointer token, since type names may contain '/' (e.g. generic type parameters).
+	return map[string]interface{}{"$ref": "#/$defs/" + shared.EscapePointerToken(name)}, nil
+}
+
+// The schema for an atlas entry itself.
+func (g *jsonSchemaGen) entrySchema(entry *AtlasEntry) (js map[string]interface{}, err error) {
+	tagged := false
+	switch {
+	case entry.MarshalTransformFunc != nil:
+		js, err = g.schemaFor(entry.MarshalTransformTargetType)
+		tagged = entry.Tagged
+	case entry.StructMap != nil:
+		js, err = g.structSchema(entry.StructMap)
+		tagged = entry.Tagged
+	case entry.UnionKeyedMorphism != nil:
+		js, err = g.unionKeyedSchema(entry.UnionKeyedMorphism)
+	case entry.UnionKindedMorphism != nil:
+		js, err = g.unionKindedSchema(entry.UnionKindedMorphism)
+	case entry.EnumMorphism != nil:
+		js = enumSchema(entry.EnumMorphism)
+		tagged = entry.Tagged
+	case entry.MapMorphism != nil:
+		// Key sorting doesn't change what the map looks like.
+		js, err = g.kindSchema(entry.Type)
+	default:
+		// Union members with no behavior configured get the default behavior for their type.
+		js, err = g.schemaFor(entry.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tagged {
+		js["x-cbor-tag"] = entry.Tag
+	}
+	return js, nil
+}
+
+// The schema for a member of a union: a reference if the entry is also
+// the atlas's entry for its type, or else the entry's schema inline.
+func (g *jsonSchemaGen) memberSchema(entry *AtlasEntry) (map[string]interface{}, error) {
+	if mapped, ok := g.atl.mappings[reflect.ValueOf(entry.Type).Pointer()]; ok && mapped == entry {
+		return g.ref(entry)
+	}
+	return g.entrySchema(entry)
+}
+
+func (g *jsonSchemaGen) structSchema(sm *StructMap) (map[string]interface{}, error) {
+	props := map[string]interface{}{}
+	var required []string
+	for _, field := range sm.Fields {
+		if field.Ignore {
+			// Never marshalled, but allowed (and ignored) when unmarshalling.
+			props[field.SerialName] = map[string]interface{}{}
+			continue
+		}
+		js, err := g.schemaFor(field.Type)
+		if err != nil {
+			return nil, err
+		}
+		props[field.SerialName] = js
+		if !field.OmitEmpty {
+			required = append(required, field.SerialName)
+		}
+	}
+	js := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		js["required"] = required
+	}
+	return js, nil
+}
+
+func (g *jsonSchemaGen) unionKeyedSchema(u *UnionKeyedMorphism) (map[string]interface{}, error) {
+	members := make([]interface{}, 0, len(u.KnownMembers))
+	for _, hint := range u.KnownMembers {
+		js, err := g.memberSchema(u.Elements[hint])
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, map[string]interface{}{
+			"type":                 "object",
+			"properties":           map[string]interface{}{hint: js},
+			"required":             []string{hint},
+			"additionalProperties": false,
+		})
+	}
+	return map[string]interface{}{"oneOf": members}, nil
+}
+
+func (g *jsonSchemaGen) unionKindedSchema(u *UnionKindedMorphism) (map[string]interface{}, error) {
+	// Members in order of their token types' names (like KnownMembers),
+	// and only once each, since an entry may be used for several token types.
+	tts := make([]tok.TokenType, 0, len(u.Elements))
+	for tt := range u.Elements {
+		tts = append(tts, tt)
+	}
+	sort.Slice(tts, func(i, j int) bool { return tts[i].String() < tts[j].String() })
+	seen := make(map[*AtlasEntry]bool, len(tts))
+	members := make([]interface{}, 0, len(tts))
+	for _, tt := range tts {
+		entry := u.Elements[tt]
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		js, err := g.memberSchema(entry)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, js)
+	}
+	return map[string]interface{}{"anyOf": members}, nil
+}
+
+func enumSchema(e *EnumMorphism) map[string]interface{} {
+	values := make([]interface{}, 0, len(e.Lives))
+	for serial := range e.Lives {
+		values = append(values, serial)
+	}
+	js := map[string]interface{}{}
+	switch e.SerialType {
+	case tok.TString:
+		sort.Slice(values, func(i, j int) bool { return values[i].(string) < values[j].(string) })
+		js["type"] = "string"
+	case tok.TInt:
+		sort.Slice(values, func(i, j int) bool { return values[i].(int64) < values[j].(int64) })
+		js["type"] = "integer"
+	}
+	js["enum"] = values
+	return js
+}
+
+// The schema for the default behavior for the type's kind.
+func (g *jsonSchemaGen) kindSchema(rt reflect.Type) (map[string]interface{}, error) {
+	switch rt.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Slice, reflect.Array:
+		var js map[string]interface{}
+		switch {
+		case rt.Elem().Kind() == reflect.Uint8:
+			js = map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		default:
+			items, err := g.schemaFor(rt.Elem())
+			if err != nil {
+				return nil, err
+			}
+			js = map[string]interface{}{"type": "array", "items": items}
+			if rt.Kind() == reflect.Array {
+				js["minItems"] = rt.Len()
+				js["maxItems"] = rt.Len()
+			}
+		}
+		if rt.Kind() == reflect.Slice {
+			return nullable(js), nil
+		}
+		return js, nil
+	case reflect.Map:
+		values, err := g.schemaFor(rt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(map[string]interface{}{"type": "object", "additionalProperties": values}), nil
+	case reflect.Interface:
+		return map[string]interface{}{}, nil // anything goes.
+	case reflect.Struct:
+		return nil, fmt.Errorf("missing an atlas entry describing how to handle type %v", rt)
+	default:
+		return nil, fmt.Errorf("type %v is of kind %s, which cannot be serialized", rt, rt.Kind())
+	}
+}
+
+// Allow null as well as whatever js allows.
+func nullable(js map[string]interface{}) map[string]interface{} {
+	_, isEnum := js["enum"]
+	switch typ := js["type"].(type) {
+	case string:
+		if !isEnum {
+			js["type"] = []string{typ, "null"}
+			return js
+		}
+	case []string:
+		for _, t := range typ {
+			if t == "null" {
+				return js
+			}
+		}
+		if !isEnum {
+			js["type"] = append(typ, "null")
+			return js
+		}
+	case nil:
+		if len(js) == 0 {
+			return js // anything goes already.
+		}
+	}
+	return map[string]interface{}{"anyOf": []interface{}{js, map[string]interface{}{"type": "null"}}}
+}
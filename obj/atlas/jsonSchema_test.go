@@ -0,0 +1,194 @@
+package atlas
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/polydawn/refmt/tok"
+)
+
+type tSchemaColor int
+
+type tSchemaShape interface {
+	_tSchemaShape()
+}
+
+type tSchemaCircle struct{ R float64 }
+type tSchemaSquare struct{ Side int }
+
+func (tSchemaCircle) _tSchemaShape() {}
+func (tSchemaSquare) _tSchemaShape() {}
+
+type tSchemaDoc struct {
+	Name   string
+	Color  tSchemaColor
+	Shapes []tSchemaShape
+	Labels map[string]string
+	Parent *tSchemaDoc
+	When   tObjStr
+	Raw    []byte
+	Note   string
+}
+
+func TestJSONSchema(t *testing.T) {
+	Convey("Deriving JSON Schema from an atlas:", t, func() {
+		Convey("structs, keyed unions, enums, maps, and transforms", func() {
+			atl := MustBuild(
+				BuildEntry(tSchemaDoc{}).StructMap().
+					AddField("Name", StructMapEntry{SerialName: "name"}).
+					AddField("Color", StructMapEntry{SerialName: "color"}).
+					AddField("Shapes", StructMapEntry{SerialName: "shapes"}).
+					AddField("Labels", StructMapEntry{SerialName: "labels"}).
+					AddField("Parent", StructMapEntry{SerialName: "parent", OmitEmpty: true}).
+					AddField("When", StructMapEntry{SerialName: "when"}).
+					AddField("Raw", StructMapEntry{SerialName: "raw", OmitEmpty: true}).
+					AddField("Note", StructMapEntry{SerialName: "note", OmitEmpty: true}).
+					Complete(),
+				BuildEntry(tSchemaColor(0)).Enum().
+					AddMember(tSchemaColor(1), "red").
+					AddMember(tSchemaColor(2), "blue").
+					Complete(),
+				BuildEntry((*tSchemaShape)(nil)).KeyedUnion().Of(map[string]*AtlasEntry{
+					"circle": BuildEntry(tSchemaCircle{}).StructMap().Autogenerate().Complete(),
+					"square": BuildEntry(tSchemaSquare{}).UseTag(7).StructMap().Autogenerate().Complete(),
+				}),
+				BuildEntry(map[string]string{}).MapMorphism().Complete(),
+				BuildEntry(tObjStr{}).UseTag(42).Transform().
+					TransformMarshal(MakeMarshalTransformFunc(
+						func(x tObjStr) (string, error) {
+							return x.X, nil
+						})).
+					TransformUnmarshal(MakeUnmarshalTransformFunc(
+						func(x string) (tObjStr, error) {
+							return tObjStr{x}, nil
+						})).
+					Complete(),
+			)
+			doc, err := atl.JSONSchema(reflect.TypeOf(tSchemaDoc{}))
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, map[string]interface{}{
+				"$schema": jsonSchemaDialect,
+				"$ref":    "#/$defs/atlas.tSchemaDoc",
+				"$defs": map[string]interface{}{
+					"atlas.tSchemaDoc": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"name":  map[string]interface{}{"type": "string"},
+							"color": map[string]interface{}{"$ref": "#/$defs/atlas.tSchemaColor"},
+							"shapes": map[string]interface{}{
+								"type":  []string{"array", "null"},
+								"items": map[string]interface{}{"$ref": "#/$defs/atlas.tSchemaShape"},
+							},
+							"labels": map[string]interface{}{"$ref": "#/$defs/map[string]string"},
+							"parent": map[string]interface{}{"anyOf": []interface{}{
+								map[string]interface{}{"$ref": "#/$defs/atlas.tSchemaDoc"},
+								map[string]interface{}{"type": "null"},
+							}},
+							"when": map[string]interface{}{"$ref": "#/$defs/atlas.tObjStr"},
+							"raw":  map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"},
+							"note": map[string]interface{}{"type": "string"},
+						},
+						"required":             []string{"name", "color", "shapes", "labels", "when"},
+						"additionalProperties": false,
+					},
+					"atlas.tSchemaColor": map[string]interface{}{
+						"type": "string",
+						"enum": []interface{}{"blue", "red"},
+					},
+					"atlas.tSchemaShape": map[string]interface{}{"oneOf": []interface{}{
+						map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{"circle": map[string]interface{}{
+								"type":                 "object",
+								"properties":           map[string]interface{}{"r": map[string]interface{}{"type": "number"}},
+								"required":             []string{"r"},
+								"additionalProperties": false,
+							}},
+							"required":             []string{"circle"},
+							"additionalProperties": false,
+						},
+						map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{"square": map[string]interface{}{
+								"type":                 "object",
+								"properties":           map[string]interface{}{"side": map[string]interface{}{"type": "integer"}},
+								"required":             []string{"side"},
+								"additionalProperties": false,
+								"x-cbor-tag":           7,
+							}},
+							"required":             []string{"square"},
+							"additionalProperties": false,
+						},
+					}},
+					"map[string]string": map[string]interface{}{
+						"type":                 []string{"object", "null"},
+						"additionalProperties": map[string]interface{}{"type": "string"},
+					},
+					"atlas.tObjStr": map[string]interface{}{"type": "string", "x-cbor-tag": 42},
+				},
+			})
+		})
+		Convey("kinded unions, int enums, and types without entries", func() {
+			atl := MustBuild(
+				BuildEntry((*tUnion)(nil)).KindedUnion().Of(map[tok.TokenType]*AtlasEntry{
+					tok.TMapOpen: BuildEntry(tUnionMemberA{}).StructMap().Autogenerate().Complete(),
+				}),
+				BuildEntry(tSchemaColor(0)).Enum().
+					AddMember(tSchemaColor(2), 20).
+					AddMember(tSchemaColor(1), 10).
+					Complete(),
+			)
+			doc, err := atl.JSONSchema(reflect.TypeOf(map[string]*[2]tUnion{}))
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, map[string]interface{}{
+				"$schema": jsonSchemaDialect,
+				"type":    []string{"object", "null"},
+				"additionalProperties": map[string]interface{}{
+					"type":     []string{"array", "null"},
+					"items":    map[string]interface{}{"$ref": "#/$defs/atlas.tUnion"},
+					"minItems": 2,
+					"maxItems": 2,
+				},
+				"$defs": map[string]interface{}{
+					"atlas.tUnion": map[string]interface{}{"anyOf": []interface{}{
+						map[string]interface{}{
+							"type":                 "object",
+							"properties":           map[string]interface{}{"x": map[string]interface{}{"type": "string"}},
+							"required":             []string{"x"},
+							"additionalProperties": false,
+						},
+					}},
+				},
+			})
+
+			doc, err = atl.JSONSchema(reflect.TypeOf([]*tSchemaColor{}))
+			So(err, ShouldBeNil)
+			So(doc["items"], ShouldResemble, map[string]interface{}{"anyOf": []interface{}{
+				map[string]interface{}{"$ref": "#/$defs/atlas.tSchemaColor"},
+				map[string]interface{}{"type": "null"},
+			}})
+			So(doc["$defs"], ShouldResemble, map[string]interface{}{
+				"atlas.tSchemaColor": map[string]interface{}{
+					"type": "integer",
+					"enum": []interface{}{int64(10), int64(20)},
+				},
+			})
+
+			doc, err = atl.JSONSchema(reflect.TypeOf([]interface{}{}))
+			So(err, ShouldBeNil)
+			So(doc, ShouldResemble, map[string]interface{}{
+				"$schema": jsonSchemaDialect,
+				"type":    []string{"array", "null"},
+				"items":   map[string]interface{}{},
+			})
+		})
+		Convey("types the atlas can't marshal are an error", func() {
+			_, err := MustBuild().JSONSchema(reflect.TypeOf(tObjNested{}))
+			So(err.Error(), ShouldEqual, "missing an atlas entry describing how to handle type atlas.tObjNested")
+			_, err = MustBuild().JSONSchema(reflect.TypeOf(map[string]func(){}))
+			So(err.Error(), ShouldEqual, "type func() is of kind func, which cannot be serialized")
+		})
+	})
+}
@@ -0,0 +1,30 @@
+package atlas
+
+import (
+	"reflect"
+)
+
+var nativeTypes func(rt reflect.Type) (schema map[string]interface{}, ok bool)
+
+/*
+	RegisterNativeTypes is how the obj package (which we can't import from
+	here) tells this package which types it handles without an atlas entry:
+	its own types (like obj.OrderedMap), raw tokens, and types with methods
+	it uses (like encoding.TextMarshaler).  The obj package calls it when
+	it's initialized; there's no need to call it yourself.
+
+	For each type, fn returns whether obj handles it natively, and if so,
+	a JSON Schema of its serial form (or nil, if that's just the usual one
+	for its kind).  `atlas.Build` uses this so such types don't need entries,
+	and `Atlas.JSONSchema` uses it so it describes them as they're marshalled.
+*/
+func RegisterNativeTypes(fn func(rt reflect.Type) (schema map[string]interface{}, ok bool)) {
+	nativeTypes = fn
+}
+
+func nativeType(rt reflect.Type) (schema map[string]interface{}, ok bool) {
+	if nativeTypes == nil {
+		return nil, false
+	}
+	return nativeTypes(rt)
+}
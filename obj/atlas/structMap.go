@@ -28,6 +28,15 @@ type StructMapEntry struct {
 
 	// If true, marshalling will skip this field if it's the zero value.
 	OmitEmpty bool
+
+	// If true, the field is keyed by the integer SerialInt instead of by a string.
+	// Marshalling will emit an int token for the key (handy for compact cbor,
+	// e.g. COSE and CWT structures), and unmarshalling will accept int keys
+	// as well as their decimal string form (which is what json will use).
+	// SerialName is still expected to hold that decimal string form;
+	// the builder and the autogenerator fill it in.
+	KeyAsInt  bool
+	SerialInt int64
 }
 
 type ReflectRoute []int
@@ -1,9 +1,12 @@
 package atlas
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -81,13 +84,19 @@ func exploreFields(rt reflect.Type, tagName string, sorter KeySortMode) []Struct
 					if name == "" {
 						name = downcaseFirstLetter(sf.Name)
 					}
-					fields = append(fields, StructMapEntry{
+					fieldEntry := StructMapEntry{
 						SerialName:   name,
 						ReflectRoute: route,
 						Type:         sf.Type,
 						tagged:       tagged,
 						OmitEmpty:    opts.Contains("omitempty"),
-					})
+					}
+					if opts.Contains("keyasint") {
+						// If the name doesn't parse, validation in atlas.Build will tell.
+						fieldEntry.KeyAsInt = true
+						fieldEntry.SerialInt, _ = strconv.ParseInt(name, 10, 64)
+					}
+					fields = append(fields, fieldEntry)
 					if count[f.Type] > 1 {
 						// If there were multiple instances, add a second,
 						// so that the annihilation code will see a duplicate.
@@ -231,19 +240,55 @@ func (x StructMapEntry_byName) Less(i, j int) bool {
 }
 
 // StructMapEntry_RFC7049 sorts fields as specified in RFC7049,
+// (which is to say, by the length and then the bytes of their cbor encoding;
+// this matters when some fields are KeyAsInt).
 type StructMapEntry_RFC7049 []StructMapEntry
 
 func (x StructMapEntry_RFC7049) Len() int      { return len(x) }
 func (x StructMapEntry_RFC7049) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
 func (x StructMapEntry_RFC7049) Less(i, j int) bool {
-	il, jl := len(x[i].SerialName), len(x[j].SerialName)
+	if !x[i].KeyAsInt && !x[j].KeyAsInt {
+		il, jl := len(x[i].SerialName), len(x[j].SerialName)
+		switch {
+		case il < jl:
+			return true
+		case il > jl:
+			return false
+		default:
+			return x[i].SerialName < x[j].SerialName
+		}
+	}
+	ib, jb := x[i].cborKey(), x[j].cborKey()
+	if len(ib) != len(jb) {
+		return len(ib) < len(jb)
+	}
+	return bytes.Compare(ib, jb) < 0
+}
+
+// cborKey returns the canonical cbor encoding of the field's key.
+func (x StructMapEntry) cborKey() []byte {
+	if !x.KeyAsInt {
+		return append(cborHead(3, uint64(len(x.SerialName))), x.SerialName...)
+	}
+	if x.SerialInt < 0 {
+		return cborHead(1, uint64(-1-x.SerialInt))
+	}
+	return cborHead(0, uint64(x.SerialInt))
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	major <<= 5
 	switch {
-	case il < jl:
-		return true
-	case il > jl:
-		return false
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= math.MaxUint8:
+		return []byte{major | 24, byte(arg)}
+	case arg <= math.MaxUint16:
+		return []byte{major | 25, byte(arg >> 8), byte(arg)}
+	case arg <= math.MaxUint32:
+		return []byte{major | 26, byte(arg >> 24), byte(arg >> 16), byte(arg >> 8), byte(arg)}
 	default:
-		return x[i].SerialName < x[j].SerialName
+		return []byte{major | 27, byte(arg >> 56), byte(arg >> 48), byte(arg >> 40), byte(arg >> 32), byte(arg >> 24), byte(arg >> 16), byte(arg >> 8), byte(arg)}
 	}
 }
 
@@ -3,6 +3,7 @@ package atlas
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -36,6 +37,9 @@ func (x *BuilderStructMap) Complete() *AtlasEntry {
 	`AddField("Y.Z", {"z", ...})` will cause that *nested* field to be serialized
 	as key "z" in the same object (e.g. "x" and "z" will be siblings).
 
+	If the mapping is KeyAsInt, the SerialName may be left blank,
+	and will be filled in from the SerialInt.
+
 	Returns the mutated builder for convenient call chaining.
 
 	If the fieldName string doesn't map onto the structure type info,
@@ -49,6 +53,9 @@ func (x *BuilderStructMap) AddField(fieldName string, mapping StructMapEntry) *B
 	}
 	mapping.ReflectRoute = rr
 	mapping.Type = rt
+	if mapping.KeyAsInt && mapping.SerialName == "" {
+		mapping.SerialName = strconv.FormatInt(mapping.SerialInt, 10)
+	}
 	x.entry.StructMap.Fields = append(x.entry.StructMap.Fields, mapping)
 	return x
 }
@@ -18,13 +18,41 @@ func (x *BuilderTransform) Complete() *AtlasEntry {
 }
 
 func (x *BuilderTransform) TransformMarshal(trFunc MarshalTransformFunc, toType reflect.Type) *BuilderTransform {
+	return x.transformMarshal(trFunc, transformInfo{target: toType})
+}
+
+func (x *BuilderTransform) TransformUnmarshal(trFunc UnmarshalTransformFunc, toType reflect.Type) *BuilderTransform {
+	return x.transformUnmarshal(trFunc, transformInfo{target: toType})
+}
+
+/*
+	Like `TransformMarshal(MakeMarshalTransformFunc(fn))`, but `atlas.Build`
+	also gets to check that fn takes the entry's type,
+	and says what's wrong with fn if it isn't a usable transform func.
+*/
+func (x *BuilderTransform) TransformMarshalFunc(fn interface{}) *BuilderTransform {
+	return x.transformMarshal(makeMarshalTransformFunc(fn))
+}
+
+/*
+	Like `TransformUnmarshal(MakeUnmarshalTransformFunc(fn))`, but `atlas.Build`
+	also gets to check that fn yields the entry's type,
+	and says what's wrong with fn if it isn't a usable transform func.
+*/
+func (x *BuilderTransform) TransformUnmarshalFunc(fn interface{}) *BuilderTransform {
+	return x.transformUnmarshal(makeUnmarshalTransformFunc(fn))
+}
+
+func (x *BuilderTransform) transformMarshal(trFunc MarshalTransformFunc, info transformInfo) *BuilderTransform {
 	x.entry.MarshalTransformFunc = trFunc
-	x.entry.MarshalTransformTargetType = toType
+	x.entry.MarshalTransformTargetType = info.target
+	x.entry.marshalTransformLiveType, x.entry.marshalTransformErr = info.live, info.err
 	return x
 }
 
-func (x *BuilderTransform) TransformUnmarshal(trFunc UnmarshalTransformFunc, toType reflect.Type) *BuilderTransform {
+func (x *BuilderTransform) transformUnmarshal(trFunc UnmarshalTransformFunc, info transformInfo) *BuilderTransform {
 	x.entry.UnmarshalTransformFunc = trFunc
-	x.entry.UnmarshalTransformTargetType = toType
+	x.entry.UnmarshalTransformTargetType = info.target
+	x.entry.unmarshalTransformLiveType, x.entry.unmarshalTransformErr = info.live, info.err
 	return x
 }
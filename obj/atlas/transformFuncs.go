@@ -1,6 +1,9 @@
 package atlas
 
-import "reflect"
+import (
+	"fmt"
+	"reflect"
+)
 
 type MarshalTransformFunc func(liveForm reflect.Value) (serialForm reflect.Value, err error)
 type UnmarshalTransformFunc func(serialForm reflect.Value) (liveForm reflect.Value, err error)
@@ -10,59 +13,104 @@ var err_rt = reflect.TypeOf((*error)(nil)).Elem()
 /*
 	Takes a wildcard object which must be `func (live T1) (serialable T2, error)`
 	and returns a MarshalTransformFunc and the typeinfo of T2.
+
+	If the wildcard object is not a function of that form, the typeinfo
+	returned is nil, and the MarshalTransformFunc will return an
+	ErrInvalidTransformFunc describing the problem.
+	Building an atlas with an entry using this func will return an error.
+
+	`BuilderTransform.TransformMarshalFunc` does this for you, and also lets
+	`atlas.Build` describe the problem, and check T1 against the entry's type.
 */
 func MakeMarshalTransformFunc(fn interface{}) (MarshalTransformFunc, reflect.Type) {
+	trFunc, info := makeMarshalTransformFunc(fn)
+	return trFunc, info.target
+}
+
+func makeMarshalTransformFunc(fn interface{}) (MarshalTransformFunc, transformInfo) {
 	fn_rv := reflect.ValueOf(fn)
-	if fn_rv.Kind() != reflect.Func {
-		panic("no")
+	if err := checkTransformFunc(fn_rv); err != nil {
+		return func(reflect.Value) (reflect.Value, error) { return reflect.Value{}, err }, transformInfo{err: err}
 	}
 	fn_rt := fn_rv.Type()
-	if fn_rt.NumIn() != 1 {
-		panic("no")
-	}
-	if fn_rt.NumOut() != 2 {
-		panic("no")
-	}
-	if !fn_rt.Out(1).AssignableTo(err_rt) {
-		panic("no")
-	}
-	// nothing to do for `fn_rt.In(0)` -- whatever type it is... TODO redesign to make less sketchy; we should most certainly be able to check this in the builder
+	in_rt := fn_rt.In(0)
 	out_rt := fn_rt.Out(0)
 	return func(liveForm reflect.Value) (serialForm reflect.Value, err error) {
+		if !liveForm.IsValid() || !liveForm.Type().AssignableTo(in_rt) {
+			return reflect.Value{}, fmt.Errorf("marshal transform func %v cannot accept a value of type %v", fn_rt, typeOfValue(liveForm))
+		}
 		results := fn_rv.Call([]reflect.Value{liveForm})
 		if results[1].IsNil() {
 			return results[0], nil
 		}
 		return results[0], results[1].Interface().(error)
-	}, out_rt
+	}, transformInfo{out_rt, in_rt, nil}
 }
 
 /*
 	Takes a wildcard object which must be `func (serialable T1) (live T2, error)`
 	and returns a UnmarshalTransformFunc and the typeinfo of T1.
+
+	If the wildcard object is not a function of that form, the typeinfo
+	returned is nil, and the UnmarshalTransformFunc will return an
+	ErrInvalidTransformFunc describing the problem.
+	Building an atlas with an entry using this func will return an error.
+
+	`BuilderTransform.TransformUnmarshalFunc` does this for you, and also lets
+	`atlas.Build` describe the problem, and check T2 against the entry's type.
 */
 func MakeUnmarshalTransformFunc(fn interface{}) (UnmarshalTransformFunc, reflect.Type) {
+	trFunc, info := makeUnmarshalTransformFunc(fn)
+	return trFunc, info.target
+}
+
+func makeUnmarshalTransformFunc(fn interface{}) (UnmarshalTransformFunc, transformInfo) {
 	fn_rv := reflect.ValueOf(fn)
+	if err := checkTransformFunc(fn_rv); err != nil {
+		return func(reflect.Value) (reflect.Value, error) { return reflect.Value{}, err }, transformInfo{err: err}
+	}
+	// We don't know what entry we're about to be used for, so checking `fn_rt.Out(0)` against it is up to `atlas.Build`.
+	in_rt := fn_rv.Type().In(0)
+	out_rt := fn_rv.Type().Out(0)
+	return func(serialForm reflect.Value) (liveForm reflect.Value, err error) {
+		results := fn_rv.Call([]reflect.Value{serialForm})
+		if results[1].IsNil() {
+			return results[0], nil
+		}
+		return results[0], results[1].Interface().(error)
+	}, transformInfo{in_rt, out_rt, nil}
+}
+
+// What making a transform func from a wildcard object found out about it.
+// The transform builder records this in the entry, so `atlas.Build` can
+// check it without calling the func.
+type transformInfo struct {
+	target reflect.Type // nil if err is set.
+	live   reflect.Type // the type the marshal func takes, or the unmarshal func yields.
+	err    error
+}
+
+func checkTransformFunc(fn_rv reflect.Value) error {
 	if fn_rv.Kind() != reflect.Func {
-		panic("no")
+		return ErrInvalidTransformFunc{fmt.Sprint(typeOfValue(fn_rv)), "not a function"}
 	}
 	fn_rt := fn_rv.Type()
 	if fn_rt.NumIn() != 1 {
-		panic("no")
+		return ErrInvalidTransformFunc{fn_rt.String(), "must take exactly one parameter"}
 	}
 	if fn_rt.NumOut() != 2 {
-		panic("no")
+		return ErrInvalidTransformFunc{fn_rt.String(), "must return exactly two values"}
 	}
 	if !fn_rt.Out(1).AssignableTo(err_rt) {
-		panic("no")
+		return ErrInvalidTransformFunc{fn_rt.String(), "second return value must be an error"}
 	}
-	// nothing to do for checking `fn_rf.Out(0)` -- because we don't know what entry we're about to be used for.  TODO redesign to make less sketchy.
-	in_rt := fn_rt.In(0)
-	return func(serialForm reflect.Value) (liveForm reflect.Value, err error) {
-		results := fn_rv.Call([]reflect.Value{serialForm})
-		if results[1].IsNil() {
-			return results[0], nil
-		}
-		return results[0], results[1].Interface().(error)
-	}, in_rt
+	return nil
+}
+
+// Like `rv.Type()`, but doesn't panic on the zero value.
+func typeOfValue(rv reflect.Value) reflect.Type {
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Type()
 }
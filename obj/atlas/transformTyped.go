@@ -0,0 +1,92 @@
+package atlas
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+	Like `BuildEntry`, but takes the type as a type parameter rather than
+	from a dummy object.  This also works directly for interface types:
+
+		atlas.BuildEntryFor[MyUnion]().KeyedUnion()...
+
+	is equivalent to `atlas.BuildEntry((*MyUnion)(nil)).KeyedUnion()...`.
+*/
+func BuildEntryFor[T any]() *BuilderCore {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() == reflect.Ptr {
+		panic("invalid atlas build: use the bare type, not a pointer (refmt will handle pointers automatically)")
+	}
+	return &BuilderCore{
+		&AtlasEntry{Type: rt},
+	}
+}
+
+/*
+	Build a complete AtlasEntry for the `Live` type which transforms it
+	to the `Serial` type during marshal, and back again during unmarshal.
+
+	This is equivalent to using `BuildEntry(...).Transform()` with
+	`MakeMarshalTransformFunc` and `MakeUnmarshalTransformFunc`, except the
+	types of the funcs are checked at compile time, and calling them
+	does not go through `reflect.Value.Call`.
+
+	Either func may be nil if the transform is only needed in one direction.
+	(Further settings, like tags, may be set on the returned entry.)
+*/
+func TransformEntry[Live any, Serial any](
+	marshal func(Live) (Serial, error),
+	unmarshal func(Serial) (Live, error),
+) *AtlasEntry {
+	x := BuildEntryFor[Live]().Transform()
+	if marshal != nil {
+		x.TransformMarshal(MakeTypedMarshalTransformFunc(marshal))
+	}
+	if unmarshal != nil {
+		x.TransformUnmarshal(MakeTypedUnmarshalTransformFunc(unmarshal))
+	}
+	return x.Complete()
+}
+
+/*
+	Like `MakeMarshalTransformFunc`, but with compile-time type checking,
+	and the func is called directly rather than via reflection.
+*/
+func MakeTypedMarshalTransformFunc[Live any, Serial any](fn func(Live) (Serial, error)) (MarshalTransformFunc, reflect.Type) {
+	return func(liveForm reflect.Value) (serialForm reflect.Value, err error) {
+		if !liveForm.IsValid() {
+			return reflect.Value{}, fmt.Errorf("marshal transform func %T cannot accept an invalid value", fn)
+		}
+		// A nil interface fails the type assertion, but that's fine; it's the zero value of Live.
+		live, ok := liveForm.Interface().(Live)
+		if !ok && !isNilInterface(liveForm) {
+			return reflect.Value{}, fmt.Errorf("marshal transform func %T cannot accept a value of type %v", fn, liveForm.Type())
+		}
+		serial, err := fn(live)
+		// Take the addr and deref, rather than just `ValueOf(serial)`: if Serial is an interface type, this keeps it.
+		return reflect.ValueOf(&serial).Elem(), err
+	}, reflect.TypeOf((*Serial)(nil)).Elem()
+}
+
+/*
+	Like `MakeUnmarshalTransformFunc`, but with compile-time type checking,
+	and the func is called directly rather than via reflection.
+*/
+func MakeTypedUnmarshalTransformFunc[Serial any, Live any](fn func(Serial) (Live, error)) (UnmarshalTransformFunc, reflect.Type) {
+	return func(serialForm reflect.Value) (liveForm reflect.Value, err error) {
+		if !serialForm.IsValid() {
+			return reflect.Value{}, fmt.Errorf("unmarshal transform func %T cannot accept an invalid value", fn)
+		}
+		serial, ok := serialForm.Interface().(Serial)
+		if !ok && !isNilInterface(serialForm) {
+			return reflect.Value{}, fmt.Errorf("unmarshal transform func %T cannot accept a value of type %v", fn, serialForm.Type())
+		}
+		live, err := fn(serial)
+		return reflect.ValueOf(&live).Elem(), err
+	}, reflect.TypeOf((*Serial)(nil)).Elem()
+}
+
+func isNilInterface(rv reflect.Value) bool {
+	return rv.Kind() == reflect.Interface && rv.IsNil()
+}
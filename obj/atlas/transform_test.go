@@ -1,6 +1,7 @@
 package atlas
 
 import (
+	"reflect"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -29,3 +30,45 @@ func TestTransformBuilder(t *testing.T) {
 		})
 	})
 }
+
+func TestTypedTransformBuilder(t *testing.T) {
+	Convey("Building atlases using typed transforms:", t, func() {
+		entry := TransformEntry(
+			func(x tObjStr) (string, error) {
+				return x.X, nil
+			},
+			func(x string) (tObjStr, error) {
+				return tObjStr{x}, nil
+			},
+		)
+		Convey("string->struct->string happy path should build without error", func() {
+			_, err := Build(entry)
+			So(err, ShouldBeNil)
+		})
+		Convey("the entry should have types filled in", func() {
+			So(entry.Type, ShouldEqual, reflect.TypeOf(tObjStr{}))
+			So(entry.MarshalTransformTargetType, ShouldEqual, reflect.TypeOf(""))
+			So(entry.UnmarshalTransformTargetType, ShouldEqual, reflect.TypeOf(""))
+		})
+		Convey("the funcs should work on reflect values", func() {
+			serial_rv, err := entry.MarshalTransformFunc(reflect.ValueOf(tObjStr{"x"}))
+			So(err, ShouldBeNil)
+			So(serial_rv.Interface(), ShouldEqual, "x")
+			live_rv, err := entry.UnmarshalTransformFunc(reflect.ValueOf("y"))
+			So(err, ShouldBeNil)
+			So(live_rv.Interface(), ShouldResemble, tObjStr{"y"})
+		})
+		Convey("the funcs should reject values of the wrong type, even zero ones", func() {
+			_, err := entry.MarshalTransformFunc(reflect.ValueOf(""))
+			So(err.Error(), ShouldEqual, "marshal transform func func(atlas.tObjStr) (string, error) cannot accept a value of type string")
+			_, err = entry.UnmarshalTransformFunc(reflect.ValueOf(0))
+			So(err.Error(), ShouldEqual, "unmarshal transform func func(string) (atlas.tObjStr, error) cannot accept a value of type int")
+		})
+		Convey("the funcs should take a nil interface as the zero value", func() {
+			var x interface{}
+			serial_rv, err := entry.MarshalTransformFunc(reflect.ValueOf(&x).Elem())
+			So(err, ShouldBeNil)
+			So(serial_rv.Interface(), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,159 @@
+package atlas
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/polydawn/refmt/tok"
+)
+
+/*
+	UnionKindedMorphism picks a concrete type to fill an interface based on
+	the kind of the first token of the serial value -- e.g. a string token
+	might unmarshal into a typedef'd string, while a map open token
+	unmarshals into a struct with the full-length form of the same info.
+
+	Unlike the keyed union, no wrapping map is emitted or expected:
+	the serial form is exactly the serial form of the member.
+*/
+type UnionKindedMorphism struct {
+	// Mapping of token types to atlasEntry that should be delegated to.
+	Elements map[tok.TokenType]*AtlasEntry
+	// Mapping of rtid to atlasEntry (roughly the dual of the Elements map).
+	Mappings map[uintptr]*AtlasEntry
+	// Purely to have in readiness for error messaging.
+	KnownMembers []string
+}
+
+func (x *BuilderCore) KindedUnion() *BuilderUnionKindedMorphism {
+	if x.entry.Type.Kind() != reflect.Interface {
+		panic(fmt.Errorf("cannot use union morphisms for type %q, which is kind %s", x.entry.Type, x.entry.Type.Kind()))
+	}
+	x.entry.UnionKindedMorphism = &UnionKindedMorphism{
+		Elements: make(map[tok.TokenType]*AtlasEntry),
+		Mappings: make(map[uintptr]*AtlasEntry),
+	}
+	return &BuilderUnionKindedMorphism{x.entry}
+}
+
+type BuilderUnionKindedMorphism struct {
+	entry *AtlasEntry
+}
+
+/*
+	Declare the members of the union, keyed by the type of token which
+	will select them during unmarshal.
+
+	Members which need no special handling (e.g. a plain or typedef'd string)
+	may be declared with `atlas.BuildEntry(x).Complete()`.
+	The same entry may be used for more than one token type (e.g. both
+	`tok.TInt` and `tok.TUint`); a token of `tok.TUint` will also fall back
+	to the `tok.TInt` member (and vice versa for non-negative ints) if only
+	one of them is declared.
+
+	Consistency of the members with the token types is checked when the
+	entry is used in `atlas.Build`.
+*/
+func (x *BuilderUnionKindedMorphism) Of(elements map[tok.TokenType]*AtlasEntry) *AtlasEntry {
+	cfg := x.entry.UnionKindedMorphism
+	for tt, ent := range elements {
+		cfg.Elements[tt] = ent
+		// Members missing type info are reported by `atlas.Build`, not here.
+		if ent != nil && ent.Type != nil {
+			cfg.Mappings[reflect.ValueOf(ent.Type).Pointer()] = ent
+		}
+		cfg.KnownMembers = append(cfg.KnownMembers, tt.String())
+	}
+	sort.Strings(cfg.KnownMembers)
+	return x.entry
+}
+
+// Check that no two token types are mapped to different entries of the same
+// type, and that each member can plausibly produce and accept the token
+// it's keyed by.  (The members are checked individually by the atlas.)
+func (x *UnionKindedMorphism) validate() error {
+	seen := make(map[uintptr]*AtlasEntry, len(x.Elements))
+	for tt, ent := range x.Elements {
+		rtid := reflect.ValueOf(ent.Type).Pointer()
+		if prev, exists := seen[rtid]; exists && prev != ent {
+			return fmt.Errorf("member type %v is used by more than one entry, so marshalling would be ambiguous", ent.Type)
+		}
+		seen[rtid] = ent
+		if !tokenTypeFitsEntry(tt, ent) {
+			return fmt.Errorf("member type %v cannot be used for %s tokens", ent.Type, tt)
+		}
+	}
+	return nil
+}
+
+// Returns true if the entry can plausibly be marshalled to and unmarshalled
+// from a value starting with the given token type.
+// If the entry has transforms, the transform target types are inspected
+// instead of the entry's own type.
+func tokenTypeFitsEntry(tt tok.TokenType, ent *AtlasEntry) bool {
+	marshal_rt, unmarshal_rt := ent.Type, ent.Type
+	if ent.MarshalTransformTargetType != nil {
+		marshal_rt = ent.MarshalTransformTargetType
+	}
+	if ent.UnmarshalTransformTargetType != nil {
+		unmarshal_rt = ent.UnmarshalTransformTargetType
+	}
+	if ent.UnionKeyedMorphism != nil && tt == tok.TMapOpen {
+		return true
+	}
+	if ent.EnumMorphism != nil {
+		switch tt {
+		case tok.TInt, tok.TUint:
+			return ent.EnumMorphism.SerialType == tok.TInt
+		default:
+			return ent.EnumMorphism.SerialType == tt
+		}
+	}
+	return tokenTypeFitsKind(tt, marshal_rt) && tokenTypeFitsKind(tt, unmarshal_rt)
+}
+
+func tokenTypeFitsKind(tt tok.TokenType, rt reflect.Type) bool {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch tt {
+	case tok.TString:
+		return rt.Kind() == reflect.String
+	case tok.TBytes:
+		switch rt.Kind() {
+		case reflect.Slice, reflect.Array:
+			return rt.Elem().Kind() == reflect.Uint8
+		}
+		return false
+	case tok.TBool:
+		return rt.Kind() == reflect.Bool
+	case tok.TInt, tok.TUint:
+		switch rt.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return true
+		}
+		return false
+	case tok.TFloat64:
+		switch rt.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return true
+		}
+		return false
+	case tok.TMapOpen:
+		switch rt.Kind() {
+		case reflect.Struct, reflect.Map:
+			return true
+		}
+		return false
+	case tok.TArrOpen:
+		switch rt.Kind() {
+		case reflect.Slice, reflect.Array:
+			return rt.Elem().Kind() != reflect.Uint8
+		}
+		return false
+	default:
+		return false
+	}
+}
@@ -33,11 +33,11 @@ type BuilderUnionKeyedMorphism struct {
 func (x *BuilderUnionKeyedMorphism) Of(elements map[string]*AtlasEntry) *AtlasEntry {
 	cfg := x.entry.UnionKeyedMorphism
 	for hint, ent := range elements {
-		// FIXME: check that all the delegates are... well struct or map machines really, but definitely blacklisting other delegating machinery.
-		// FIXME: and sanity check that they can all be assigned to the interface ffs.
-
+		// Members are checked for sanity (assignable to the interface, not further unions, etc) during `atlas.Build`.
 		cfg.Elements[hint] = ent
-		cfg.Mappings[reflect.ValueOf(ent.Type).Pointer()] = hint
+		if ent != nil && ent.Type != nil {
+			cfg.Mappings[reflect.ValueOf(ent.Type).Pointer()] = hint
+		}
 		cfg.KnownMembers = append(cfg.KnownMembers, hint)
 	}
 	sort.Strings(cfg.KnownMembers)
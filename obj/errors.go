@@ -10,6 +10,19 @@ import (
 // General note: avoid using reflect.Type here.  It doesn't do well with `go-cmp`,
 //  which in turn makes our tests for error paths a lot jankier.
 
+// ErrMarshalCycle is the error returned when marshalling a value which
+// contains itself (e.g. a pointer cycle).  The paths are JSON Pointers.
+// (Cycles of pointers can be marshalled with MarshalOptions.ValueSharing.)
+type ErrMarshalCycle struct {
+	Path         string // Where the value was reached again.
+	AncestorPath string // Where the value was first reached (and is still being marshalled).
+	Type         string // Type of the value.
+}
+
+func (e ErrMarshalCycle) Error() string {
+	return fmt.Sprintf("marshal error: cycle detected: %s at %q is already being marshalled at %q", e.Type, e.Path, e.AncestorPath)
+}
+
 // ErrInvalidUnmarshalTarget describes an invalid argument passed to Unmarshaller.Bind.
 // (Unmarshalling must target a non-nil pointer so that it can address the value.)
 type ErrInvalidUnmarshalTarget struct {
@@ -70,9 +83,10 @@ func (e ErrNoSuchField) Error() string {
 
 // ErrNoSuchUnionMember is the error returned when unmarshalling into a union
 // interface and the token stream contains a key which does not name any of the
-// known members of the union.
+// known members of the union (or for kinded unions, a token of a kind which
+// does not match any of the known members).
 type ErrNoSuchUnionMember struct {
-	Name         string       // Key name from the token.
+	Name         string       // Key name from the token (or for kinded unions, the token type).
 	Type         reflect.Type // The interface type we're trying to fill.
 	KnownMembers []string     // Members we expected isntead.
 }
@@ -80,3 +94,16 @@ type ErrNoSuchUnionMember struct {
 func (e ErrNoSuchUnionMember) Error() string {
 	return fmt.Sprintf("unmarshal error: cannot unmarshal into union %s: %q is not one of the known members (expected one of %s)", e.Type, e.Name, e.KnownMembers)
 }
+
+// ErrNoSuchEnumMember is the error returned when unmarshalling into a type
+// with an enum morphism and the token stream contains a value which is not
+// one of the known members of the enum (and the enum has no fallback member).
+type ErrNoSuchEnumMember struct {
+	Value        string       // Value from the token (ints are formatted in decimal).
+	Type         reflect.Type // The enum type we're trying to fill.
+	KnownMembers []string     // Members we expected instead.
+}
+
+func (e ErrNoSuchEnumMember) Error() string {
+	return fmt.Sprintf("unmarshal error: cannot unmarshal into enum %s: %q is not one of the known members (expected one of %s)", e.Type, e.Value, e.KnownMembers)
+}
@@ -0,0 +1,100 @@
+package obj
+
+import (
+	"encoding"
+	"reflect"
+	"sync"
+)
+
+/*
+	Marshaler is implemented by types that know how to describe themselves
+	as tokens.
+
+	Types without an atlas entry are checked for this interface (and failing
+	that, for encoding.TextMarshaler, and then encoding.BinaryMarshaler,
+	which produce a string or bytes token respectively).  An atlas entry for
+	the type takes precedence over all of them.
+*/
+type Marshaler interface {
+	MarshalRefmt() (RawTokens, error)
+}
+
+/*
+	Unmarshaler is implemented by types that know how to fill themselves in
+	from tokens.  UnmarshalRefmt receives the complete token subtree for the
+	value.
+
+	Types without an atlas entry are checked for this interface (and failing
+	that, for encoding.TextUnmarshaler, and then encoding.BinaryUnmarshaler,
+	which accept a string or bytes token respectively).  An atlas entry for
+	the type takes precedence over all of them.
+*/
+type Unmarshaler interface {
+	UnmarshalRefmt(RawTokens) error
+}
+
+type hookKind uint8
+
+const (
+	hookKind_none hookKind = iota
+	hookKind_refmt
+	hookKind_text
+	hookKind_binary
+)
+
+var (
+	rt_marshaler         = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	rt_unmarshaler       = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	rt_textMarshaler     = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	rt_textUnmarshaler   = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	rt_binaryMarshaler   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	rt_binaryUnmarshaler = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// Caches of hookKind by type.  (Checking method sets isn't free, and this happens for every type
+// that isn't a primitive or in the atlas, so we only want to do it once per type.)
+var marshalHookKinds, unmarshalHookKinds sync.Map
+
+// Which hook, if any, marshalling a value of this type should use.
+// Methods may be on the type or on the pointer to it.
+func marshalHookKindFor(rt reflect.Type) hookKind {
+	if hk, ok := marshalHookKinds.Load(rt); ok {
+		return hk.(hookKind)
+	}
+	hk := hookKindFor(rt, rt_marshaler, rt_textMarshaler, rt_binaryMarshaler)
+	marshalHookKinds.Store(rt, hk)
+	return hk
+}
+
+// Which hook, if any, unmarshalling into a value of this type should use.
+// Methods must be on the pointer to the type (as they always are for unmarshalling).
+func unmarshalHookKindFor(rt reflect.Type) hookKind {
+	if hk, ok := unmarshalHookKinds.Load(rt); ok {
+		return hk.(hookKind)
+	}
+	hk := hookKindFor(reflect.PtrTo(rt), rt_unmarshaler, rt_textUnmarshaler, rt_binaryUnmarshaler)
+	unmarshalHookKinds.Store(rt, hk)
+	return hk
+}
+
+func hookKindFor(rt reflect.Type, refmtIface, textIface, binaryIface reflect.Type) hookKind {
+	// Interfaces never use hooks themselves: the wildcard machines handle them,
+	//  and then look at whatever concrete type is in them (which might be nil).
+	if rt.Kind() == reflect.Interface || rt.Kind() == reflect.Ptr && rt.Elem().Kind() == reflect.Interface {
+		return hookKind_none
+	}
+	ptr_rt := rt
+	if rt.Kind() != reflect.Ptr {
+		ptr_rt = reflect.PtrTo(rt)
+	}
+	switch {
+	case rt.Implements(refmtIface) || ptr_rt.Implements(refmtIface):
+		return hookKind_refmt
+	case rt.Implements(textIface) || ptr_rt.Implements(textIface):
+		return hookKind_text
+	case rt.Implements(binaryIface) || ptr_rt.Implements(binaryIface):
+		return hookKind_binary
+	default:
+		return hookKind_none
+	}
+}
@@ -18,12 +18,23 @@ import (
 	again and making all of the machinery reusable without re-allocating.
 */
 func NewMarshaller(atl atlas.Atlas) *Marshaller {
+	return NewMarshallerWithOptions(atl, MarshalOptions{})
+}
+
+/*
+	Like NewMarshaller, but with options for the behaviors which the atlas
+	doesn't cover (such as value sharing).
+*/
+func NewMarshallerWithOptions(atl atlas.Atlas, opts MarshalOptions) *Marshaller {
 	d := &Marshaller{
 		marshalSlab: marshalSlab{
-			atlas: atl,
-			rows:  make([]marshalSlabRow, 0, 10),
+			atlas:     atl,
+			rows:      make([]marshalSlabRow, 0, 10),
+			canonical: opts.CanonicalKeyOrder,
 		},
 		stack: make([]MarshalMachine, 0, 10),
+		refs:  make([]marshalRef, 0, 10),
+		opts:  opts,
 	}
 	return d
 }
@@ -37,6 +48,17 @@ func (d *Marshaller) Bind(v interface{}) error {
 		rv = nil_rv
 	}
 	rt := rv.Type()
+	d.refs = d.refs[0:0]
+	d.stepRef = refOf(rv)
+	d.shared = nil
+	d.tagRoot = false
+	if d.opts.ValueSharing {
+		d.shared = make(map[marshalRef]int)
+		if d.stepRef.rt != nil && d.stepRef.rt.Kind() == reflect.Ptr {
+			d.shared[d.stepRef] = 0
+			d.tagRoot = true
+		}
+	}
 	d.step = d.marshalSlab.requisitionMachine(rt)
 	return d.step.Reset(&d.marshalSlab, rv, rt)
 }
@@ -45,6 +67,12 @@ type Marshaller struct {
 	marshalSlab marshalSlab
 	stack       []MarshalMachine
 	step        MarshalMachine
+	opts        MarshalOptions
+
+	refs    []marshalRef       // Identities of the values the machines in the stack are handling (for spotting cycles).
+	stepRef marshalRef         // Identity of the value the current step machine is handling.
+	shared  map[marshalRef]int // Indexes of the shareable values emitted so far (only if opts.ValueSharing).
+	tagRoot bool               // Set if the first token must be tagged shareable (only if opts.ValueSharing).
 }
 
 type MarshalMachine interface {
@@ -59,6 +87,10 @@ func (d *Marshaller) Step(tok *Token) (bool, error) {
 	//	fmt.Printf("> next step is %#v\n", d.step)
 	done, err := d.step.Step(d, &d.marshalSlab, tok)
 	//	fmt.Printf(">> yield is %#v\n", TokenToString(*tok))
+	if d.tagRoot && err == nil {
+		d.tagRoot = false
+		err = tagShareableToken(tok)
+	}
 	// If the step errored: out, entirely.
 	if err != nil {
 		return true, err
@@ -75,6 +107,8 @@ func (d *Marshaller) Step(tok *Token) (bool, error) {
 	//	fmt.Printf(">> popping up from %#v\n", d.stack)
 	d.step = d.stack[nSteps]
 	d.stack = d.stack[0:nSteps]
+	d.stepRef = d.refs[nSteps]
+	d.refs = d.refs[0:nSteps]
 	return false, nil
 }
 
@@ -93,18 +127,45 @@ func (d *Marshaller) Step(tok *Token) (bool, error) {
 	In other words, your MarshalMachine calls this when it wants to deal
 	with an object, and by the time we call back to your machine again,
 	that object will be traversed and the stream ready for you to continue.
+
+	This is also where cycles are caught: if the value is already being
+	marshalled by one of the machines on the stack, it's an error.
+	(Or with value sharing, a pointer we've seen before is emitted as
+	a reference, without recursing at all.)
 */
 func (d *Marshaller) Recurse(tok *Token, rv reflect.Value, rt reflect.Type, nextMach MarshalMachine) (err error) {
 	//	fmt.Printf(">>> pushing into recursion with %#v\n", nextMach)
+	ref := refOf(rv)
+	share := false
+	if ref.rt != nil {
+		if d.opts.ValueSharing && ref.rt.Kind() == reflect.Ptr {
+			if idx, ok := d.shared[ref]; ok {
+				tok.Type = TUint
+				tok.Uint = uint64(idx)
+				tok.Tagged = true
+				tok.Tag = tagSharedRef
+				return nil
+			}
+			d.shared[ref] = len(d.shared)
+			share = true
+		} else if err = d.checkCycle(ref); err != nil {
+			return
+		}
+	}
 	// Push the current machine onto the stack (we'll resume it when the new one is done),
 	d.stack = append(d.stack, d.step)
+	d.refs = append(d.refs, d.stepRef)
 	// Initialize the machine for this new target value.
 	err = nextMach.Reset(&d.marshalSlab, rv, rt)
 	if err != nil {
 		return
 	}
 	d.step = nextMach
+	d.stepRef = ref
 	// Immediately make a step (we're still the delegate in charge of someone else's step).
 	_, err = d.Step(tok)
+	if share && err == nil {
+		err = tagShareableToken(tok)
+	}
 	return
 }
@@ -0,0 +1,54 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+type marshalMachineArrayStream struct {
+	target    ArrayStream
+	valueMach MarshalMachine
+	started   bool
+	finished  bool
+	index     int // Count of elements emitted so far.
+}
+
+func (mach *marshalMachineArrayStream) Reset(slab *marshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.target = rv.Interface().(ArrayStream)
+	mach.valueMach = nil
+	if mach.target.next != nil {
+		mach.valueMach = slab.requisitionMachine(mach.target.elem_rt)
+	}
+	mach.started = false
+	mach.finished = false
+	mach.index = 0
+	return nil
+}
+
+func (mach *marshalMachineArrayStream) Step(driver *Marshaller, slab *marshalSlab, tok *Token) (done bool, err error) {
+	if mach.finished {
+		return true, fmt.Errorf("invalid state: value already consumed")
+	}
+	if !mach.started {
+		mach.started = true
+		if mach.target.next == nil {
+			tok.Type = TNull
+			mach.finished = true
+			return true, nil
+		}
+		tok.Type = TArrOpen
+		tok.Length = -1
+		return false, nil
+	}
+	rv, ok := mach.target.next()
+	if !ok {
+		tok.Type = TArrClose
+		mach.finished = true
+		slab.release()
+		return true, nil
+	}
+	mach.index++
+	return false, driver.Recurse(tok, rv, mach.target.elem_rt, mach.valueMach)
+}
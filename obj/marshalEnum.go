@@ -0,0 +1,38 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+type marshalMachineEnum struct {
+	cfg *atlas.AtlasEntry // set on initialization
+
+	serial interface{} // picked during reset.
+}
+
+func (mach *marshalMachineEnum) Reset(_ *marshalSlab, rv reflect.Value, _ reflect.Type) error {
+	serial, ok := mach.cfg.EnumMorphism.Serials[rv.Interface()]
+	if !ok {
+		return fmt.Errorf("value %v is not one of the known members of the enum for type %q", rv, mach.cfg.Type.Name())
+	}
+	mach.serial = serial
+	return nil
+}
+
+func (mach *marshalMachineEnum) Step(_ *Marshaller, _ *marshalSlab, tok *Token) (done bool, err error) {
+	switch serial := mach.serial.(type) {
+	case string:
+		tok.Type = TString
+		tok.Str = serial
+	case int64:
+		tok.Type = TInt
+		tok.Int = serial
+	}
+	tok.Tagged = mach.cfg.Tagged
+	tok.Tag = mach.cfg.Tag
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package obj
+
+import (
+	"encoding"
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	A MarshalMachine for types implementing Marshaler,
+	encoding.TextMarshaler, or encoding.BinaryMarshaler.
+
+	The hook is called during Reset, and the resulting tokens are emitted.
+*/
+type marshalMachineHooks struct {
+	kind hookKind // set on initialization
+
+	toks RawTokens
+	src  RawTokensSource
+}
+
+func (mach *marshalMachineHooks) Reset(_ *marshalSlab, rv reflect.Value, rt reflect.Type) error {
+	// The methods may be declared on the pointer; if we don't have an addressable value, make one.
+	var v interface{}
+	switch {
+	case rt.Implements(rt_marshaler), rt.Implements(rt_textMarshaler), rt.Implements(rt_binaryMarshaler):
+		v = rv.Interface()
+	case rv.CanAddr():
+		v = rv.Addr().Interface()
+	default:
+		ptr_rv := reflect.New(rt)
+		ptr_rv.Elem().Set(rv)
+		v = ptr_rv.Interface()
+	}
+
+	switch mach.kind {
+	case hookKind_refmt:
+		toks, err := v.(Marshaler).MarshalRefmt()
+		if err != nil {
+			return err
+		}
+		mach.src = RawTokensSource{toks, 0}
+	case hookKind_text:
+		text, err := v.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		mach.toks = append(mach.toks[:0], Token{Type: TString, Str: string(text)})
+		mach.src = RawTokensSource{mach.toks, 0}
+	case hookKind_binary:
+		bs, err := v.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		mach.toks = append(mach.toks[:0], Token{Type: TBytes, Bytes: bs})
+		mach.src = RawTokensSource{mach.toks, 0}
+	}
+	return nil
+}
+
+func (mach *marshalMachineHooks) Step(_ *Marshaller, _ *marshalSlab, tok *Token) (done bool, err error) {
+	return mach.src.Step(tok)
+}
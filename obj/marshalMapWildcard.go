@@ -1,9 +1,11 @@
 package obj
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
 
 	"github.com/polydawn/refmt/obj/atlas"
 	. "github.com/polydawn/refmt/tok"
@@ -12,13 +14,14 @@ import (
 type marshalMachineMapWildcard struct {
 	morphism *atlas.MapMorphism // set on initialization
 
-	target_rv   reflect.Value
-	value_rt    reflect.Type
-	keyStringer atlas.MarshalTransformFunc
-	valueMach   MarshalMachine
-	keys        []wildcardMapStringyKey
-	index       int
-	value       bool
+	target_rv      reflect.Value
+	value_rt       reflect.Type
+	keyTransformer atlas.MarshalTransformFunc
+	keyEnum        *atlas.EnumMorphism
+	valueMach      MarshalMachine
+	keys           []wildcardMapKey
+	index          int
+	value          bool
 }
 
 func (mach *marshalMachineMapWildcard) Reset(slab *marshalSlab, rv reflect.Value, rt reflect.Type) error {
@@ -29,42 +32,59 @@ func (mach *marshalMachineMapWildcard) Reset(slab *marshalSlab, rv reflect.Value
 	mach.valueMach = slab.requisitionMachine(mach.value_rt)
 
 	// Enumerate all the keys (must do this up front, one way or another),
-	// flip them into strings,
+	// flip them into their token form,
 	// and sort them (optional, arguably, but right now you're getting it).
+	//
+	// Keys may be strings, ints, uints, or bools (which become tokens of
+	// the same kind; the json encoder stringifies them); or, any type with
+	// an atlas entry that transforms it into one of those kinds
+	// (composite keys require some fancy footwork, but we can do it:
+	// because the tokenized form is restricted to being a single token,
+	// the transform func is enough, and we don't need full-on machinery).
 	key_rt := rt.Key()
-	switch key_rt.Kind() {
-	case reflect.String:
-		// continue.
-		// note: stdlib json.marshal supports all the int types here as well, and will
-		//  tostring them.  but this is not supported symmetrically; so we simply... don't.
-		//  we could also consider supporting anything that uses a MarshalTransformFunc
-		//  to become a string kind; that's a fair bit of code, perhaps later.
-		mach.keyStringer = nil
-	case reflect.Struct:
-		// composite keys requires some fancy footwork, but we can do it.
-		// Interestingly enough, we don't need full-on machinery here; because the
-		//  tokenized form is restricted to being a string, the transform func is enough.
-		rtid := reflect.ValueOf(key_rt).Pointer()
-		atlEnt, ok := slab.atlas.Get(rtid)
-		if !ok || atlEnt.MarshalTransformTargetType == nil || atlEnt.MarshalTransformTargetType.Kind() != reflect.String {
-			return fmt.Errorf("unsupported map key type %q (if you want to use struct keys, your atlas needs a transform to string)", key_rt.Name())
+	mach.keyTransformer = nil
+	mach.keyEnum = nil
+	rtid := reflect.ValueOf(key_rt).Pointer()
+	if atlEnt, ok := slab.atlas.Get(rtid); ok {
+		switch {
+		case atlEnt.MarshalTransformFunc != nil:
+			if !isMapKeyKind(atlEnt.MarshalTransformTargetType.Kind()) {
+				return fmt.Errorf("unsupported map key type %q (if you want to use struct keys, your atlas needs a transform to string, int, uint, or bool)", key_rt.Name())
+			}
+			mach.keyTransformer = atlEnt.MarshalTransformFunc
+		case atlEnt.EnumMorphism != nil:
+			mach.keyEnum = atlEnt.EnumMorphism
 		}
-		mach.keyStringer = atlEnt.MarshalTransformFunc
-	default:
-		return fmt.Errorf("unsupported map key type %q", key_rt.Name())
+	}
+	if mach.keyTransformer == nil && mach.keyEnum == nil && !isMapKeyKind(key_rt.Kind()) && key_rt.Kind() != reflect.Interface {
+		return fmt.Errorf("unsupported map key type %q (if you want to use struct keys, your atlas needs a transform to string, int, uint, or bool)", key_rt.Name())
 	}
 	keys_rv := mach.target_rv.MapKeys()
-	mach.keys = make([]wildcardMapStringyKey, len(keys_rv))
+	mach.keys = make([]wildcardMapKey, len(keys_rv))
 	for i, v := range keys_rv {
 		mach.keys[i].rv = v
-		if mach.keyStringer == nil {
-			mach.keys[i].s = v.String()
-		} else {
-			trans_rv, err := mach.keyStringer(v)
+		switch {
+		case mach.keyTransformer != nil:
+			trans_rv, err := mach.keyTransformer(v)
 			if err != nil {
-				return fmt.Errorf("unsupported map key type %q: errors in stringifying: %s", key_rt.Name(), err)
+				return fmt.Errorf("unsupported map key type %q: errors in transforming: %s", key_rt.Name(), err)
 			}
-			mach.keys[i].s = trans_rv.String()
+			mach.keys[i].load(trans_rv)
+		case mach.keyEnum != nil:
+			serial, ok := mach.keyEnum.Serials[v.Interface()]
+			if !ok {
+				return fmt.Errorf("map key %v is not one of the known members of the enum for type %q", v, key_rt.Name())
+			}
+			mach.keys[i].load(reflect.ValueOf(serial))
+		case v.Kind() == reflect.Interface:
+			// Keys of interface type may hold anything (and may even differ in kind from each other);
+			//  what they hold has to be a valid key kind, though.
+			if v.IsNil() || !isMapKeyKind(v.Elem().Kind()) {
+				return fmt.Errorf("unsupported map key %v: keys must be strings, ints, uints, or bools", v)
+			}
+			mach.keys[i].load(v.Elem())
+		default:
+			mach.keys[i].load(v)
 		}
 	}
 
@@ -72,14 +92,17 @@ func (mach *marshalMachineMapWildcard) Reset(slab *marshalSlab, rv reflect.Value
 	if mach.morphism != nil {
 		ksm = mach.morphism.KeySortMode
 	}
+	if slab.canonical {
+		ksm = atlas.KeySortMode_RFC7049
+	}
 
 	switch ksm {
 	case atlas.KeySortMode_Default:
-		sort.Sort(wildcardMapStringyKey_byString(mach.keys))
+		sort.Sort(wildcardMapKey_byNatural(mach.keys))
 	case atlas.KeySortMode_Strings:
-		sort.Sort(wildcardMapStringyKey_byString(mach.keys))
+		sort.Sort(wildcardMapKey_byString(mach.keys))
 	case atlas.KeySortMode_RFC7049:
-		sort.Sort(wildcardMapStringyKey_RFC7049(mach.keys))
+		sort.Sort(wildcardMapKey_RFC7049(mach.keys))
 	default:
 		panic(fmt.Errorf("unknown map key sort mode %q", ksm))
 	}
@@ -115,34 +138,221 @@ func (mach *marshalMachineMapWildcard) Step(driver *Marshaller, slab *marshalSla
 		mach.index++
 		return false, driver.Recurse(tok, val_rv, mach.value_rt, mach.valueMach)
 	}
-	tok.Type = TString
-	tok.Str = mach.keys[mach.index].s
+	key := &mach.keys[mach.index]
+	tok.Type = key.tt
+	switch key.tt {
+	case TString:
+		tok.Str = key.s
+	case TInt:
+		tok.Int = key.i
+	case TUint:
+		tok.Uint = key.u
+	case TBool:
+		tok.Bool = key.b
+	}
 	mach.value = true
 	return false, nil
 }
 
-// Holder for the reflect.Value and string form of a key.
+func isMapKeyKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// Holder for the reflect.Value and token form of a key.
 // We need the reflect.Value for looking up the map value;
-// and we need the string for sorting.
-type wildcardMapStringyKey struct {
+// and we need the token form for emitting, and for sorting.
+type wildcardMapKey struct {
 	rv reflect.Value
-	s  string
+	tt TokenType // One of TString, TInt, TUint, or TBool.
+	s  string    // The token value if tt is TString; otherwise, the string form (as emitted by e.g. json).
+	i  int64
+	u  uint64
+	b  bool
 }
 
-type wildcardMapStringyKey_byString []wildcardMapStringyKey
-
-func (x wildcardMapStringyKey_byString) Len() int           { return len(x) }
-func (x wildcardMapStringyKey_byString) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
-func (x wildcardMapStringyKey_byString) Less(i, j int) bool { return x[i].s < x[j].s }
+// Fill in the token form of the key from a value of string, int, uint, or bool kind.
+func (k *wildcardMapKey) load(rv reflect.Value) {
+	switch rv.Kind() {
+	case reflect.String:
+		k.tt = TString
+		k.s = rv.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		k.tt = TInt
+		k.i = rv.Int()
+		k.s = strconv.FormatInt(k.i, 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		k.tt = TUint
+		k.u = rv.Uint()
+		k.s = strconv.FormatUint(k.u, 10)
+	case reflect.Bool:
+		k.tt = TBool
+		k.b = rv.Bool()
+		k.s = strconv.FormatBool(k.b)
+	}
+}
 
-type wildcardMapStringyKey_RFC7049 []wildcardMapStringyKey
+// Sorts lexically for strings, numerically for ints, and false before true for bools.
+// (All keys in one map have the same kind, since they have the same type.)
+type wildcardMapKey_byNatural []wildcardMapKey
 
-func (x wildcardMapStringyKey_RFC7049) Len() int      { return len(x) }
-func (x wildcardMapStringyKey_RFC7049) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
-func (x wildcardMapStringyKey_RFC7049) Less(i, j int) bool {
-	li, lj := len(x[i].s), len(x[j].s)
-	if li == lj {
+func (x wildcardMapKey_byNatural) Len() int      { return len(x) }
+func (x wildcardMapKey_byNatural) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x wildcardMapKey_byNatural) Less(i, j int) bool {
+	if x[i].tt != x[j].tt {
+		return x[i].lessAcrossKinds(x[j])
+	}
+	switch x[i].tt {
+	case TInt:
+		return x[i].i < x[j].i
+	case TUint:
+		return x[i].u < x[j].u
+	case TBool:
+		return !x[i].b && x[j].b
+	default:
 		return x[i].s < x[j].s
 	}
-	return li < lj
+}
+
+// Sorts lexically by the string form of the key, regardless of its kind.
+type wildcardMapKey_byString []wildcardMapKey
+
+func (x wildcardMapKey_byString) Len() int           { return len(x) }
+func (x wildcardMapKey_byString) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x wildcardMapKey_byString) Less(i, j int) bool { return x[i].s < x[j].s }
+
+// Sorts as per the canonical cbor rules: shorter encoded forms first,
+// then bytewise (which for ints means positives before negatives of the
+// same encoded length, and negatives in order of increasing magnitude).
+type wildcardMapKey_RFC7049 []wildcardMapKey
+
+func (x wildcardMapKey_RFC7049) Len() int      { return len(x) }
+func (x wildcardMapKey_RFC7049) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+func (x wildcardMapKey_RFC7049) Less(i, j int) bool {
+	if x[i].tt != x[j].tt {
+		bi, bj := x[i].cborBytes(), x[j].cborBytes()
+		if len(bi) != len(bj) {
+			return len(bi) < len(bj)
+		}
+		return bytes.Compare(bi, bj) < 0
+	}
+	switch x[i].tt {
+	case TInt:
+		mi, vi := cborHeadOfInt(x[i].i)
+		mj, vj := cborHeadOfInt(x[j].i)
+		li, lj := cborHeadLen(vi), cborHeadLen(vj)
+		if li != lj {
+			return li < lj
+		}
+		if mi != mj {
+			return mi < mj
+		}
+		return vi < vj
+	case TUint:
+		return x[i].u < x[j].u
+	case TBool:
+		return !x[i].b && x[j].b
+	default:
+		li, lj := len(x[i].s), len(x[j].s)
+		if li == lj {
+			return x[i].s < x[j].s
+		}
+		return li < lj
+	}
+}
+
+// Orders keys of different kinds (which only happens for maps with interface keys):
+// bools first, then numbers (numerically), then strings.
+func (k wildcardMapKey) lessAcrossKinds(other wildcardMapKey) bool {
+	rank := func(k wildcardMapKey) int {
+		switch k.tt {
+		case TBool:
+			return 0
+		case TInt, TUint:
+			return 1
+		default:
+			return 2
+		}
+	}
+	if ri, rj := rank(k), rank(other); ri != rj {
+		return ri < rj
+	}
+	// Both numbers, of different kinds: one's an int and one's a uint.
+	if k.tt == TInt {
+		return k.i < 0 || uint64(k.i) < other.u
+	}
+	return other.i >= 0 && k.u < uint64(other.i)
+}
+
+// Returns the canonical cbor encoding of the key.
+func (k wildcardMapKey) cborBytes() []byte {
+	var major uint8
+	var v uint64
+	switch k.tt {
+	case TBool:
+		if k.b {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case TInt:
+		major, v = cborHeadOfInt(k.i)
+	case TUint:
+		major, v = 0, k.u
+	default:
+		major, v = 3, uint64(len(k.s))
+	}
+	n := cborHeadLen(v)
+	bs := make([]byte, n, n+len(k.s))
+	bs[0] = major << 5
+	switch n {
+	case 1:
+		bs[0] |= byte(v)
+	case 2:
+		bs[0] |= 24
+	case 3:
+		bs[0] |= 25
+	case 5:
+		bs[0] |= 26
+	case 9:
+		bs[0] |= 27
+	}
+	for i := 1; i < n; i++ {
+		bs[i] = byte(v >> (8 * uint(n-1-i)))
+	}
+	if k.tt == TString {
+		bs = append(bs, k.s...)
+	}
+	return bs
+}
+
+// Returns the major type (0 for positive, 1 for negative) and argument
+// that cbor would use to encode an int.
+func cborHeadOfInt(i int64) (major uint8, v uint64) {
+	if i < 0 {
+		return 1, uint64(-1 - i)
+	}
+	return 0, uint64(i)
+}
+
+// Returns the length of the head cbor would use to encode an argument.
+func cborHeadLen(v uint64) int {
+	switch {
+	case v < 24:
+		return 1
+	case v <= 0xff:
+		return 2
+	case v <= 0xffff:
+		return 3
+	case v <= 0xffffffff:
+		return 5
+	default:
+		return 9
+	}
 }
@@ -0,0 +1,37 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+type marshalMachineNumber struct {
+	n Number
+}
+
+func (mach *marshalMachineNumber) Reset(_ *marshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.n = Number(rv.String())
+	return nil
+}
+
+func (mach *marshalMachineNumber) Step(_ *Marshaller, _ *marshalSlab, tok *Token) (done bool, err error) {
+	if i, err := strconv.ParseInt(string(mach.n), 10, 64); err == nil {
+		tok.Type = TInt
+		tok.Int = i
+		return true, nil
+	}
+	if u, err := strconv.ParseUint(string(mach.n), 10, 64); err == nil {
+		tok.Type = TUint
+		tok.Uint = u
+		return true, nil
+	}
+	if f, err := strconv.ParseFloat(string(mach.n), 64); err == nil {
+		tok.Type = TFloat64
+		tok.Float64 = f
+		return true, nil
+	}
+	return true, fmt.Errorf("cannot marshal Number %q: not a number", mach.n)
+}
@@ -0,0 +1,34 @@
+package obj
+
+/*
+	MarshalOptions adjusts how a Marshaller walks values,
+	in ways which the atlas doesn't cover.
+
+	The zero value is the default behavior.
+*/
+type MarshalOptions struct {
+	// If true, pointers are emitted using the cbor value-sharing tags:
+	// the first time a pointer is visited, its value is tagged 28 ("shareable");
+	// every later visit to the same pointer emits just a uint tagged 29
+	// ("sharedref"), which is the index of the shareable value it refers to,
+	// counting from zero in the order they appear in the stream.
+	// This preserves shared pointers, and makes cycles of pointers
+	// marshallable (without it, they're an error).
+	//
+	// Every pointer is marked shareable, whether it turns out to be shared
+	// or not.  Values which are already tagged (e.g. by their atlas entry)
+	// can't also be marked shareable, so pointers to them are an error.
+	//
+	// Unmarshal with UnmarshalOptions.ValueSharing to reconstruct the pointers.
+	// (The json encoder doesn't support tags, so this is only useful for cbor.)
+	ValueSharing bool
+
+	// If true, the keys of every map (and the fields of every struct) are
+	// emitted in the canonical cbor order of RFC 7049 section 3.9 --
+	// shorter encodings first, then bytewise -- whatever the atlas says.
+	// This includes OrderedMaps, whose order is otherwise preserved.
+	// Together with the definite lengths the Marshaller always uses
+	// (except for ArrayStream), this makes the cbor encoding of a value
+	// canonical, which is what content hashing needs.
+	CanonicalKeyOrder bool
+}
@@ -0,0 +1,83 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+type marshalMachineOrderedMap struct {
+	target    OrderedMap
+	isNil     bool
+	order     []int // Order to visit entries in, if not their own (see MarshalOptions.CanonicalKeyOrder).
+	valueMach MarshalMachine
+	index     int
+	value     bool
+}
+
+func (mach *marshalMachineOrderedMap) Reset(slab *marshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.target = rv.Convert(rt_orderedMap).Interface().(OrderedMap)
+	mach.isNil = rv.IsNil()
+	mach.order = nil
+	if slab.canonical {
+		mach.order = make([]int, len(mach.target))
+		for i := range mach.order {
+			mach.order[i] = i
+		}
+		sort.Slice(mach.order, func(i, j int) bool {
+			a, b := mach.target[mach.order[i]].Key, mach.target[mach.order[j]].Key
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return a < b
+		})
+	}
+	mach.valueMach = slab.requisitionMachine(rt_iface)
+	mach.index = -1
+	mach.value = false
+	return nil
+}
+
+func (mach *marshalMachineOrderedMap) Step(driver *Marshaller, slab *marshalSlab, tok *Token) (done bool, err error) {
+	if mach.index < 0 {
+		if mach.isNil {
+			tok.Type = TNull
+			mach.index++
+			slab.release()
+			return true, nil
+		}
+		tok.Type = TMapOpen
+		tok.Length = len(mach.target)
+		mach.index++
+		return false, nil
+	}
+	if mach.index == len(mach.target) {
+		tok.Type = TMapClose
+		mach.index++
+		slab.release()
+		return true, nil
+	}
+	if mach.index > len(mach.target) {
+		return true, fmt.Errorf("invalid state: value already consumed")
+	}
+	if mach.value {
+		val_rv := reflect.ValueOf(&mach.target[mach.entry(mach.index)].Value).Elem()
+		mach.value = false
+		mach.index++
+		return false, driver.Recurse(tok, val_rv, rt_iface, mach.valueMach)
+	}
+	tok.Type = TString
+	tok.Str = mach.target[mach.entry(mach.index)].Key
+	mach.value = true
+	return false, nil
+}
+
+// Return the index in target of the i'th entry to visit.
+func (mach *marshalMachineOrderedMap) entry(i int) int {
+	if mach.order != nil {
+		return mach.order[i]
+	}
+	return i
+}
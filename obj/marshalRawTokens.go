@@ -0,0 +1,20 @@
+package obj
+
+import (
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+type marshalMachineRawTokens struct {
+	src RawTokensSource
+}
+
+func (mach *marshalMachineRawTokens) Reset(_ *marshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.src = RawTokensSource{rv.Convert(rt_rawTokens).Interface().(RawTokens), 0}
+	return nil
+}
+
+func (mach *marshalMachineRawTokens) Step(_ *Marshaller, _ *marshalSlab, tok *Token) (done bool, err error) {
+	return mach.src.Step(tok)
+}
@@ -0,0 +1,155 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+// The cbor tags for value sharing.  See MarshalOptions.ValueSharing.
+const (
+	tagShareable = 28
+	tagSharedRef = 29
+)
+
+/*
+	The identity of a value of a reference kind (pointer, map, or slice),
+	used to spot cycles (and, with value sharing, pointers we've already emitted).
+	The type is part of the identity because e.g. a pointer to a struct
+	and a pointer to its first field have the same address.
+
+	The zero value means the value isn't of a reference kind (or is nil or empty,
+	and so can't be part of a cycle).
+*/
+type marshalRef struct {
+	ptr uintptr
+	rt  reflect.Type
+	len int // Only for slices; a subslice with the same start is a different value.
+}
+
+func refOf(rv reflect.Value) marshalRef {
+	for rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return marshalRef{}
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		// Pointers to zero-sized values may all have the same address.  They can't form cycles anyway.
+		if rv.IsNil() || rv.Type().Elem().Size() == 0 {
+			return marshalRef{}
+		}
+		return marshalRef{rv.Pointer(), rv.Type(), 0}
+	case reflect.Map:
+		if rv.IsNil() {
+			return marshalRef{}
+		}
+		return marshalRef{rv.Pointer(), rv.Type(), 0}
+	case reflect.Slice:
+		if rv.Len() == 0 {
+			return marshalRef{}
+		}
+		return marshalRef{rv.Pointer(), rv.Type(), rv.Len()}
+	default:
+		return marshalRef{}
+	}
+}
+
+/*
+	Return an error if the value is already being marshalled
+	by one of the machines on the stack.
+*/
+func (d *Marshaller) checkCycle(ref marshalRef) error {
+	match := -1
+	for i, r := range d.refs {
+		if r == ref {
+			match = i
+			break
+		}
+	}
+	if match < 0 && d.stepRef == ref {
+		match = len(d.refs)
+	}
+	if match < 0 {
+		return nil
+	}
+	machs := append(d.stack[:len(d.stack):len(d.stack)], d.step)
+	return ErrMarshalCycle{
+		Path:         pathOfMachines(machs),
+		AncestorPath: pathOfMachines(machs[:match]),
+		Type:         ref.rt.String(),
+	}
+}
+
+// Mark the token as the start of a shareable value.
+func tagShareableToken(tok *Token) error {
+	if tok.Tagged {
+		return fmt.Errorf("value sharing: cannot mark a value as shareable, because it's already tagged %d", tok.Tag)
+	}
+	tok.Tagged = true
+	tok.Tag = tagShareable
+	return nil
+}
+
+/*
+	Describe, as a JSON Pointer, the position in the tree of the value
+	the last of the given machines is currently recursing into.
+	(This only makes sense for the machines on a Marshaller's stack.)
+*/
+func pathOfMachines(machs []MarshalMachine) string {
+	var path []string
+	for _, mach := range machs {
+		path = appendPathSegments(path, mach)
+	}
+	if len(path) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(path, "/")
+}
+
+// Append the path segment(s) leading to whichever child the machine is recursing into.
+// The machines that can recurse all bump their index before doing so.
+func appendPathSegments(path []string, mach MarshalMachine) []string {
+	switch mach := mach.(type) {
+	case *ptrDerefDelegateMarshalMachine:
+		return appendPathSegments(path, mach.MarshalMachine)
+	case *marshalMachineWildcard:
+		if mach.delegate != nil {
+			return appendPathSegments(path, mach.delegate)
+		}
+	case *marshalMachineTransform:
+		return appendPathSegments(path, mach.delegate)
+	case *marshalMachineUnionKinded:
+		return appendPathSegments(path, mach.delegate)
+	case *marshalMachineUnionKeyed:
+		return appendPathSegments(append(path, shared.EscapePointerToken(mach.elementName)), mach.delegate)
+	case *marshalMachineStructAtlas:
+		if mach.index > 0 {
+			return append(path, shared.EscapePointerToken(mach.cfg.StructMap.Fields[mach.index-1].SerialName))
+		}
+	case *marshalMachineMapWildcard:
+		if mach.index > 0 {
+			return append(path, shared.EscapePointerToken(mach.keys[mach.index-1].s))
+		}
+	case *marshalMachineOrderedMap:
+		if mach.index > 0 {
+			return append(path, shared.EscapePointerToken(mach.target[mach.index-1].Key))
+		}
+	case *marshalMachineSliceWildcard:
+		return appendPathSegments(path, &mach.marshalMachineArrayWildcard)
+	case *marshalMachineArrayWildcard:
+		if mach.index > 0 {
+			return append(path, strconv.Itoa(mach.index-1))
+		}
+	case *marshalMachineArrayStream:
+		if mach.index > 0 {
+			return append(path, strconv.Itoa(mach.index-1))
+		}
+	}
+	return path
+}
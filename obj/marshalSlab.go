@@ -3,6 +3,7 @@ package obj
 import (
 	"fmt"
 	"reflect"
+	"sort"
 
 	"github.com/polydawn/refmt/obj/atlas"
 	. "github.com/polydawn/refmt/tok"
@@ -16,6 +17,12 @@ import (
 type marshalSlab struct {
 	atlas atlas.Atlas
 	rows  []marshalSlabRow
+
+	// If set, map keys and struct fields are emitted in canonical cbor order,
+	// regardless of the atlas (see MarshalOptions.CanonicalKeyOrder).
+	// The order of struct fields is computed once per atlas entry.
+	canonical   bool
+	fieldOrders map[*atlas.AtlasEntry][]int
 }
 
 type marshalSlabRow struct {
@@ -27,10 +34,41 @@ type marshalSlabRow struct {
 	marshalMachineStructAtlas
 	marshalMachineTransform
 	marshalMachineUnionKeyed
+	marshalMachineUnionKinded
+	marshalMachineEnum
+	marshalMachineRawTokens
+	marshalMachineOrderedMap
+	marshalMachineNumber
+	marshalMachineHooks
+	marshalMachineArrayStream
 
 	errThunkMarshalMachine
 }
 
+// Return the order to visit the fields of a struct in,
+// or nil if it's the order they're in in the atlas entry.
+func (slab *marshalSlab) structFieldOrder(cfg *atlas.AtlasEntry) []int {
+	if !slab.canonical {
+		return nil
+	}
+	if order, ok := slab.fieldOrders[cfg]; ok {
+		return order
+	}
+	fields := cfg.StructMap.Fields
+	order := make([]int, len(fields))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return atlas.StructMapEntry_RFC7049{fields[order[i]], fields[order[j]]}.Less(0, 1)
+	})
+	if slab.fieldOrders == nil {
+		slab.fieldOrders = make(map[*atlas.AtlasEntry][]int)
+	}
+	slab.fieldOrders[cfg] = order
+	return order
+}
+
 // A thunk value that can be used to trigger `isNil` paths.
 // (Substituting an 'invalid' kind reflect.Value with this is an easy way
 // to emit a null without needing any additional special cases or error handling.)
@@ -116,16 +154,35 @@ func _yieldBareMarshalMachinePtr(row *marshalSlabRow, atl atlas.Atlas, rt reflec
 		return _yieldMarshalMachinePtrForAtlasEntry(row, entry, atl)
 	}
 
+	// Consult the type's own methods third.
+	if hk := marshalHookKindFor(rt); hk != hookKind_none {
+		row.marshalMachineHooks.kind = hk
+		return &row.marshalMachineHooks
+	}
+
 	// If no specific behavior found, use default behavior based on kind.
 	switch rt.Kind() {
+	case reflect.String:
+		// Number is a string underneath, but has its own behavior.
+		if rt == rt_number {
+			return &row.marshalMachineNumber
+		}
+		row.marshalMachinePrimitive.kind = rt.Kind()
+		return &row.marshalMachinePrimitive
 	case reflect.Bool,
-		reflect.String,
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
 		reflect.Float32, reflect.Float64:
 		row.marshalMachinePrimitive.kind = rt.Kind()
 		return &row.marshalMachinePrimitive
 	case reflect.Slice:
+		// slices of tokens are raw tokens: captured or emitted verbatim.
+		if rt.Elem() == rt_token {
+			return &row.marshalMachineRawTokens
+		}
+		if rt == rt_orderedMap {
+			return &row.marshalMachineOrderedMap
+		}
 		// un-typedef'd byte slices were handled already, but a typedef'd one still gets gets treated like a special kind:
 		if rt.Elem().Kind() == reflect.Uint8 {
 			row.marshalMachinePrimitive.kind = rt.Kind()
@@ -143,6 +200,9 @@ func _yieldBareMarshalMachinePtr(row *marshalSlabRow, atl atlas.Atlas, rt reflec
 		row.marshalMachineMapWildcard.morphism = atl.GetDefaultMapMorphism()
 		return &row.marshalMachineMapWildcard
 	case reflect.Struct:
+		if rt == rt_arrayStream {
+			return &row.marshalMachineArrayStream
+		}
 		// TODO here we could also invoke automatic atlas autogen, if configured to be permitted
 		mach := &row.errThunkMarshalMachine
 		mach.err = fmt.Errorf("missing an atlas entry describing how to marshal type %v (and auto-atlasing for structs is not enabled)", rt)
@@ -170,7 +230,7 @@ func _yieldMarshalMachinePtrForAtlasEntry(row *marshalSlabRow, entry *atlas.Atla
 		// We can't just call the func here because we're still working off typeinfo
 		// and don't have a real value to transform until later.
 		row.marshalMachineTransform.trFunc = entry.MarshalTransformFunc
-		// Pick delegate without growing stack.  (This currently means recursive transform won't fly.)
+		// Pick delegate without growing stack.  (This means recursive transforms won't fly; atlas.Build rejects them.)
 		row.marshalMachineTransform.delegate = _yieldMarshalMachinePtr(row, atl, entry.MarshalTransformTargetType)
 		// If tags are in play: have the transformer machine glue that on.
 
@@ -183,6 +243,12 @@ func _yieldMarshalMachinePtrForAtlasEntry(row *marshalSlabRow, entry *atlas.Atla
 	case entry.UnionKeyedMorphism != nil:
 		row.marshalMachineUnionKeyed.cfg = entry
 		return &row.marshalMachineUnionKeyed
+	case entry.UnionKindedMorphism != nil:
+		row.marshalMachineUnionKinded.cfg = entry
+		return &row.marshalMachineUnionKinded
+	case entry.EnumMorphism != nil:
+		row.marshalMachineEnum.cfg = entry
+		return &row.marshalMachineEnum
 	case entry.MapMorphism != nil:
 		row.marshalMachineMapWildcard.morphism = entry.MapMorphism
 		return &row.marshalMachineMapWildcard
@@ -191,6 +257,21 @@ func _yieldMarshalMachinePtrForAtlasEntry(row *marshalSlabRow, entry *atlas.Atla
 	}
 }
 
+// Like _yieldMarshalMachinePtrForAtlasEntry, but for the members of unions,
+// which may be entries with no special configuration (e.g. a plain string
+// in a kinded union): for those, we use the default machinery for the type.
+func _yieldMarshalMachinePtrForUnionMember(row *marshalSlabRow, entry *atlas.AtlasEntry, atl atlas.Atlas) MarshalMachine {
+	if entry.MarshalTransformFunc == nil &&
+		entry.StructMap == nil &&
+		entry.MapMorphism == nil &&
+		entry.UnionKeyedMorphism == nil &&
+		entry.UnionKindedMorphism == nil &&
+		entry.EnumMorphism == nil {
+		return _yieldBareMarshalMachinePtr(row, atl, entry.Type)
+	}
+	return _yieldMarshalMachinePtrForAtlasEntry(row, entry, atl)
+}
+
 // Returns the top row of the slab.  Useful for machines that need to delegate
 // to another type that's definitely not their own.  Be careful with that
 // caveat; if the delegation can be to another system that uses in-row delegation,
@@ -12,12 +12,14 @@ type marshalMachineStructAtlas struct {
 	cfg *atlas.AtlasEntry // set on initialization
 
 	target_rv reflect.Value
+	order     []int         // Order to visit fields in, if not the atlas's (see MarshalOptions.CanonicalKeyOrder).
 	index     int           // Progress marker
 	value_rv  reflect.Value // Next value (or nil if next step is key).
 }
 
 func (mach *marshalMachineStructAtlas) Reset(slab *marshalSlab, rv reflect.Value, _ reflect.Type) error {
 	mach.target_rv = rv
+	mach.order = slab.structFieldOrder(mach.cfg)
 	mach.index = -1
 	mach.value_rv = reflect.Value{}
 	slab.grow() // we'll reuse the same row for all fields
@@ -48,7 +50,7 @@ func (mach *marshalMachineStructAtlas) Step(driver *Marshaller, slab *marshalSla
 	}
 
 	// If value loaded from last step, recurse into handling that.
-	fieldEntry := mach.cfg.StructMap.Fields[mach.index]
+	fieldEntry := mach.field(mach.index)
 	if mach.value_rv != (reflect.Value{}) {
 		child_rv := mach.value_rv
 		mach.index++
@@ -72,7 +74,7 @@ func (mach *marshalMachineStructAtlas) Step(driver *Marshaller, slab *marshalSla
 			slab.release()
 			return true, nil
 		}
-		fieldEntry = mach.cfg.StructMap.Fields[mach.index]
+		fieldEntry = mach.field(mach.index)
 	}
 	mach.value_rv = fieldEntry.ReflectRoute.TraverseToValue(mach.target_rv)
 	if fieldEntry.OmitEmpty && isEmptyValue(mach.value_rv) {
@@ -80,11 +82,24 @@ func (mach *marshalMachineStructAtlas) Step(driver *Marshaller, slab *marshalSla
 		mach.index++
 		return mach.Step(driver, slab, tok)
 	}
+	if fieldEntry.KeyAsInt {
+		tok.Type = TInt
+		tok.Int = fieldEntry.SerialInt
+		return false, nil
+	}
 	tok.Type = TString
 	tok.Str = fieldEntry.SerialName
 	return false, nil
 }
 
+// Return the i'th field to visit.
+func (mach *marshalMachineStructAtlas) field(i int) atlas.StructMapEntry {
+	if mach.order != nil {
+		i = mach.order[i]
+	}
+	return mach.cfg.StructMap.Fields[i]
+}
+
 // Count how many fields in a struct should actually be marshalled.
 // Fields that are tagged omitEmpty and are isEmptyValue are not counted, and
 // StructMapEntry used to flag ignored fields unmarshalling never count, so
@@ -29,7 +29,7 @@ func (mach *marshalMachineUnionKeyed) Reset(slab *marshalSlab, rv reflect.Value,
 		return fmt.Errorf("type %q is not one of the known members of the union for interface %q", element_rt.Name(), mach.cfg.Type.Name())
 	}
 	delegateAtlasEnt := mach.cfg.UnionKeyedMorphism.Elements[mach.elementName]
-	mach.delegate = _yieldMarshalMachinePtrForAtlasEntry(slab.tip(), delegateAtlasEnt, slab.atlas)
+	mach.delegate = _yieldMarshalMachinePtrForUnionMember(slab.tip(), delegateAtlasEnt, slab.atlas)
 	if err := mach.delegate.Reset(slab, mach.target_rv, delegateAtlasEnt.Type); err != nil {
 		return err
 	}
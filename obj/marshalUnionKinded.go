@@ -0,0 +1,39 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	A MarshalMachine that unwraps an interface value, looks up which
+	member of the kinded union its concrete type is, and delegates to
+	that member's machine.  No additional tokens are emitted:
+	the kind of the member's serial form is all the discrimination needed.
+*/
+type marshalMachineUnionKinded struct {
+	cfg *atlas.AtlasEntry // set on initialization
+
+	delegate MarshalMachine // actual machine, picked based on content of the interface.
+}
+
+func (mach *marshalMachineUnionKinded) Reset(slab *marshalSlab, rv reflect.Value, rt reflect.Type) error {
+	target_rv := rv.Elem()
+	if target_rv.Kind() == reflect.Invalid {
+		return fmt.Errorf("nil is not a valid member for the union for interface %q", mach.cfg.Type.Name())
+	}
+	element_rt := target_rv.Type()
+	delegateAtlasEnt, ok := mach.cfg.UnionKindedMorphism.Mappings[reflect.ValueOf(element_rt).Pointer()]
+	if !ok {
+		return fmt.Errorf("type %q is not one of the known members of the union for interface %q", element_rt.Name(), mach.cfg.Type.Name())
+	}
+	mach.delegate = _yieldMarshalMachinePtrForUnionMember(slab.tip(), delegateAtlasEnt, slab.atlas)
+	return mach.delegate.Reset(slab, target_rv, delegateAtlasEnt.Type)
+}
+
+func (mach *marshalMachineUnionKinded) Step(driver *Marshaller, slab *marshalSlab, tok *Token) (done bool, err error) {
+	return mach.delegate.Step(driver, slab, tok)
+}
@@ -0,0 +1,44 @@
+package obj
+
+import (
+	"reflect"
+
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+func init() {
+	atlas.RegisterNativeTypes(nativeTypeSchema)
+}
+
+/*
+	Whether we handle values of this type without an atlas entry, and if so,
+	a JSON Schema of what marshalling them yields (nil if it's just the usual
+	for the type's kind).  This is what the atlas package knows of us.
+
+	Keep this in step with the order _yieldBareMarshalMachinePtr (and its
+	unmarshalling counterpart) check things in after consulting the atlas.
+*/
+func nativeTypeSchema(rt reflect.Type) (schema map[string]interface{}, ok bool) {
+	switch marshalHookKindFor(rt) {
+	case hookKind_refmt:
+		return map[string]interface{}{}, true // could be anything.
+	case hookKind_text:
+		return map[string]interface{}{"type": "string"}, true
+	case hookKind_binary:
+		return map[string]interface{}{"type": "string", "contentEncoding": "base64"}, true
+	}
+	if unmarshalHookKindFor(rt) != hookKind_none {
+		return nil, true
+	}
+	switch {
+	case rt == rt_number:
+		return map[string]interface{}{"type": "number"}, true
+	case rt.Kind() == reflect.Slice && rt.Elem() == rt_token:
+		return map[string]interface{}{}, true // raw tokens could be anything.
+	case rt == rt_orderedMap:
+		return map[string]interface{}{"type": []string{"object", "null"}}, true
+	case rt == rt_arrayStream:
+		return map[string]interface{}{"type": "array"}, true
+	}
+	return nil, false
+}
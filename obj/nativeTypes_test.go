@@ -0,0 +1,55 @@
+package obj
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+func TestNativeTypes(t *testing.T) {
+	t.Run("need no atlas entries", func(t *testing.T) {
+		type tObj struct {
+			N Number
+			M OrderedMap
+			S ArrayStream
+			R RawTokens
+			P tPoint
+			B *tBlob
+		}
+		_, err := atlas.Build(atlas.BuildEntry(tObj{}).StructMap().Autogenerate().Complete())
+		Wish(t, err, ShouldEqual, nil)
+	})
+	t.Run("are described in JSON Schemas as they're marshalled", func(t *testing.T) {
+		type tObj struct {
+			N Number
+			M OrderedMap
+			S ArrayStream
+			R RawTokens
+			P tPoint
+			B *tBlob
+			L tLabel
+		}
+		atl := atlas.MustBuild(atlas.BuildEntry(tObj{}).StructMap().Autogenerate().Complete())
+		js, err := atl.JSONSchema(reflect.TypeOf(tObj{}))
+		Wish(t, err, ShouldEqual, nil)
+		def := js["$defs"].(map[string]interface{})["obj.tObj"].(map[string]interface{})
+		Wish(t, def["properties"], ShouldEqual, map[string]interface{}{
+			"n": map[string]interface{}{"type": "number"},
+			"m": map[string]interface{}{"type": []string{"object", "null"}},
+			"s": map[string]interface{}{"type": "array"},
+			"r": map[string]interface{}{},
+			"p": map[string]interface{}{},
+			"b": map[string]interface{}{"type": []string{"string", "null"}, "contentEncoding": "base64"},
+			"l": map[string]interface{}{"type": "string"},
+		})
+	})
+	t.Run("other structs still do", func(t *testing.T) {
+		type tInner struct{ X int }
+		type tObj struct{ I tInner }
+		_, err := atlas.Build(atlas.BuildEntry(tObj{}).StructMap().Autogenerate().Complete())
+		Wish(t, err.Error(), ShouldEqual, `invalid atlas entry for obj.tObj: field "i": missing an atlas entry describing how to handle type obj.tInner`)
+	})
+}
@@ -0,0 +1,51 @@
+package obj
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Number holds a number in its literal, decimal form.
+
+	Unmarshalling into a Number accepts any int, uint, or float token.
+	Ints and uints keep their exact value (a uint too large for an int64
+	stays intact, for example).  Floats keep float64 precision -- tokens
+	don't carry the original text, so a `12345678901234567890123` which a
+	decoder handed over as a float comes out as "1.2345678901234568e+22" --
+	and are always written with a decimal point or exponent ("1.0", not "1"),
+	so they stay floats.
+	Marshalling a Number emits an int or uint token if its text parses as
+	one (int preferred), and a float token otherwise.
+	An Unmarshaller can be configured to produce Numbers for numbers
+	unmarshalled into an `interface{}` (see UnmarshalOptions.Numbers).
+*/
+type Number string
+
+func (n Number) String() string { return string(n) }
+
+func (n Number) Int64() (int64, error) { return strconv.ParseInt(string(n), 10, 64) }
+
+func (n Number) Uint64() (uint64, error) { return strconv.ParseUint(string(n), 10, 64) }
+
+func (n Number) Float64() (float64, error) { return strconv.ParseFloat(string(n), 64) }
+
+func numberFromToken(tok *Token) Number {
+	switch tok.Type {
+	case TInt:
+		return Number(strconv.FormatInt(tok.Int, 10))
+	case TUint:
+		return Number(strconv.FormatUint(tok.Uint, 10))
+	default:
+		s := strconv.FormatFloat(tok.Float64, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eInN") { // "NaN" and "+Inf" are already obviously not ints.
+			s += ".0"
+		}
+		return Number(s)
+	}
+}
+
+var rt_number = reflect.TypeOf(Number(""))
@@ -0,0 +1,82 @@
+package obj
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestArrayStream(t *testing.T) {
+	counter := func(n int) ArrayStream {
+		i := 0
+		return NewArrayStream(func() (int, bool) {
+			i++
+			return i, i <= n
+		})
+	}
+	t.Run("from a func", func(t *testing.T) {
+		checkMarshalling(t, atlas.MustBuild(), counter(3), []Token{
+			{Type: TArrOpen, Length: -1},
+			TokInt(1), TokInt(2), TokInt(3),
+			{Type: TArrClose},
+		}, nil)
+	})
+	t.Run("from an empty func", func(t *testing.T) {
+		checkMarshalling(t, atlas.MustBuild(), counter(0), []Token{
+			{Type: TArrOpen, Length: -1},
+			{Type: TArrClose},
+		}, nil)
+	})
+	t.Run("from a chan", func(t *testing.T) {
+		ch := make(chan string)
+		go func() {
+			defer close(ch)
+			for _, s := range []string{"a", "b"} {
+				ch <- s
+			}
+		}()
+		checkMarshalling(t, atlas.MustBuild(), NewArrayStreamFromChan(ch), []Token{
+			{Type: TArrOpen, Length: -1},
+			TokStr("a"), TokStr("b"),
+			{Type: TArrClose},
+		}, nil)
+	})
+	t.Run("of structs, in a struct field", func(t *testing.T) {
+		type tRow struct {
+			N int
+		}
+		type tReport struct {
+			Rows ArrayStream
+		}
+		atl := atlas.MustBuild(
+			atlas.BuildEntry(tRow{}).StructMap().Autogenerate().Complete(),
+			atlas.BuildEntry(tReport{}).StructMap().Autogenerate().Complete(),
+		)
+		i := 0
+		checkMarshalling(t, atl, tReport{NewArrayStream(func() (*tRow, bool) {
+			i++
+			return &tRow{i}, i <= 2
+		})}, []Token{
+			{Type: TMapOpen, Length: 1},
+			/**/ TokStr("rows"), {Type: TArrOpen, Length: -1},
+			/**/ /**/ {Type: TMapOpen, Length: 1}, TokStr("n"), TokInt(1), {Type: TMapClose},
+			/**/ /**/ {Type: TMapOpen, Length: 1}, TokStr("n"), TokInt(2), {Type: TMapClose},
+			/**/ {Type: TArrClose},
+			{Type: TMapClose},
+		}, nil)
+	})
+	t.Run("zero value is null", func(t *testing.T) {
+		checkMarshalling(t, atlas.MustBuild(), ArrayStream{}, []Token{
+			{Type: TNull},
+		}, nil)
+	})
+	t.Run("unmarshal is rejected", func(t *testing.T) {
+		var slot ArrayStream
+		err := NewUnmarshaller(atlas.MustBuild()).Bind(&slot)
+		Wish(t, err, ShouldEqual, fmt.Errorf("cannot unmarshal into obj.ArrayStream: it can only be marshalled (use UnmarshalEach to stream elements out of an array)"))
+	})
+}
@@ -0,0 +1,53 @@
+package obj
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestCanonicalKeyOrder(t *testing.T) {
+	type tObj struct {
+		Ccc string
+		Bb  string
+		A   map[string]int
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(tObj{}).StructMap().Autogenerate().Complete(),
+	)
+	opts := MarshalOptions{CanonicalKeyOrder: true}
+	t.Run("struct fields and maps", func(t *testing.T) {
+		toks, err := marshalWithOptions(t, atl, opts, tObj{"c", "b", map[string]int{"zz": 1, "y": 2, "aaa": 3}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, toks, ShouldEqual, []Token{
+			{Type: TMapOpen, Length: 3},
+			TokStr("a"), {Type: TMapOpen, Length: 3},
+			TokStr("y"), TokInt(2),
+			TokStr("zz"), TokInt(1),
+			TokStr("aaa"), TokInt(3),
+			{Type: TMapClose},
+			TokStr("bb"), TokStr("b"),
+			TokStr("ccc"), TokStr("c"),
+			{Type: TMapClose},
+		})
+	})
+	t.Run("without the option, the atlas order is used", func(t *testing.T) {
+		toks, err := marshalWithOptions(t, atl, MarshalOptions{}, tObj{"c", "b", nil})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, toks[1], ShouldEqual, TokStr("ccc"))
+	})
+	t.Run("ordered maps", func(t *testing.T) {
+		toks, err := marshalWithOptions(t, atlas.MustBuild(), opts, OrderedMap{{"bb", 1}, {"c", 2}, {"a", 3}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, toks, ShouldEqual, []Token{
+			{Type: TMapOpen, Length: 3},
+			TokStr("a"), TokInt(3),
+			TokStr("c"), TokInt(2),
+			TokStr("bb"), TokInt(1),
+			{Type: TMapClose},
+		})
+	})
+}
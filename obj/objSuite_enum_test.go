@@ -0,0 +1,86 @@
+package obj
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestEnumHandling(t *testing.T) {
+	type Color int
+	const (
+		Red Color = iota + 1
+		Green
+		Blue
+	)
+	t.Run("string enum", func(t *testing.T) {
+		atl := atlas.MustBuild(
+			atlas.BuildEntry(Color(0)).Enum().
+				AddMember(Red, "red").
+				AddMember(Green, "green").
+				Complete(),
+		)
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atl, Green, []Token{TokStr("green")}, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			var slot Color
+			expect := Green
+			checkUnmarshalling(t, atl, &slot, []Token{TokStr("green")}, &expect, nil)
+		})
+		t.Run("marshal unknown member", func(t *testing.T) {
+			marshaller := NewMarshaller(atl)
+			err := marshaller.Bind(Blue)
+			Wish(t, err == nil, ShouldEqual, false)
+		})
+		t.Run("unmarshal unknown member", func(t *testing.T) {
+			var slot Color
+			unmarshaller := NewUnmarshaller(atl)
+			Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+			tok := TokStr("blue")
+			done, err := unmarshaller.Step(&tok)
+			Wish(t, done, ShouldEqual, true)
+			// Compare by string: the error contains reflect.Type, which doesn't diff well.
+			Wish(t, err.Error(), ShouldEqual, `unmarshal error: cannot unmarshal into enum obj.Color: "blue" is not one of the known members (expected one of [green red])`)
+		})
+		t.Run("unmarshal wrong token type", func(t *testing.T) {
+			var slot Color
+			unmarshaller := NewUnmarshaller(atl)
+			Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+			tok := TokInt(1)
+			_, err := unmarshaller.Step(&tok)
+			_, ok := err.(ErrUnmarshalTypeCantFit)
+			Wish(t, ok, ShouldEqual, true)
+		})
+	})
+	t.Run("int enum with fallback", func(t *testing.T) {
+		atl := atlas.MustBuild(
+			atlas.BuildEntry(Color(0)).Enum().
+				AddMember(Red, 10).
+				AddMember(Green, uint8(20)).
+				Fallback(Blue).
+				Complete(),
+		)
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atl, Green, []Token{TokInt(20)}, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			var slot Color
+			expect := Red
+			checkUnmarshalling(t, atl, &slot, []Token{TokInt(10)}, &expect, nil)
+		})
+		t.Run("unmarshal uint token", func(t *testing.T) {
+			var slot Color
+			expect := Green
+			checkUnmarshalling(t, atl, &slot, []Token{{Type: TUint, Uint: 20}}, &expect, nil)
+		})
+		t.Run("unmarshal unknown member uses fallback", func(t *testing.T) {
+			var slot Color
+			expect := Blue
+			checkUnmarshalling(t, atl, &slot, []Token{TokInt(99)}, &expect, nil)
+		})
+	})
+}
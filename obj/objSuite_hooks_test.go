@@ -0,0 +1,145 @@
+package obj
+
+import (
+	"encoding"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+// tPoint describes itself as a two-element array.
+type tPoint struct{ X, Y int }
+
+func (p tPoint) MarshalRefmt() (RawTokens, error) {
+	return RawTokens{
+		{Type: TArrOpen, Length: 2},
+		TokInt(int64(p.X)), TokInt(int64(p.Y)),
+		{Type: TArrClose},
+	}, nil
+}
+
+func (p *tPoint) UnmarshalRefmt(toks RawTokens) error {
+	if len(toks) != 4 || toks[0].Type != TArrOpen {
+		return fmt.Errorf("point must be an array of two ints")
+	}
+	p.X, p.Y = int(toks[1].Int), int(toks[2].Int)
+	return nil
+}
+
+// tBlob only knows how to be bytes.
+type tBlob struct{ content string }
+
+func (b tBlob) MarshalBinary() ([]byte, error) { return []byte(b.content), nil }
+
+func (b *tBlob) UnmarshalBinary(bs []byte) error {
+	b.content = string(bs)
+	return nil
+}
+
+// tLabel can be text, but atlases may say otherwise.
+type tLabel struct{ S string }
+
+func (l tLabel) MarshalText() ([]byte, error) { return []byte("label:" + l.S), nil }
+
+func TestHooksHandling(t *testing.T) {
+	t.Run("refmt hooks", func(t *testing.T) {
+		atl := atlas.MustBuild()
+		seq := []Token{
+			{Type: TArrOpen, Length: 2},
+			TokInt(1), TokInt(2),
+			{Type: TArrClose},
+		}
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atl, tPoint{1, 2}, seq, nil)
+			checkMarshalling(t, atl, &tPoint{1, 2}, seq, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			slot := tPoint{}
+			checkUnmarshalling(t, atl, &slot, seq, &tPoint{1, 2}, nil)
+		})
+		t.Run("unmarshal errors", func(t *testing.T) {
+			slot := tPoint{}
+			checkUnmarshalling(t, atl, &slot, []Token{TokStr("nope")}, &tPoint{}, fmt.Errorf("point must be an array of two ints"))
+		})
+	})
+	t.Run("text hooks", func(t *testing.T) {
+		type tHost struct {
+			Addr net.IP
+			Load *big.Int
+		}
+		atl, err := atlas.Build(
+			atlas.BuildEntry(tHost{}).StructMap().Autogenerate().Complete(),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		seq := []Token{
+			{Type: TMapOpen, Length: 2},
+			TokStr("addr"), TokStr("10.0.0.1"),
+			TokStr("load"), TokStr("123456789012345678901234567890"),
+			{Type: TMapClose},
+		}
+		load, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+		value := tHost{net.ParseIP("10.0.0.1").To4(), load}
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atl, value, seq, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			slot := tHost{}
+			unmarshaller := NewUnmarshaller(atl)
+			Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+			for _, tok := range seq {
+				_, err := unmarshaller.Step(&tok)
+				Wish(t, err, ShouldEqual, nil)
+			}
+			Wish(t, slot.Addr.String(), ShouldEqual, "10.0.0.1")
+			Wish(t, slot.Load.String(), ShouldEqual, "123456789012345678901234567890")
+		})
+	})
+	t.Run("binary hooks", func(t *testing.T) {
+		atl := atlas.MustBuild()
+		seq := []Token{{Type: TBytes, Bytes: []byte("abc")}}
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atl, tBlob{"abc"}, seq, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			slot := tBlob{}
+			checkUnmarshalling(t, atl, &slot, seq, &tBlob{"abc"}, nil)
+		})
+	})
+	t.Run("atlas entries take precedence", func(t *testing.T) {
+		atl := atlas.MustBuild(
+			atlas.BuildEntry(tPoint{}).StructMap().Autogenerate().Complete(),
+		)
+		checkMarshalling(t, atl, tPoint{1, 2}, []Token{
+			{Type: TMapOpen, Length: 2},
+			TokStr("x"), TokInt(1),
+			TokStr("y"), TokInt(2),
+			{Type: TMapClose},
+		}, nil)
+	})
+	t.Run("interface types use what's in them, not hooks", func(t *testing.T) {
+		type tObj struct {
+			A encoding.TextMarshaler
+			B encoding.TextMarshaler
+			C encoding.TextMarshaler
+		}
+		atl := atlas.MustBuild(
+			atlas.BuildEntry(tObj{}).StructMap().Autogenerate().Complete(),
+			atlas.BuildEntry(tLabel{}).StructMap().Autogenerate().Complete(),
+		)
+		checkMarshalling(t, atl, tObj{nil, tLabel{"x"}, net.ParseIP("10.0.0.1").To4()}, []Token{
+			{Type: TMapOpen, Length: 3},
+			TokStr("a"), {Type: TNull},
+			TokStr("b"), {Type: TMapOpen, Length: 1},
+			/**/ TokStr("s"), TokStr("x"),
+			/**/ {Type: TMapClose},
+			TokStr("c"), TokStr("10.0.0.1"),
+			{Type: TMapClose},
+		}, nil)
+	})
+}
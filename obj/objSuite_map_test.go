@@ -3,7 +3,10 @@ package obj
 import (
 	"testing"
 
+	. "github.com/warpfork/go-wish"
+
 	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
 	"github.com/polydawn/refmt/tok/fixtures"
 )
 
@@ -51,4 +54,176 @@ func TestMapHandling(t *testing.T) {
 			})
 		})
 	})
+	t.Run("tokens for map with int keys", func(t *testing.T) {
+		seq := []Token{
+			{Type: TMapOpen, Length: 3},
+			TokInt(-2), TokStr("b"),
+			TokInt(1), TokStr("a"),
+			TokInt(10), TokStr("c"),
+			{Type: TMapClose},
+		}
+		t.Run("prism to map[int]string", func(t *testing.T) {
+			atl := atlas.MustBuild()
+			value := map[int]string{1: "a", -2: "b", 10: "c"}
+			t.Run("marshal", func(t *testing.T) {
+				checkMarshalling(t, atl, value, seq, nil)
+			})
+			t.Run("unmarshal", func(t *testing.T) {
+				slot := map[int]string{}
+				checkUnmarshalling(t, atl, &slot, seq, &value, nil)
+			})
+			t.Run("unmarshal from uint keys", func(t *testing.T) {
+				slot := map[int]string{}
+				expect := map[int]string{1: "a"}
+				checkUnmarshalling(t, atl, &slot, []Token{
+					{Type: TMapOpen, Length: 1},
+					{Type: TUint, Uint: 1}, TokStr("a"),
+					{Type: TMapClose},
+				}, &expect, nil)
+			})
+			t.Run("unmarshal from stringified keys", func(t *testing.T) {
+				slot := map[int]string{}
+				checkUnmarshalling(t, atl, &slot, []Token{
+					{Type: TMapOpen, Length: 3},
+					TokStr("-2"), TokStr("b"),
+					TokStr("1"), TokStr("a"),
+					TokStr("10"), TokStr("c"),
+					{Type: TMapClose},
+				}, &value, nil)
+			})
+			t.Run("unmarshal rejects repeated keys", func(t *testing.T) {
+				slot := map[int]string{}
+				err := unmarshalWithOptions(t, atl, UnmarshalOptions{}, &slot, []Token{
+					{Type: TMapOpen, Length: 2},
+					TokInt(1), TokStr("a"),
+					TokStr("1"), TokStr("b"),
+					{Type: TMapClose},
+				})
+				Wish(t, err.Error(), ShouldEqual, "repeated key 1")
+			})
+		})
+		t.Run("prism to map[int8]string rejects overflow", func(t *testing.T) {
+			slot := map[int8]string{}
+			unmarshaller := NewUnmarshaller(atlas.MustBuild())
+			Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+			seq := []Token{{Type: TMapOpen, Length: 1}, TokInt(300)}
+			_, err := unmarshaller.Step(&seq[0])
+			Wish(t, err, ShouldEqual, nil)
+			_, err = unmarshaller.Step(&seq[1])
+			_, ok := err.(ErrUnmarshalTypeCantFit)
+			Wish(t, ok, ShouldEqual, true)
+		})
+	})
+	t.Run("tokens for map with uint and bool keys", func(t *testing.T) {
+		t.Run("prism to map[uint16]string", func(t *testing.T) {
+			atl := atlas.MustBuild()
+			seq := []Token{
+				{Type: TMapOpen, Length: 2},
+				{Type: TUint, Uint: 2}, TokStr("b"),
+				{Type: TUint, Uint: 9}, TokStr("a"),
+				{Type: TMapClose},
+			}
+			value := map[uint16]string{9: "a", 2: "b"}
+			t.Run("marshal", func(t *testing.T) {
+				checkMarshalling(t, atl, value, seq, nil)
+			})
+			t.Run("unmarshal", func(t *testing.T) {
+				slot := map[uint16]string{}
+				checkUnmarshalling(t, atl, &slot, seq, &value, nil)
+			})
+		})
+		t.Run("prism to map[bool]int", func(t *testing.T) {
+			atl := atlas.MustBuild()
+			seq := []Token{
+				{Type: TMapOpen, Length: 2},
+				{Type: TBool, Bool: false}, TokInt(0),
+				{Type: TBool, Bool: true}, TokInt(1),
+				{Type: TMapClose},
+			}
+			value := map[bool]int{true: 1, false: 0}
+			t.Run("marshal", func(t *testing.T) {
+				checkMarshalling(t, atl, value, seq, nil)
+			})
+			t.Run("unmarshal", func(t *testing.T) {
+				slot := map[bool]int{}
+				checkUnmarshalling(t, atl, &slot, seq, &value, nil)
+			})
+			t.Run("unmarshal from stringified keys", func(t *testing.T) {
+				slot := map[bool]int{}
+				checkUnmarshalling(t, atl, &slot, []Token{
+					{Type: TMapOpen, Length: 2},
+					TokStr("false"), TokInt(0),
+					TokStr("true"), TokInt(1),
+					{Type: TMapClose},
+				}, &value, nil)
+			})
+		})
+	})
+	t.Run("tokens for map with transformed int keys", func(t *testing.T) {
+		type Keyish struct {
+			N int
+		}
+		atl := atlas.MustBuild(
+			atlas.BuildEntry(Keyish{}).Transform().
+				TransformMarshal(atlas.MakeMarshalTransformFunc(
+					func(x Keyish) (int, error) {
+						return x.N, nil
+					})).
+				TransformUnmarshal(atlas.MakeUnmarshalTransformFunc(
+					func(x int) (Keyish, error) {
+						return Keyish{x}, nil
+					})).
+				Complete(),
+		)
+		seq := []Token{
+			{Type: TMapOpen, Length: 2},
+			TokInt(3), TokStr("a"),
+			TokInt(20), TokStr("b"),
+			{Type: TMapClose},
+		}
+		value := map[Keyish]string{{3}: "a", {20}: "b"}
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atl, value, seq, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			slot := map[Keyish]string{}
+			checkUnmarshalling(t, atl, &slot, seq, &value, nil)
+		})
+	})
+	t.Run("sort modes for int keys", func(t *testing.T) {
+		value := map[int]string{-1: "a", 24: "b", 3: "c", -30: "d"}
+		t.Run("default sorts numerically", func(t *testing.T) {
+			atl := atlas.MustBuild()
+			checkMarshalling(t, atl, value, []Token{
+				{Type: TMapOpen, Length: 4},
+				TokInt(-30), TokStr("d"),
+				TokInt(-1), TokStr("a"),
+				TokInt(3), TokStr("c"),
+				TokInt(24), TokStr("b"),
+				{Type: TMapClose},
+			}, nil)
+		})
+		t.Run("strings sorts by string form", func(t *testing.T) {
+			atl := atlas.MustBuild().WithMapMorphism(atlas.MapMorphism{atlas.KeySortMode_Strings})
+			checkMarshalling(t, atl, value, []Token{
+				{Type: TMapOpen, Length: 4},
+				TokInt(-1), TokStr("a"),
+				TokInt(-30), TokStr("d"),
+				TokInt(24), TokStr("b"),
+				TokInt(3), TokStr("c"),
+				{Type: TMapClose},
+			}, nil)
+		})
+		t.Run("rfc7049 sorts by encoded form", func(t *testing.T) {
+			atl := atlas.MustBuild().WithMapMorphism(atlas.MapMorphism{atlas.KeySortMode_RFC7049})
+			checkMarshalling(t, atl, value, []Token{
+				{Type: TMapOpen, Length: 4},
+				TokInt(3), TokStr("c"),
+				TokInt(-1), TokStr("a"),
+				TokInt(24), TokStr("b"),
+				TokInt(-30), TokStr("d"),
+				{Type: TMapClose},
+			}, nil)
+		})
+	})
 }
@@ -0,0 +1,222 @@
+package obj
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+type tLayer struct {
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+	Inner *tLayer
+}
+
+func TestMergeModes(t *testing.T) {
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(tLayer{}).StructMap().Autogenerate().Complete(),
+	)
+	base := func() tLayer {
+		return tLayer{
+			Name:  "base",
+			Tags:  []string{"a"},
+			Attrs: map[string]int{"x": 1, "y": 2},
+			Inner: &tLayer{Name: "inner", Tags: []string{"i"}},
+		}
+	}
+	override := []Token{
+		{Type: TMapOpen, Length: 3},
+		/**/ TokStr("tags"), {Type: TArrOpen, Length: 1}, TokStr("b"), {Type: TArrClose},
+		/**/ TokStr("attrs"), {Type: TMapOpen, Length: 2}, TokStr("y"), TokInt(20), TokStr("z"), TokInt(30), {Type: TMapClose},
+		/**/ TokStr("inner"), {Type: TMapOpen, Length: 1}, TokStr("tags"), {Type: TArrOpen, Length: 1}, TokStr("j"), {Type: TArrClose}, {Type: TMapClose},
+		{Type: TMapClose},
+	}
+	t.Run("struct", func(t *testing.T) {
+		t.Run("default rejects existing map keys", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{}, &slot, override)
+			Wish(t, err.Error(), ShouldEqual, `repeated key "y"`)
+		})
+		t.Run("replace", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Replace}, &slot, override)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, tLayer{
+				Tags:  []string{"b"},
+				Attrs: map[string]int{"y": 20, "z": 30},
+				Inner: &tLayer{Tags: []string{"j"}},
+			})
+		})
+		t.Run("deep", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Deep}, &slot, override)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, tLayer{
+				Name:  "base",
+				Tags:  []string{"b"},
+				Attrs: map[string]int{"x": 1, "y": 20, "z": 30},
+				Inner: &tLayer{Name: "inner", Tags: []string{"j"}},
+			})
+		})
+		t.Run("append", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Append}, &slot, override)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, tLayer{
+				Name:  "base",
+				Tags:  []string{"a", "b"},
+				Attrs: map[string]int{"x": 1, "y": 20, "z": 30},
+				Inner: &tLayer{Name: "inner", Tags: []string{"i", "j"}},
+			})
+		})
+		t.Run("reuse", func(t *testing.T) {
+			slot := base()
+			inner, attrs := slot.Inner, slot.Attrs
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Reuse}, &slot, override)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, tLayer{
+				Tags:  []string{"b"},
+				Attrs: map[string]int{"y": 20, "z": 30},
+				Inner: &tLayer{Tags: []string{"j"}},
+			})
+			Wish(t, slot.Inner == inner, ShouldEqual, true)
+			Wish(t, reflect.ValueOf(slot.Attrs).Pointer() == reflect.ValueOf(attrs).Pointer(), ShouldEqual, true)
+		})
+		t.Run("null still zeroes", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Deep}, &slot, []Token{
+				{Type: TMapOpen, Length: 1}, TokStr("inner"), {Type: TNull}, {Type: TMapClose},
+			})
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot.Inner, ShouldEqual, (*tLayer)(nil))
+		})
+	})
+	t.Run("map", func(t *testing.T) {
+		seq := []Token{
+			{Type: TMapOpen, Length: 2},
+			/**/ TokStr("a"), {Type: TMapOpen, Length: 1}, TokStr("q"), TokInt(9), {Type: TMapClose},
+			/**/ TokStr("c"), {Type: TMapOpen, Length: 0}, {Type: TMapClose},
+			{Type: TMapClose},
+		}
+		base := func() map[string]map[string]int {
+			return map[string]map[string]int{"a": {"p": 1}, "b": {"p": 2}}
+		}
+		t.Run("deep", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Deep}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, map[string]map[string]int{"a": {"p": 1, "q": 9}, "b": {"p": 2}, "c": {}})
+		})
+		t.Run("replace", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Replace}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, map[string]map[string]int{"a": {"q": 9}, "c": {}})
+		})
+		t.Run("deep still rejects keys repeated in the stream", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Deep}, &slot, []Token{
+				{Type: TMapOpen, Length: 2},
+				/**/ TokStr("a"), {Type: TNull},
+				/**/ TokStr("a"),
+			})
+			Wish(t, err.Error(), ShouldEqual, `repeated key "a"`)
+		})
+	})
+	t.Run("slice", func(t *testing.T) {
+		seq := []Token{{Type: TArrOpen, Length: 1}, TokInt(3), {Type: TArrClose}}
+		for _, tr := range []struct {
+			mode   MergeMode
+			expect []int
+		}{
+			{MergeMode_Default, []int{3}},
+			{MergeMode_Replace, []int{3}},
+			{MergeMode_Deep, []int{3}},
+			{MergeMode_Append, []int{1, 2, 3}},
+			{MergeMode_Reuse, []int{3}},
+		} {
+			slot := []int{1, 2}
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: tr.mode}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, tr.expect)
+		}
+	})
+	t.Run("array", func(t *testing.T) {
+		seq := []Token{{Type: TArrOpen, Length: 1}, TokInt(3), {Type: TArrClose}}
+		for _, mode := range []MergeMode{MergeMode_Default, MergeMode_Replace, MergeMode_Deep, MergeMode_Append} {
+			slot := [2]int{1, 2}
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: mode}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, [2]int{3, 0})
+		}
+	})
+	t.Run("wildcard", func(t *testing.T) {
+		seq := []Token{
+			{Type: TMapOpen, Length: 2},
+			/**/ TokStr("m"), {Type: TMapOpen, Length: 1}, TokStr("k2"), TokStr("v2"), {Type: TMapClose},
+			/**/ TokStr("l"), {Type: TArrOpen, Length: 1}, TokStr("e2"), {Type: TArrClose},
+			{Type: TMapClose},
+		}
+		base := func() interface{} {
+			return map[string]interface{}{
+				"m": map[string]interface{}{"k1": "v1"},
+				"l": []interface{}{"e1"},
+			}
+		}
+		t.Run("default", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, map[string]interface{}{
+				"m": map[string]interface{}{"k2": "v2"},
+				"l": []interface{}{"e2"},
+			})
+		})
+		t.Run("deep", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Deep}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, map[string]interface{}{
+				"m": map[string]interface{}{"k1": "v1", "k2": "v2"},
+				"l": []interface{}{"e2"},
+			})
+		})
+		t.Run("append", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{Merge: MergeMode_Append}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, map[string]interface{}{
+				"m": map[string]interface{}{"k1": "v1", "k2": "v2"},
+				"l": []interface{}{"e1", "e2"},
+			})
+		})
+	})
+	t.Run("ordered map", func(t *testing.T) {
+		seq := []Token{
+			{Type: TMapOpen, Length: 2},
+			/**/ TokStr("b"), {Type: TMapOpen, Length: 1}, TokStr("y"), TokInt(2), {Type: TMapClose},
+			/**/ TokStr("c"), TokInt(3),
+			{Type: TMapClose},
+		}
+		base := func() OrderedMap {
+			return OrderedMap{{"a", 1}, {"b", OrderedMap{{"x", 1}}}}
+		}
+		t.Run("default", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{OrderedMaps: true}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, OrderedMap{{"b", OrderedMap{{"y", 2}}}, {"c", 3}})
+		})
+		t.Run("deep", func(t *testing.T) {
+			slot := base()
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{OrderedMaps: true, Merge: MergeMode_Deep}, &slot, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, OrderedMap{{"a", 1}, {"b", OrderedMap{{"x", 1}, {"y", 2}}}, {"c", 3}})
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package obj
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestOrderedMapHandling(t *testing.T) {
+	seq := []Token{
+		{Type: TMapOpen, Length: 2},
+		/**/ TokStr("zed"), TokInt(1),
+		/**/ TokStr("alpha"), {Type: TMapOpen, Length: 2},
+		/**/ /**/ TokStr("y"), TokStr("why"),
+		/**/ /**/ TokStr("b"), TokStr("bee"),
+		/**/ {Type: TMapClose},
+		{Type: TMapClose},
+	}
+	t.Run("marshal keeps order", func(t *testing.T) {
+		value := OrderedMap{
+			{"zed", 1},
+			{"alpha", OrderedMap{{"y", "why"}, {"b", "bee"}}},
+		}
+		checkMarshalling(t, atlas.MustBuild(), value, seq, nil)
+	})
+	t.Run("marshal nil is null", func(t *testing.T) {
+		checkMarshalling(t, atlas.MustBuild(), OrderedMap(nil), []Token{{Type: TNull}}, nil)
+	})
+	t.Run("unmarshal into wildcard with option", func(t *testing.T) {
+		var slot interface{}
+		unmarshaller := NewUnmarshallerWithOptions(atlas.MustBuild(), UnmarshalOptions{OrderedMaps: true})
+		Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+		for _, tok := range seq {
+			_, err := unmarshaller.Step(&tok)
+			Wish(t, err, ShouldEqual, nil)
+		}
+		Wish(t, slot, ShouldEqual, OrderedMap{
+			{"zed", 1},
+			{"alpha", OrderedMap{{"y", "why"}, {"b", "bee"}}},
+		})
+	})
+	t.Run("unmarshal into wildcard without option", func(t *testing.T) {
+		var slot interface{}
+		expect := interface{}(map[string]interface{}{
+			"zed":   1,
+			"alpha": map[string]interface{}{"y": "why", "b": "bee"},
+		})
+		checkUnmarshalling(t, atlas.MustBuild(), &slot, seq, &expect, nil)
+	})
+	t.Run("as struct field", func(t *testing.T) {
+		type tDoc struct {
+			Name string
+			Meta OrderedMap
+		}
+		atl, err := atlas.Build(
+			atlas.BuildEntry(tDoc{}).StructMap().Autogenerate().Complete(),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		seq := []Token{
+			{Type: TMapOpen, Length: 2},
+			/**/ TokStr("name"), TokStr("doc"),
+			/**/ TokStr("meta"), {Type: TMapOpen, Length: 2},
+			/**/ /**/ TokStr("z"), TokStr("1"),
+			/**/ /**/ TokStr("a"), TokStr("2"),
+			/**/ {Type: TMapClose},
+			{Type: TMapClose},
+		}
+		value := tDoc{"doc", OrderedMap{{"z", "1"}, {"a", "2"}}}
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atl, value, seq, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			slot := tDoc{}
+			checkUnmarshalling(t, atl, &slot, seq, &value, nil)
+		})
+	})
+	t.Run("unmarshal rejects repeated keys", func(t *testing.T) {
+		slot := OrderedMap{}
+		unmarshaller := NewUnmarshaller(atlas.MustBuild())
+		Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+		seq := []Token{
+			{Type: TMapOpen, Length: 2},
+			TokStr("a"), TokInt(1),
+			TokStr("a"),
+		}
+		var err error
+		for _, tok := range seq {
+			if _, err = unmarshaller.Step(&tok); err != nil {
+				break
+			}
+		}
+		Wish(t, err.Error(), ShouldEqual, `repeated key "a"`)
+	})
+	t.Run("get and set", func(t *testing.T) {
+		m := OrderedMap{}
+		m.Set("b", 1)
+		m.Set("a", 2)
+		m.Set("b", 3)
+		Wish(t, m.Keys(), ShouldEqual, []string{"b", "a"})
+		v, ok := m.Get("b")
+		Wish(t, v, ShouldEqual, 3)
+		Wish(t, ok, ShouldEqual, true)
+		_, ok = m.Get("c")
+		Wish(t, ok, ShouldEqual, false)
+	})
+}
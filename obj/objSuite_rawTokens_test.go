@@ -0,0 +1,83 @@
+package obj
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestRawTokensHandling(t *testing.T) {
+	type tEnvelope struct {
+		Kind string
+		Body RawTokens
+	}
+	type tBody struct {
+		X string
+		Y []byte
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(tEnvelope{}).StructMap().Autogenerate().Complete(),
+		atlas.BuildEntry(tBody{}).StructMap().Autogenerate().Complete(),
+	)
+	body := []Token{
+		{Type: TMapOpen, Length: 2},
+		/**/ TokStr("x"), {Type: TString, Str: "foo", Tagged: true, Tag: 50},
+		/**/ TokStr("y"), {Type: TBytes, Bytes: []byte{1, 2}},
+		{Type: TMapClose},
+	}
+	seq := []Token{
+		{Type: TMapOpen, Length: 2},
+		/**/ TokStr("kind"), TokStr("body"),
+		/**/ TokStr("body"),
+	}
+	seq = append(seq, body...)
+	seq = append(seq, Token{Type: TMapClose})
+
+	t.Run("unmarshal captures the subtree", func(t *testing.T) {
+		slot := tEnvelope{}
+		expect := tEnvelope{"body", RawTokens(body)}
+		checkUnmarshalling(t, atl, &slot, seq, &expect, nil)
+	})
+	t.Run("unmarshal copies bytes", func(t *testing.T) {
+		buf := []byte{1, 2}
+		slot := RawTokens{}
+		checkUnmarshalling(t, atl, &slot, []Token{{Type: TBytes, Bytes: buf}}, &RawTokens{{Type: TBytes, Bytes: []byte{1, 2}}}, nil)
+		buf[0] = 9
+		Wish(t, slot[0].Bytes, ShouldEqual, []byte{1, 2})
+	})
+	t.Run("unmarshal captures scalars", func(t *testing.T) {
+		slot := RawTokens{}
+		checkUnmarshalling(t, atl, &slot, []Token{TokInt(4)}, &RawTokens{TokInt(4)}, nil)
+	})
+	t.Run("marshal emits the stored tokens", func(t *testing.T) {
+		value := tEnvelope{"body", RawTokens(body)}
+		checkMarshalling(t, atl, value, seq, nil)
+	})
+	t.Run("marshal of empty raw tokens is null", func(t *testing.T) {
+		checkMarshalling(t, atl, RawTokens(nil), []Token{{Type: TNull}}, nil)
+	})
+	t.Run("source pumps into an unmarshaller", func(t *testing.T) {
+		raw := RawTokens(body)
+		slot := tBody{}
+		unmarshaller := NewUnmarshaller(atl)
+		Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+		err := shared.TokenPump{raw.Source(), unmarshaller}.Run()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, slot, ShouldEqual, tBody{"foo", []byte{1, 2}})
+	})
+	t.Run("source errors when stepped past the end", func(t *testing.T) {
+		for _, raw := range []RawTokens{{TokStr("a")}, {}} {
+			src := raw.Source()
+			var tok Token
+			done, err := src.Step(&tok)
+			Wish(t, done, ShouldEqual, true)
+			Wish(t, err, ShouldEqual, nil)
+			_, err = src.Step(&tok)
+			Wish(t, err.Error(), ShouldEqual, "raw tokens already replayed to the end")
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package obj
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+type tNode struct {
+	Name string
+	Next *tNode
+}
+
+type tPair struct {
+	A *tNode
+	B *tNode
+}
+
+func marshalWithOptions(t *testing.T, atl atlas.Atlas, opts MarshalOptions, value interface{}) ([]Token, error) {
+	t.Helper()
+	marshaller := NewMarshallerWithOptions(atl, opts)
+	Wish(t, marshaller.Bind(value), ShouldEqual, nil)
+	var toks []Token
+	for len(toks) < 100 {
+		var tok Token
+		done, err := marshaller.Step(&tok)
+		if err != nil {
+			return toks, err
+		}
+		toks = append(toks, tok)
+		if done {
+			return toks, nil
+		}
+	}
+	t.Fatalf("marshaller did not finish")
+	return nil, nil
+}
+
+func unmarshalWithOptions(t *testing.T, atl atlas.Atlas, opts UnmarshalOptions, slot interface{}, seq []Token) error {
+	t.Helper()
+	unmarshaller := NewUnmarshallerWithOptions(atl, opts)
+	Wish(t, unmarshaller.Bind(slot), ShouldEqual, nil)
+	for i, tok := range seq {
+		done, err := unmarshaller.Step(&tok)
+		if err != nil {
+			return err
+		}
+		Wish(t, done, ShouldEqual, i == len(seq)-1)
+	}
+	return nil
+}
+
+func TestReferences(t *testing.T) {
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(tNode{}).StructMap().Autogenerate().Complete(),
+		atlas.BuildEntry(tPair{}).StructMap().Autogenerate().Complete(),
+	)
+	shareable := func(tok Token) Token {
+		tok.Tagged, tok.Tag = true, 28
+		return tok
+	}
+	sharedRef := func(idx uint64) Token {
+		return Token{Type: TUint, Uint: idx, Tagged: true, Tag: 29}
+	}
+
+	t.Run("cycles", func(t *testing.T) {
+		t.Run("of pointers are rejected", func(t *testing.T) {
+			a := &tNode{Name: "a"}
+			a.Next = &tNode{Name: "b", Next: a}
+			_, err := marshalWithOptions(t, atl, MarshalOptions{}, a)
+			Wish(t, err, ShouldEqual, ErrMarshalCycle{"/next/next", "", "*obj.tNode"})
+		})
+		t.Run("through maps are rejected", func(t *testing.T) {
+			m := map[string]interface{}{"x": 1}
+			m["y"] = []interface{}{"z", m}
+			_, err := marshalWithOptions(t, atl, MarshalOptions{}, m)
+			Wish(t, err, ShouldEqual, ErrMarshalCycle{"/y/1", "", "map[string]interface {}"})
+		})
+		t.Run("below the root are reported with both paths", func(t *testing.T) {
+			b := &tNode{Name: "b"}
+			b.Next = b
+			_, err := marshalWithOptions(t, atl, MarshalOptions{}, tPair{A: &tNode{}, B: b})
+			Wish(t, err, ShouldEqual, ErrMarshalCycle{"/b/next", "/b", "*obj.tNode"})
+			Wish(t, err.Error(), ShouldEqual, `marshal error: cycle detected: *obj.tNode at "/b/next" is already being marshalled at "/b"`)
+		})
+		t.Run("shared pointers without cycles are fine", func(t *testing.T) {
+			n := &tNode{Name: "n"}
+			toks, err := marshalWithOptions(t, atl, MarshalOptions{}, tPair{A: n, B: n})
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, len(toks), ShouldEqual, 16)
+		})
+	})
+
+	t.Run("value sharing", func(t *testing.T) {
+		t.Run("shared pointers", func(t *testing.T) {
+			n := &tNode{Name: "n"}
+			seq := []Token{
+				{Type: TMapOpen, Length: 2},
+				/**/ TokStr("a"), shareable(Token{Type: TMapOpen, Length: 2}),
+				/**/ /**/ TokStr("name"), TokStr("n"),
+				/**/ /**/ TokStr("next"), {Type: TNull},
+				/**/ {Type: TMapClose},
+				/**/ TokStr("b"), sharedRef(0),
+				{Type: TMapClose},
+			}
+			t.Run("marshal", func(t *testing.T) {
+				toks, err := marshalWithOptions(t, atl, MarshalOptions{ValueSharing: true}, tPair{A: n, B: n})
+				Wish(t, err, ShouldEqual, nil)
+				Wish(t, toks, ShouldEqual, seq)
+			})
+			t.Run("unmarshal", func(t *testing.T) {
+				var slot tPair
+				err := unmarshalWithOptions(t, atl, UnmarshalOptions{ValueSharing: true}, &slot, seq)
+				Wish(t, err, ShouldEqual, nil)
+				Wish(t, slot.A, ShouldEqual, n)
+				Wish(t, slot.A == slot.B, ShouldEqual, true)
+			})
+		})
+		t.Run("cycles", func(t *testing.T) {
+			seq := []Token{
+				shareable(Token{Type: TMapOpen, Length: 2}),
+				/**/ TokStr("name"), TokStr("a"),
+				/**/ TokStr("next"), shareable(Token{Type: TMapOpen, Length: 2}),
+				/**/ /**/ TokStr("name"), TokStr("b"),
+				/**/ /**/ TokStr("next"), sharedRef(0),
+				/**/ {Type: TMapClose},
+				{Type: TMapClose},
+			}
+			t.Run("marshal", func(t *testing.T) {
+				a := &tNode{Name: "a"}
+				a.Next = &tNode{Name: "b", Next: a}
+				toks, err := marshalWithOptions(t, atl, MarshalOptions{ValueSharing: true}, a)
+				Wish(t, err, ShouldEqual, nil)
+				Wish(t, toks, ShouldEqual, seq)
+			})
+			t.Run("unmarshal", func(t *testing.T) {
+				slot := &tNode{}
+				err := unmarshalWithOptions(t, atl, UnmarshalOptions{ValueSharing: true}, slot, seq)
+				Wish(t, err, ShouldEqual, nil)
+				Wish(t, slot.Name, ShouldEqual, "a")
+				Wish(t, slot.Next.Name, ShouldEqual, "b")
+				Wish(t, slot.Next.Next == slot, ShouldEqual, true)
+			})
+		})
+		t.Run("into interfaces", func(t *testing.T) {
+			var slot []interface{}
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{ValueSharing: true}, &slot, []Token{
+				{Type: TArrOpen, Length: 2},
+				/**/ shareable(TokStr("x")),
+				/**/ sharedRef(0),
+				{Type: TArrClose},
+			})
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, []interface{}{"x", "x"})
+		})
+		t.Run("dangling reference is rejected", func(t *testing.T) {
+			var slot tPair
+			err := unmarshalWithOptions(t, atl, UnmarshalOptions{ValueSharing: true}, &slot, []Token{
+				{Type: TMapOpen, Length: 1},
+				/**/ TokStr("a"), sharedRef(3),
+			})
+			Wish(t, err.Error(), ShouldEqual, "value sharing: reference to shared value 3, but only 0 have been seen")
+		})
+	})
+}
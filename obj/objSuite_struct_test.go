@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
 	"github.com/polydawn/refmt/tok/fixtures"
 )
 
@@ -221,4 +222,85 @@ func TestStructHandling(t *testing.T) {
 			})
 		})
 	})
+	t.Run("tokens for map with int keys", func(t *testing.T) {
+		type tClaims struct {
+			Iss  string `refmt:"1,keyasint"`
+			Sub  string `refmt:"2,keyasint"`
+			Exp  int    `refmt:"4,keyasint,omitempty"`
+			Note string
+		}
+		seq := []Token{
+			{Type: TMapOpen, Length: 3},
+			TokInt(1), TokStr("issuer"),
+			TokInt(2), TokStr("subject"),
+			TokStr("note"), TokStr("hi"),
+			{Type: TMapClose},
+		}
+		atl := atlas.MustBuild(
+			atlas.BuildEntry(tClaims{}).StructMap().Autogenerate().Complete(),
+		)
+		t.Run("marshal", func(t *testing.T) {
+			value := tClaims{"issuer", "subject", 0, "hi"}
+			checkMarshalling(t, atl, value, seq, nil)
+		})
+		t.Run("unmarshal", func(t *testing.T) {
+			slot := tClaims{}
+			expect := tClaims{"issuer", "subject", 0, "hi"}
+			checkUnmarshalling(t, atl, &slot, seq, &expect, nil)
+		})
+		t.Run("unmarshal from uint keys", func(t *testing.T) {
+			slot := tClaims{}
+			expect := tClaims{"issuer", "", 7, ""}
+			checkUnmarshalling(t, atl, &slot, []Token{
+				{Type: TMapOpen, Length: 2},
+				{Type: TUint, Uint: 1}, TokStr("issuer"),
+				{Type: TUint, Uint: 4}, TokInt(7),
+				{Type: TMapClose},
+			}, &expect, nil)
+		})
+		t.Run("unmarshal from stringified keys", func(t *testing.T) {
+			slot := tClaims{}
+			expect := tClaims{"issuer", "subject", 0, "hi"}
+			checkUnmarshalling(t, atl, &slot, []Token{
+				{Type: TMapOpen, Length: 3},
+				TokStr("1"), TokStr("issuer"),
+				TokStr("2"), TokStr("subject"),
+				TokStr("note"), TokStr("hi"),
+				{Type: TMapClose},
+			}, &expect, nil)
+		})
+		t.Run("unmarshal rejects unknown int keys", func(t *testing.T) {
+			slot := tClaims{}
+			checkUnmarshalling(t, atl, &slot, []Token{
+				{Type: TMapOpen, Length: 1},
+				TokInt(3),
+			}, &tClaims{}, ErrNoSuchField{"3", reflect.TypeOf(tClaims{}).String()})
+		})
+		t.Run("rfc7049 sorting puts int keys first", func(t *testing.T) {
+			atl := atlas.MustBuild(
+				atlas.BuildEntry(tClaims{}).StructMap().AutogenerateWithSortingScheme(atlas.KeySortMode_RFC7049).Complete(),
+			)
+			value := tClaims{"issuer", "subject", 0, "hi"}
+			checkMarshalling(t, atl, value, []Token{
+				{Type: TMapOpen, Length: 3},
+				TokInt(1), TokStr("issuer"),
+				TokInt(2), TokStr("subject"),
+				TokStr("note"), TokStr("hi"),
+				{Type: TMapClose},
+			}, nil)
+		})
+		t.Run("builder fills in serial name", func(t *testing.T) {
+			atl := atlas.MustBuild(
+				atlas.BuildEntry(tClaims{}).StructMap().
+					AddField("Iss", atlas.StructMapEntry{KeyAsInt: true, SerialInt: 1}).
+					Complete(),
+			)
+			value := tClaims{Iss: "issuer"}
+			checkMarshalling(t, atl, value, []Token{
+				{Type: TMapOpen, Length: 1},
+				TokInt(1), TokStr("issuer"),
+				{Type: TMapClose},
+			}, nil)
+		})
+	})
 }
@@ -3,6 +3,8 @@ package obj
 import (
 	"testing"
 
+	. "github.com/warpfork/go-wish"
+
 	"github.com/polydawn/refmt/obj/atlas"
 	. "github.com/polydawn/refmt/tok"
 )
@@ -46,4 +48,87 @@ func TestUnionHandling(t *testing.T) {
 		//   this is inevitable.. but the error messages here need work, because it's extremely easy to typo or just not know about this detail of Go.
 		//checkMarshalling(t, atl, value, seq, nil)
 	})
+	t.Run("hello union kinded", func(t *testing.T) {
+		type WowUnion interface{}
+		type WowRef string
+		type WowFull struct {
+			Name string
+			Tag  string
+		}
+		atl := atlas.MustBuild(
+			atlas.BuildEntry((*WowUnion)(nil)).KindedUnion().
+				Of(map[TokenType]*atlas.AtlasEntry{
+					TString:  atlas.BuildEntry(WowRef("")).Complete(),
+					TMapOpen: atlas.BuildEntry(WowFull{}).StructMap().Autogenerate().Complete(),
+				}),
+		)
+		t.Run("string member", func(t *testing.T) {
+			seq := []Token{
+				TokStr("alpine"),
+			}
+			t.Run("marshal", func(t *testing.T) {
+				var value WowUnion = WowRef("alpine")
+				checkMarshalling(t, atl, &value, seq, nil)
+			})
+			t.Run("unmarshal", func(t *testing.T) {
+				var slot WowUnion
+				var expect WowUnion = WowRef("alpine")
+				checkUnmarshalling(t, atl, &slot, seq, &expect, nil)
+			})
+		})
+		t.Run("map member", func(t *testing.T) {
+			seq := []Token{
+				{Type: TMapOpen, Length: 2},
+				/**/ TokStr("name"), TokStr("alpine"),
+				/**/ TokStr("tag"), TokStr("3.6"),
+				{Type: TMapClose},
+			}
+			t.Run("marshal", func(t *testing.T) {
+				var value WowUnion = WowFull{"alpine", "3.6"}
+				checkMarshalling(t, atl, &value, seq, nil)
+			})
+			t.Run("unmarshal", func(t *testing.T) {
+				var slot WowUnion
+				var expect WowUnion = WowFull{"alpine", "3.6"}
+				checkUnmarshalling(t, atl, &slot, seq, &expect, nil)
+			})
+		})
+		t.Run("unknown kind", func(t *testing.T) {
+			seq := []Token{
+				TokInt(4),
+			}
+			var slot WowUnion
+			unmarshaller := NewUnmarshaller(atl)
+			Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+			done, err := unmarshaller.Step(&seq[0])
+			Wish(t, done, ShouldEqual, true)
+			// Compare by string: the error contains reflect.Type, which doesn't diff well.
+			Wish(t, err.Error(), ShouldEqual, `unmarshal error: cannot unmarshal into union obj.WowUnion: "int" is not one of the known members (expected one of [map open string])`)
+		})
+	})
+	t.Run("union kinded with int member", func(t *testing.T) {
+		type WowUnion interface{}
+		atl := atlas.MustBuild(
+			atlas.BuildEntry((*WowUnion)(nil)).KindedUnion().
+				Of(map[TokenType]*atlas.AtlasEntry{
+					TInt: atlas.BuildEntry(int64(0)).Complete(),
+				}),
+		)
+		t.Run("uint tokens fall back to the int member", func(t *testing.T) {
+			var slot WowUnion
+			var expect WowUnion = int64(7)
+			checkUnmarshalling(t, atl, &slot, []Token{{Type: TUint, Uint: 7}}, &expect, nil)
+		})
+	})
+	t.Run("union kinded validation", func(t *testing.T) {
+		type WowUnion interface{}
+		type WowFull struct{ Name string }
+		_, err := atlas.Build(
+			atlas.BuildEntry((*WowUnion)(nil)).KindedUnion().
+				Of(map[TokenType]*atlas.AtlasEntry{
+					TString: atlas.BuildEntry(WowFull{}).StructMap().Autogenerate().Complete(),
+				}),
+		)
+		Wish(t, err == nil, ShouldEqual, false)
+	})
 }
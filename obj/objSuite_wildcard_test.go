@@ -0,0 +1,133 @@
+package obj
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+// Unmarshal the sequence into an `interface{}`, with the given options.
+func unmarshalWildcardWithOptions(t *testing.T, opts UnmarshalOptions, seq []Token) (interface{}, error) {
+	t.Helper()
+	var slot interface{}
+	unmarshaller := NewUnmarshallerWithOptions(atlas.MustBuild(), opts)
+	Wish(t, unmarshaller.Bind(&slot), ShouldEqual, nil)
+	for i, tok := range seq {
+		done, err := unmarshaller.Step(&tok)
+		if err != nil {
+			return slot, err
+		}
+		Wish(t, done, ShouldEqual, i == len(seq)-1)
+	}
+	return slot, nil
+}
+
+func TestWildcardOptions(t *testing.T) {
+	t.Run("numbers", func(t *testing.T) {
+		seq := []Token{
+			{Type: TArrOpen, Length: 3},
+			TokInt(-4),
+			{Type: TUint, Uint: 1<<64 - 1},
+			{Type: TFloat64, Float64: 1.5},
+			{Type: TArrClose},
+		}
+		t.Run("as float64", func(t *testing.T) {
+			slot, err := unmarshalWildcardWithOptions(t, UnmarshalOptions{Numbers: NumberMode_Float64}, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, []interface{}{float64(-4), float64(1<<64 - 1), 1.5})
+		})
+		t.Run("as literals", func(t *testing.T) {
+			slot, err := unmarshalWildcardWithOptions(t, UnmarshalOptions{Numbers: NumberMode_Literal}, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, []interface{}{Number("-4"), Number("18446744073709551615"), Number("1.5")})
+		})
+		t.Run("literals marshal back", func(t *testing.T) {
+			value := []interface{}{Number("-4"), Number("18446744073709551615"), Number("1.5")}
+			checkMarshalling(t, atlas.MustBuild(), value, seq, nil)
+		})
+		t.Run("literals as struct fields", func(t *testing.T) {
+			type tObj struct{ N Number }
+			atl := atlas.MustBuild(atlas.BuildEntry(tObj{}).StructMap().Autogenerate().Complete())
+			slot := tObj{}
+			checkUnmarshalling(t, atl, &slot, []Token{
+				{Type: TMapOpen, Length: 1},
+				TokStr("n"), {Type: TUint, Uint: 1<<64 - 1},
+				{Type: TMapClose},
+			}, &tObj{"18446744073709551615"}, nil)
+		})
+		t.Run("floats stay floats, at float64 precision", func(t *testing.T) {
+			seq := []Token{
+				{Type: TArrOpen, Length: 3},
+				{Type: TFloat64, Float64: 1.0},
+				{Type: TFloat64, Float64: 1e3},
+				{Type: TFloat64, Float64: 12345678901234567890123},
+				{Type: TArrClose},
+			}
+			slot, err := unmarshalWildcardWithOptions(t, UnmarshalOptions{Numbers: NumberMode_Literal}, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, []interface{}{Number("1.0"), Number("1000.0"), Number("1.2345678901234568e+22")})
+			checkMarshalling(t, atlas.MustBuild(), slot, seq, nil)
+		})
+	})
+	t.Run("maps with any keys", func(t *testing.T) {
+		seq := []Token{
+			{Type: TMapOpen, Length: 3},
+			{Type: TBool, Bool: true}, TokStr("t"),
+			TokInt(1), TokStr("one"),
+			TokStr("k"), TokStr("v"),
+			{Type: TMapClose},
+		}
+		value := map[interface{}]interface{}{true: "t", 1: "one", "k": "v"}
+		t.Run("unmarshal", func(t *testing.T) {
+			slot, err := unmarshalWildcardWithOptions(t, UnmarshalOptions{AnyKeyMaps: true}, seq)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, value)
+		})
+		t.Run("marshal", func(t *testing.T) {
+			checkMarshalling(t, atlas.MustBuild(), value, seq, nil)
+		})
+	})
+	t.Run("bytes as string", func(t *testing.T) {
+		slot, err := unmarshalWildcardWithOptions(t, UnmarshalOptions{BytesAsString: true}, []Token{{Type: TBytes, Bytes: []byte("abc")}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, slot, ShouldEqual, "abc")
+	})
+	t.Run("tag hook", func(t *testing.T) {
+		type tTagged struct {
+			Tag   int
+			Value interface{}
+		}
+		opts := UnmarshalOptions{TagHook: func(tag int, value interface{}) (interface{}, error) {
+			if tag == 99 {
+				return nil, fmt.Errorf("no thanks")
+			}
+			return tTagged{tag, value}, nil
+		}}
+		t.Run("on scalars", func(t *testing.T) {
+			slot, err := unmarshalWildcardWithOptions(t, opts, []Token{{Type: TString, Str: "x", Tagged: true, Tag: 42}})
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, tTagged{42, "x"})
+		})
+		t.Run("on maps", func(t *testing.T) {
+			slot, err := unmarshalWildcardWithOptions(t, opts, []Token{
+				{Type: TMapOpen, Length: 1, Tagged: true, Tag: 7},
+				TokStr("k"), TokStr("v"),
+				{Type: TMapClose},
+			})
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, slot, ShouldEqual, tTagged{7, map[string]interface{}{"k": "v"}})
+		})
+		t.Run("errors from the hook", func(t *testing.T) {
+			_, err := unmarshalWildcardWithOptions(t, opts, []Token{{Type: TString, Str: "x", Tagged: true, Tag: 99}})
+			Wish(t, err.Error(), ShouldEqual, "no thanks")
+		})
+		t.Run("without a hook, unknown tags are an error", func(t *testing.T) {
+			_, err := unmarshalWildcardWithOptions(t, UnmarshalOptions{}, []Token{{Type: TString, Str: "x", Tagged: true, Tag: 42}})
+			Wish(t, err.Error(), ShouldEqual, "missing an unmarshaller for tag 42")
+		})
+	})
+}
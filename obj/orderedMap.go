@@ -0,0 +1,68 @@
+package obj
+
+import (
+	"reflect"
+)
+
+/*
+	OrderedMap is a map which remembers the order of its entries.
+
+	Marshalling an OrderedMap emits its entries in order (no sorting is
+	applied); unmarshalling into one keeps the entries in the order they
+	appeared in the token stream.  This is useful for documents authored by
+	humans, where scrambling the key order on a round-trip would be rude.
+
+	OrderedMap can be used as a struct field type, or an Unmarshaller can be
+	configured to produce it for maps unmarshalled into an `interface{}`
+	(see UnmarshalOptions).  The values in an OrderedMap are unmarshalled as
+	if into an `interface{}`, so nested maps follow the same configuration.
+
+	Lookups are linear; an OrderedMap is meant for ordering, not for speed.
+*/
+type OrderedMap []OrderedMapEntry
+
+type OrderedMapEntry struct {
+	Key   string
+	Value interface{}
+}
+
+// Get returns the value for the key, and whether it was present.
+func (m OrderedMap) Get(key string) (interface{}, bool) {
+	if i := m.index(key); i >= 0 {
+		return m[i].Value, true
+	}
+	return nil, false
+}
+
+// Set replaces the value for the key in place if present; otherwise, it appends a new entry.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if i := m.index(key); i >= 0 {
+		(*m)[i].Value = value
+		return
+	}
+	*m = append(*m, OrderedMapEntry{key, value})
+}
+
+// Returns the index of the entry for the key, or -1 if there isn't one.
+func (m OrderedMap) index(key string) int {
+	for i, ent := range m {
+		if ent.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Keys returns the keys, in order.
+func (m OrderedMap) Keys() []string {
+	keys := make([]string, len(m))
+	for i, ent := range m {
+		keys[i] = ent.Key
+	}
+	return keys
+}
+
+var (
+	rt_orderedMap = reflect.TypeOf(OrderedMap{})
+	rt_iface      = reflect.TypeOf((*interface{})(nil)).Elem()
+)
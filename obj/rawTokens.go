@@ -0,0 +1,59 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	RawTokens holds a token subtree verbatim, for deferred decoding.
+
+	When a RawTokens is the target of unmarshalling, it captures the entire
+	subtree of tokens for that value (tags included) without interpreting it.
+	When marshalled, it emits the stored tokens exactly as they are.
+	This is handy for envelopes, where one field should be decoded later,
+	once the rest of the message says what it's supposed to be:
+	use Source to pump the tokens into any TokenSink (an Unmarshaller for
+	a concrete type, or an encoder for another format entirely).
+
+	An empty RawTokens is treated as null.
+
+	(In fact, any slice type with `tok.Token` elements gets this behavior.)
+*/
+type RawTokens []Token
+
+/*
+	Source returns a TokenSource which steps through the stored tokens.
+*/
+func (x RawTokens) Source() *RawTokensSource {
+	return &RawTokensSource{x, 0}
+}
+
+// RawTokensSource is a TokenSource yielding the tokens of a RawTokens.
+type RawTokensSource struct {
+	toks  RawTokens
+	index int
+}
+
+func (src *RawTokensSource) Step(fillme *Token) (done bool, err error) {
+	toks := src.toks
+	if len(toks) == 0 {
+		toks = rawTokensNull
+	}
+	if src.index >= len(toks) {
+		return true, fmt.Errorf("raw tokens already replayed to the end")
+	}
+	*fillme = toks[src.index]
+	src.index++
+	return src.index == len(toks), nil
+}
+
+// What an empty RawTokens yields.
+var rawTokensNull = RawTokens{{Type: TNull}}
+
+var (
+	rt_token     = reflect.TypeOf(Token{})
+	rt_rawTokens = reflect.TypeOf(RawTokens{})
+)
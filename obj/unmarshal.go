@@ -18,12 +18,21 @@ import (
 	again and making all of the machinery reusable without re-allocating.
 */
 func NewUnmarshaller(atl atlas.Atlas) *Unmarshaller {
+	return NewUnmarshallerWithOptions(atl, UnmarshalOptions{})
+}
+
+/*
+	Like NewUnmarshaller, but with options for the behaviors which the atlas
+	doesn't cover (such as what to produce when unmarshalling into an `interface{}`).
+*/
+func NewUnmarshallerWithOptions(atl atlas.Atlas, opts UnmarshalOptions) *Unmarshaller {
 	d := &Unmarshaller{
 		unmarshalSlab: unmarshalSlab{
 			atlas: atl,
 			rows:  make([]unmarshalSlabRow, 0, 10),
 		},
 		stack: make([]UnmarshalMachine, 0, 10),
+		opts:  opts,
 	}
 	return d
 }
@@ -39,6 +48,12 @@ func (d *Unmarshaller) Bind(v interface{}) error {
 	}
 	rv = rv.Elem() // Let's just always be addressible, shall we?
 	rt := rv.Type()
+	if d.opts.Merge == MergeMode_Replace {
+		rv.Set(reflect.Zero(rt))
+	}
+	d.shared = d.shared[0:0]
+	d.root_rv = rv
+	d.atRoot = d.opts.ValueSharing
 	d.step = d.unmarshalSlab.requisitionMachine(rt)
 	return d.step.Reset(&d.unmarshalSlab, rv, rt)
 }
@@ -47,6 +62,11 @@ type Unmarshaller struct {
 	unmarshalSlab unmarshalSlab
 	stack         []UnmarshalMachine
 	step          UnmarshalMachine
+	opts          UnmarshalOptions
+
+	shared  []reflect.Value // The shareable values seen so far (only if opts.ValueSharing).
+	root_rv reflect.Value   // The value we were bound to.
+	atRoot  bool            // Set until the first token (only if opts.ValueSharing).
 }
 
 type UnmarshalMachine interface {
@@ -55,6 +75,15 @@ type UnmarshalMachine interface {
 }
 
 func (d *Unmarshaller) Step(tok *Token) (bool, error) {
+	if d.atRoot {
+		d.atRoot = false
+		if tok.Tagged && tok.Tag == tagShareable {
+			untagged := *tok
+			untagged.Tagged = false
+			tok = &untagged
+			d.shared = append(d.shared, d.root_rv.Addr())
+		}
+	}
 	done, err := d.step.Step(d, &d.unmarshalSlab, tok)
 	// If the step errored: out, entirely.
 	if err != nil {
@@ -89,9 +118,20 @@ func (d *Unmarshaller) Step(tok *Token) (bool, error) {
 	In other words, your UnmarshalMachine calls this when it wants to deal
 	with an object, and by the time we call back to your machine again,
 	that object will be traversed and the stream ready for you to continue.
+
+	With value sharing, this is also where the sharing tags are handled:
+	a reference is resolved immediately (without recursing at all).
 */
 func (d *Unmarshaller) Recurse(tok *Token, rv reflect.Value, rt reflect.Type, nextMach UnmarshalMachine) (err error) {
 	//	fmt.Printf(">>> pushing into recursion with %#v\n", nextMach)
+	if d.opts.ValueSharing && tok.Tagged {
+		switch tok.Tag {
+		case tagSharedRef:
+			return d.resolveSharedRef(tok, rv)
+		case tagShareable:
+			return d.recurseShareable(tok, rv, rt, nextMach)
+		}
+	}
 	// Push the current machine onto the stack (we'll resume it when the new one is done),
 	d.stack = append(d.stack, d.step)
 	// Initialize the machine for this new target value.
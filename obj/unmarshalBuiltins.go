@@ -59,7 +59,7 @@ func (mach *unmarshalMachinePrimitive) Reset(_ *unmarshalSlab, rv reflect.Value,
 	mach.rv = rv
 	return nil
 }
-func (mach *unmarshalMachinePrimitive) Step(_ *Unmarshaller, _ *unmarshalSlab, tok *Token) (done bool, err error) {
+func (mach *unmarshalMachinePrimitive) Step(driver *Unmarshaller, _ *unmarshalSlab, tok *Token) (done bool, err error) {
 	switch mach.kind {
 	case reflect.Bool:
 		switch tok.Type {
@@ -151,23 +151,10 @@ func (mach *unmarshalMachinePrimitive) Step(_ *Unmarshaller, _ *unmarshalSlab, t
 			return true, ErrUnmarshalTypeCantFit{*tok, mach.rv, 0}
 		}
 	case reflect.Interface:
-		switch tok.Type {
-		case TString:
-			mach.rv.Set(reflect.ValueOf(tok.Str))
-		case TBytes:
-			mach.rv.Set(reflect.ValueOf(tok.Bytes))
-		case TBool:
-			mach.rv.Set(reflect.ValueOf(tok.Bool))
-		case TInt:
-			mach.rv.Set(reflect.ValueOf(int(tok.Int))) // Unmarshalling with no particular type info should default to using plain 'int' whenever viable.
-		case TUint:
-			mach.rv.Set(reflect.ValueOf(int(tok.Uint))) // Unmarshalling with no particular type info should default to using plain 'int' whenever viable.
-		case TFloat64:
-			mach.rv.Set(reflect.ValueOf(tok.Float64))
-		case TNull:
-			mach.rv.Set(reflect.ValueOf(nil))
-		default: // any of the other token types should not have been routed here to begin with.
-			panic(fmt.Errorf("unhandled: %v", mach.kind))
+		if v := driver.opts.wildcardScalar(tok); v != nil {
+			mach.rv.Set(reflect.ValueOf(v))
+		} else {
+			mach.rv.Set(reflect.Zero(mach.rv.Type()))
 		}
 		return true, nil
 	default:
@@ -0,0 +1,93 @@
+package obj
+
+import (
+	"fmt"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	UnmarshalEach decodes an array from the token source one element at a
+	time, calling fn with each element -- so huge arrays of records can be
+	processed without ever holding the whole `[]T` in memory.
+
+	The path says where the array is, as for shared.NewSelector: e.g.
+	"/items" or ".results[0].rows", or "" for an array at the root.
+	Everything that isn't on the path is skipped over without being
+	unmarshalled.  If the path has "[]" in it, each of the values it selects
+	is an element (so ".pages[].items[]" iterates over the items of every
+	page).  A null at the path counts as an empty array.
+
+	The same *T is passed to fn for every element, and each element is
+	unmarshalled into it with MergeMode_Reuse: so whatever memory the last
+	element left allocated (slices, maps, pointers' targets) is reused, and
+	if you want to keep an element (or anything in it) around past the call,
+	deep copy it.  If fn returns an error, iteration stops, and that error
+	is returned.
+
+	UnmarshalEach stops reading from src as soon as the array is closed;
+	anything after it in the stream is left unread.
+*/
+func UnmarshalEach[T any](src shared.TokenSource, atl atlas.Atlas, path string, fn func(*T) error) error {
+	return UnmarshalEachWithOptions(src, atl, UnmarshalOptions{}, path, fn)
+}
+
+/*
+	UnmarshalEachWithOptions is UnmarshalEach, with UnmarshalOptions for
+	the elements.  The options' Merge mode is ignored: elements are always
+	unmarshalled with MergeMode_Reuse.
+*/
+func UnmarshalEachWithOptions[T any](src shared.TokenSource, atl atlas.Atlas, opts UnmarshalOptions, path string, fn func(*T) error) error {
+	sel, err := shared.NewSelector(src, path)
+	if err != nil {
+		return err
+	}
+	r := shared.NewTokenReader(sel)
+	var tok Token
+
+	// The selector gets us to the array.
+	if err := r.Next(&tok); err != nil {
+		return err
+	}
+	switch tok.Type {
+	case TArrOpen:
+		// Good.
+	case TNull:
+		return nil
+	default:
+		return fmt.Errorf("cannot iterate at path %q: expected an array, got %s", path, tok.Type)
+	}
+
+	// Iterate.
+	opts.Merge = MergeMode_Reuse
+	var elem T
+	unmarshaller := NewUnmarshallerWithOptions(atl, opts)
+	for {
+		if err := r.Next(&tok); err != nil {
+			return err
+		}
+		if tok.Type == TArrClose {
+			return nil
+		}
+		if err := unmarshaller.Bind(&elem); err != nil {
+			return err
+		}
+		for {
+			done, err := unmarshaller.Step(&tok)
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+			if err := r.Next(&tok); err != nil {
+				return err
+			}
+		}
+		if err := fn(&elem); err != nil {
+			return err
+		}
+	}
+}
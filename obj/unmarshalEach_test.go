@@ -0,0 +1,156 @@
+package obj
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestUnmarshalEach(t *testing.T) {
+	type tRecord struct {
+		Id   int
+		Tags []string
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(tRecord{}).StructMap().Autogenerate().Complete(),
+	)
+	records := RawTokens{
+		{Type: TArrOpen, Length: 2},
+		/**/ {Type: TMapOpen, Length: 2},
+		/**/ /**/ TokStr("id"), TokInt(1),
+		/**/ /**/ TokStr("tags"), {Type: TArrOpen, Length: 1}, TokStr("a"), {Type: TArrClose},
+		/**/ {Type: TMapClose},
+		/**/ {Type: TMapOpen, Length: 1},
+		/**/ /**/ TokStr("id"), TokInt(2),
+		/**/ {Type: TMapClose},
+		{Type: TArrClose},
+	}
+	collect := func(src RawTokens, path string) ([]tRecord, error) {
+		var got []tRecord
+		err := UnmarshalEach(src.Source(), atl, path, func(rec *tRecord) error {
+			got = append(got, *rec)
+			return nil
+		})
+		return got, err
+	}
+	t.Run("at root", func(t *testing.T) {
+		got, err := collect(records, "")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, got, ShouldEqual, []tRecord{{1, []string{"a"}}, {2, nil}})
+	})
+	t.Run("at a path", func(t *testing.T) {
+		envelope := RawTokens{
+			{Type: TMapOpen, Length: 3},
+			/**/ TokStr("skipme"), {Type: TArrOpen, Length: 1}, {Type: TMapOpen, Length: 0}, {Type: TMapClose}, {Type: TArrClose},
+			/**/ TokStr("items"),
+		}
+		envelope = append(envelope, records...)
+		envelope = append(envelope, TokStr("trailer"), TokStr("never read"), Token{Type: TMapClose})
+		got, err := collect(envelope, "/items")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, got, ShouldEqual, []tRecord{{1, []string{"a"}}, {2, nil}})
+	})
+	t.Run("at an array index", func(t *testing.T) {
+		nested := RawTokens{{Type: TArrOpen, Length: 2}, TokStr("skipme")}
+		nested = append(nested, records...)
+		nested = append(nested, Token{Type: TArrClose})
+		got, err := collect(nested, "/1")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, got, ShouldEqual, []tRecord{{1, []string{"a"}}, {2, nil}})
+	})
+	t.Run("at a jq-ish path", func(t *testing.T) {
+		pages := RawTokens{
+			{Type: TArrOpen, Length: 2},
+			/**/ {Type: TMapOpen, Length: 1}, TokStr("items"),
+		}
+		pages = append(pages, records...)
+		pages = append(pages,
+			/**/ Token{Type: TMapClose},
+			/**/ Token{Type: TMapOpen, Length: 1}, TokStr("items"), Token{Type: TArrOpen, Length: 0}, Token{Type: TArrClose}, Token{Type: TMapClose},
+			Token{Type: TArrClose},
+		)
+		got, err := collect(pages, ".[0].items")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, got, ShouldEqual, []tRecord{{1, []string{"a"}}, {2, nil}})
+		got, err = collect(pages, ".[].items[]")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, got, ShouldEqual, []tRecord{{1, []string{"a"}}, {2, nil}})
+	})
+	t.Run("missing path", func(t *testing.T) {
+		_, err := collect(RawTokens{{Type: TMapOpen, Length: 0}, {Type: TMapClose}}, "/items")
+		Wish(t, err.Error(), ShouldEqual, `cannot select "/items" at "/items": no such key`)
+	})
+	t.Run("paths in errors stay escaped", func(t *testing.T) {
+		_, err := collect(RawTokens{
+			{Type: TMapOpen, Length: 1},
+			/**/ TokStr("a/b"), {Type: TMapOpen, Length: 0}, {Type: TMapClose},
+			{Type: TMapClose},
+		}, "/a~1b/c~0d")
+		Wish(t, err.Error(), ShouldEqual, `cannot select "/a~1b/c~0d" at "/a~1b/c~0d": no such key`)
+	})
+	t.Run("array indexes must be canonical", func(t *testing.T) {
+		_, err := collect(records, "/01")
+		Wish(t, err.Error(), ShouldEqual, `cannot select "/01" at "/01": not an array index`)
+	})
+	t.Run("not an array", func(t *testing.T) {
+		_, err := collect(RawTokens{TokStr("x")}, "")
+		Wish(t, err.Error(), ShouldEqual, `cannot iterate at path "": expected an array, got string`)
+	})
+	t.Run("element memory is reused", func(t *testing.T) {
+		seq := RawTokens{
+			{Type: TArrOpen, Length: 3},
+			/**/ {Type: TMapOpen, Length: 2},
+			/**/ /**/ TokStr("id"), TokInt(1),
+			/**/ /**/ TokStr("tags"), {Type: TArrOpen, Length: 2}, TokStr("a"), TokStr("b"), {Type: TArrClose},
+			/**/ {Type: TMapClose},
+			/**/ {Type: TMapOpen, Length: 1},
+			/**/ /**/ TokStr("tags"), {Type: TArrOpen, Length: 1}, TokStr("c"), {Type: TArrClose},
+			/**/ {Type: TMapClose},
+			/**/ {Type: TMapOpen, Length: 1},
+			/**/ /**/ TokStr("id"), TokInt(3),
+			/**/ {Type: TMapClose},
+			{Type: TArrClose},
+		}
+		var got []tRecord
+		var backing []*string
+		err := UnmarshalEach(seq.Source(), atl, "", func(rec *tRecord) error {
+			got = append(got, tRecord{rec.Id, append([]string(nil), rec.Tags...)})
+			if len(rec.Tags) > 0 {
+				backing = append(backing, &rec.Tags[0])
+			}
+			return nil
+		})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, got, ShouldEqual, []tRecord{{1, []string{"a", "b"}}, {0, []string{"c"}}, {3, nil}})
+		Wish(t, len(backing), ShouldEqual, 2)
+		Wish(t, backing[0] == backing[1], ShouldEqual, true)
+	})
+	t.Run("with options", func(t *testing.T) {
+		seq := RawTokens{
+			{Type: TArrOpen, Length: 2},
+			/**/ TokInt(1),
+			/**/ TokStr("x"),
+			{Type: TArrClose},
+		}
+		var got []interface{}
+		err := UnmarshalEachWithOptions(seq.Source(), atl, UnmarshalOptions{Numbers: NumberMode_Float64}, "", func(v *interface{}) error {
+			got = append(got, *v)
+			return nil
+		})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, got, ShouldEqual, []interface{}{float64(1), "x"})
+	})
+	t.Run("errors from the callback stop iteration", func(t *testing.T) {
+		n := 0
+		err := UnmarshalEach(records.Source(), atl, "", func(rec *tRecord) error {
+			n++
+			return fmt.Errorf("stop")
+		})
+		Wish(t, err.Error(), ShouldEqual, "stop")
+		Wish(t, n, ShouldEqual, 1)
+	})
+}
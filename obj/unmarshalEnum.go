@@ -0,0 +1,51 @@
+package obj
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+type unmarshalMachineEnum struct {
+	cfg *atlas.AtlasEntry // set on initialization
+
+	rv reflect.Value
+}
+
+func (mach *unmarshalMachineEnum) Reset(_ *unmarshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.rv = rv
+	return nil
+}
+
+func (mach *unmarshalMachineEnum) Step(_ *Unmarshaller, _ *unmarshalSlab, tok *Token) (done bool, err error) {
+	cfg := mach.cfg.EnumMorphism
+	var serial interface{}
+	var serialStr string
+	switch {
+	case tok.Type == TString && cfg.SerialType == TString:
+		serial = tok.Str
+		serialStr = tok.Str
+	case tok.Type == TInt && cfg.SerialType == TInt:
+		serial = tok.Int
+		serialStr = strconv.FormatInt(tok.Int, 10)
+	case tok.Type == TUint && cfg.SerialType == TInt:
+		serial = int64(tok.Uint)
+		serialStr = strconv.FormatUint(tok.Uint, 10)
+		if tok.Uint > 1<<63-1 {
+			serial = nil // can't be a member; but may still hit the fallback.
+		}
+	default:
+		return true, ErrUnmarshalTypeCantFit{*tok, mach.rv, 0}
+	}
+	live_rv, ok := cfg.Lives[serial]
+	if !ok {
+		if !cfg.Fallback.IsValid() {
+			return true, ErrNoSuchEnumMember{serialStr, mach.cfg.Type, cfg.KnownMembers}
+		}
+		live_rv = cfg.Fallback
+	}
+	mach.rv.Set(live_rv)
+	return true, nil
+}
@@ -0,0 +1,61 @@
+package obj
+
+import (
+	"encoding"
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	An UnmarshalMachine for types implementing Unmarshaler,
+	encoding.TextUnmarshaler, or encoding.BinaryUnmarshaler.
+
+	For Unmarshaler, the token subtree is captured (as with RawTokens),
+	then handed to the hook all at once.
+*/
+type unmarshalMachineHooks struct {
+	kind hookKind // set on initialization
+
+	target_rv reflect.Value
+	capture   unmarshalMachineRawTokens
+	toks      RawTokens
+}
+
+func (mach *unmarshalMachineHooks) Reset(slab *unmarshalSlab, rv reflect.Value, rt reflect.Type) error {
+	mach.target_rv = rv
+	mach.toks = nil
+	return mach.capture.Reset(slab, reflect.ValueOf(&mach.toks).Elem(), rt_rawTokens)
+}
+
+func (mach *unmarshalMachineHooks) Step(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+	switch mach.kind {
+	case hookKind_refmt:
+		done, err = mach.capture.Step(driver, slab, tok)
+		if !done || err != nil {
+			return done, err
+		}
+		return true, mach.target_rv.Addr().Interface().(Unmarshaler).UnmarshalRefmt(mach.toks)
+	case hookKind_text:
+		switch tok.Type {
+		case TNull:
+			mach.target_rv.Set(reflect.Zero(mach.target_rv.Type()))
+			return true, nil
+		case TString:
+			return true, mach.target_rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(tok.Str))
+		default:
+			return true, ErrUnmarshalTypeCantFit{*tok, mach.target_rv, 0}
+		}
+	case hookKind_binary:
+		switch tok.Type {
+		case TNull:
+			mach.target_rv.Set(reflect.Zero(mach.target_rv.Type()))
+			return true, nil
+		case TBytes:
+			return true, mach.target_rv.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(tok.Bytes)
+		default:
+			return true, ErrUnmarshalTypeCantFit{*tok, mach.target_rv, 0}
+		}
+	}
+	panic("unreachable")
+}
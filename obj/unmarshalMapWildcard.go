@@ -2,67 +2,83 @@ package obj
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
 
 	"github.com/polydawn/refmt/obj/atlas"
 	. "github.com/polydawn/refmt/tok"
 )
 
-type unmarshalMachineMapStringWildcard struct {
-	target_rv     reflect.Value                // Handle to the map.  Can set to zero, or set k=v pairs into, etc.
-	value_rt      reflect.Type                 // Type info for map values (cached for convenience in recurse calls).
-	valueMach     UnmarshalMachine             // Machine for map values.
-	valueZero_rv  reflect.Value                // Cached instance of the zero value of the value type, for re-zeroing tmp_rv.
-	key_rv        reflect.Value                // Addressable handle to a slot for keys to unmarshal into.
-	keyDestringer atlas.UnmarshalTransformFunc // Transform str->foo, to be used if keys are not plain strings.
-	tmp_rv        reflect.Value                // Addressable handle to a slot for values to unmarshal into.
-	phase         unmarshalMachineMapStringWildcardPhase
+type unmarshalMachineMapWildcard struct {
+	target_rv      reflect.Value                // Handle to the map.  Can set to zero, or set k=v pairs into, etc.
+	value_rt       reflect.Type                 // Type info for map values (cached for convenience in recurse calls).
+	valueMach      UnmarshalMachine             // Machine for map values.
+	valueZero_rv   reflect.Value                // Cached instance of the zero value of the value type, for re-zeroing tmp_rv.
+	key_rv         reflect.Value                // Addressable handle to a slot for keys to unmarshal into.
+	keyTransformer atlas.UnmarshalTransformFunc // Transform from the serial form of the key, to be used if keys are of a type with a transform.
+	keySerial_rv   reflect.Value                // Addressable handle to a slot for the serial form of keys, if keyTransformer is set.
+	keyEnum        *atlas.EnumMorphism          // Set if the keys are of a type with an enum morphism.
+	tmp_rv         reflect.Value                // Addressable handle to a slot for values to unmarshal into.
+	seen           map[interface{}]struct{}     // Keys from the stream so far, for rejecting repeats; only used when merging into a non-empty map.
+	phase          unmarshalMachineMapWildcardPhase
 }
 
-type unmarshalMachineMapStringWildcardPhase uint8
+type unmarshalMachineMapWildcardPhase uint8
 
 const (
-	unmarshalMachineMapStringWildcardPhase_initial          unmarshalMachineMapStringWildcardPhase = iota
-	unmarshalMachineMapStringWildcardPhase_acceptKeyOrClose                                        // doesn't commit prev value
-	unmarshalMachineMapStringWildcardPhase_acceptValue
-	unmarshalMachineMapStringWildcardPhase_acceptAnotherKeyOrClose
+	unmarshalMachineMapWildcardPhase_initial          unmarshalMachineMapWildcardPhase = iota
+	unmarshalMachineMapWildcardPhase_acceptKeyOrClose                                  // doesn't commit prev value
+	unmarshalMachineMapWildcardPhase_acceptValue
+	unmarshalMachineMapWildcardPhase_acceptAnotherKeyOrClose
 )
 
-func (mach *unmarshalMachineMapStringWildcard) Reset(slab *unmarshalSlab, rv reflect.Value, rt reflect.Type) error {
+func (mach *unmarshalMachineMapWildcard) Reset(slab *unmarshalSlab, rv reflect.Value, rt reflect.Type) error {
 	mach.target_rv = rv
 	mach.value_rt = rt.Elem()
 	mach.valueMach = slab.requisitionMachine(mach.value_rt)
 	mach.valueZero_rv = reflect.Zero(mach.value_rt)
 	key_rt := rt.Key()
 	mach.key_rv = reflect.New(key_rt).Elem()
-	if mach.key_rv.Kind() != reflect.String {
-		rtid := reflect.ValueOf(key_rt).Pointer()
-		atlEnt, ok := slab.atlas.Get(rtid)
-		if !ok || atlEnt.UnmarshalTransformTargetType == nil || atlEnt.UnmarshalTransformTargetType.Kind() != reflect.String {
-			return fmt.Errorf("unsupported map key type %q (if you want to use struct keys, your atlas needs a transform from string)", key_rt.Name())
+	mach.keyTransformer = nil
+	mach.keyEnum = nil
+	rtid := reflect.ValueOf(key_rt).Pointer()
+	if atlEnt, ok := slab.atlas.Get(rtid); ok {
+		switch {
+		case atlEnt.UnmarshalTransformFunc != nil:
+			if !isMapKeyKind(atlEnt.UnmarshalTransformTargetType.Kind()) {
+				return fmt.Errorf("unsupported map key type %q (if you want to use struct keys, your atlas needs a transform from string, int, uint, or bool)", key_rt.Name())
+			}
+			mach.keyTransformer = atlEnt.UnmarshalTransformFunc
+			mach.keySerial_rv = reflect.New(atlEnt.UnmarshalTransformTargetType).Elem()
+		case atlEnt.EnumMorphism != nil:
+			mach.keyEnum = atlEnt.EnumMorphism
 		}
-		mach.keyDestringer = atlEnt.UnmarshalTransformFunc
+	}
+	if mach.keyTransformer == nil && mach.keyEnum == nil && !isMapKeyKind(key_rt.Kind()) && key_rt.Kind() != reflect.Interface {
+		return fmt.Errorf("unsupported map key type %q (if you want to use struct keys, your atlas needs a transform from string, int, uint, or bool)", key_rt.Name())
 	}
 	mach.tmp_rv = reflect.New(mach.value_rt).Elem()
-	mach.phase = unmarshalMachineMapStringWildcardPhase_initial
+	mach.seen = nil
+	mach.phase = unmarshalMachineMapWildcardPhase_initial
 	return nil
 }
 
-func (mach *unmarshalMachineMapStringWildcard) Step(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+func (mach *unmarshalMachineMapWildcard) Step(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
 	switch mach.phase {
-	case unmarshalMachineMapStringWildcardPhase_initial:
+	case unmarshalMachineMapWildcardPhase_initial:
 		return mach.step_Initial(driver, slab, tok)
-	case unmarshalMachineMapStringWildcardPhase_acceptKeyOrClose:
+	case unmarshalMachineMapWildcardPhase_acceptKeyOrClose:
 		return mach.step_AcceptKeyOrClose(driver, slab, tok)
-	case unmarshalMachineMapStringWildcardPhase_acceptValue:
+	case unmarshalMachineMapWildcardPhase_acceptValue:
 		return mach.step_AcceptValue(driver, slab, tok)
-	case unmarshalMachineMapStringWildcardPhase_acceptAnotherKeyOrClose:
+	case unmarshalMachineMapWildcardPhase_acceptAnotherKeyOrClose:
 		return mach.step_AcceptAnotherKeyOrClose(driver, slab, tok)
 	}
 	panic("unreachable")
 }
 
-func (mach *unmarshalMachineMapStringWildcard) step_Initial(_ *Unmarshaller, _ *unmarshalSlab, tok *Token) (done bool, err error) {
+func (mach *unmarshalMachineMapWildcard) step_Initial(driver *Unmarshaller, _ *unmarshalSlab, tok *Token) (done bool, err error) {
 	// If it's a special state, start an object.
 	//  (Or, blow up if its a special state that's silly).
 	switch tok.Type {
@@ -71,10 +87,19 @@ func (mach *unmarshalMachineMapStringWildcard) step_Initial(_ *Unmarshaller, _ *
 		return true, nil
 	case TMapOpen:
 		// Great.  Consumed.
-		mach.phase = unmarshalMachineMapStringWildcardPhase_acceptKeyOrClose
+		mach.phase = unmarshalMachineMapWildcardPhase_acceptKeyOrClose
 		// Initialize the map if it's nil.
+		//  If we're merging into existing entries, keys from the stream may
+		//  coincide with those, so we have to track repeats separately.
+		//  If we're reusing the map, it's emptied instead.
 		if mach.target_rv.IsNil() {
 			mach.target_rv.Set(reflect.MakeMap(mach.target_rv.Type()))
+		} else if driver.opts.Merge.merges() && mach.target_rv.Len() > 0 {
+			mach.seen = make(map[interface{}]struct{})
+		} else if driver.opts.Merge == MergeMode_Reuse {
+			for _, k := range mach.target_rv.MapKeys() {
+				mach.target_rv.SetMapIndex(k, reflect.Value{})
+			}
 		}
 		return false, nil
 	case TMapClose:
@@ -88,7 +113,7 @@ func (mach *unmarshalMachineMapStringWildcard) step_Initial(_ *Unmarshaller, _ *
 	}
 }
 
-func (mach *unmarshalMachineMapStringWildcard) step_AcceptKeyOrClose(_ *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+func (mach *unmarshalMachineMapWildcard) step_AcceptKeyOrClose(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
 	// Switch on tokens.
 	switch tok.Type {
 	case TMapOpen:
@@ -102,36 +127,182 @@ func (mach *unmarshalMachineMapStringWildcard) step_AcceptKeyOrClose(_ *Unmarsha
 		return true, nil
 	case TArrClose:
 		return true, fmt.Errorf("unexpected arrClose; expected map key")
-	case TString:
-		if mach.keyDestringer != nil {
-			key_rv, err := mach.keyDestringer(reflect.ValueOf(tok.Str))
-			if err != nil {
-				return true, fmt.Errorf("unsupported map key type %q: errors in stringifying: %s", mach.key_rv.Type().Name(), err)
-			}
-			mach.key_rv.Set(key_rv)
-		} else {
-			mach.key_rv.SetString(tok.Str)
+	case TString, TInt, TUint, TBool:
+		if err = mach.loadKey(driver, tok); err != nil {
+			return true, err
 		}
 		if err = mach.mustAcceptKey(mach.key_rv); err != nil {
 			return true, err
 		}
-		mach.phase = unmarshalMachineMapStringWildcardPhase_acceptValue
+		mach.phase = unmarshalMachineMapWildcardPhase_acceptValue
 		return false, nil
 	default:
-		return true, fmt.Errorf("unexpected token %s; expected key string or end of map", tok)
+		return true, fmt.Errorf("unexpected token %s; expected map key or end of map", tok)
+	}
+}
+
+// Set the key slot from the token, going through the key transform or enum if necessary.
+func (mach *unmarshalMachineMapWildcard) loadKey(driver *Unmarshaller, tok *Token) error {
+	switch {
+	case mach.keyTransformer != nil:
+		if err := setMapKeyFromToken(driver, tok, mach.keySerial_rv); err != nil {
+			return err
+		}
+		key_rv, err := mach.keyTransformer(mach.keySerial_rv)
+		if err != nil {
+			return fmt.Errorf("unsupported map key type %q: errors in transforming: %s", mach.key_rv.Type().Name(), err)
+		}
+		mach.key_rv.Set(key_rv)
+		return nil
+	case mach.keyEnum != nil:
+		var serial interface{}
+		switch {
+		case tok.Type == TString && mach.keyEnum.SerialType == TString:
+			serial = tok.Str
+		case tok.Type == TInt && mach.keyEnum.SerialType == TInt:
+			serial = tok.Int
+		case tok.Type == TUint && mach.keyEnum.SerialType == TInt:
+			serial = int64(tok.Uint)
+		case tok.Type == TString && mach.keyEnum.SerialType == TInt:
+			i, err := strconv.ParseInt(tok.Str, 10, 64)
+			if err != nil {
+				return ErrUnmarshalTypeCantFit{*tok, mach.key_rv, 0}
+			}
+			serial = i
+		default:
+			return ErrUnmarshalTypeCantFit{*tok, mach.key_rv, 0}
+		}
+		live_rv, ok := mach.keyEnum.Lives[serial]
+		if !ok {
+			if !mach.keyEnum.Fallback.IsValid() {
+				return ErrNoSuchEnumMember{fmt.Sprint(serial), mach.key_rv.Type(), mach.keyEnum.KnownMembers}
+			}
+			live_rv = mach.keyEnum.Fallback
+		}
+		mach.key_rv.Set(live_rv)
+		return nil
+	default:
+		return setMapKeyFromToken(driver, tok, mach.key_rv)
+	}
+}
+
+/*
+	Set a map key of string, int, uint, or bool kind from a token.
+
+	Tokens of the matching kind are accepted, and so are strings which parse
+	as the matching kind (json, for example, can only have string keys, so
+	this is how other kinds of keys are round-tripped through it).
+
+	Keys of interface kind take whatever the token is, the same way
+	any other `interface{}` would.
+*/
+func setMapKeyFromToken(driver *Unmarshaller, tok *Token, key_rv reflect.Value) error {
+	switch key_rv.Kind() {
+	case reflect.Interface:
+		key_rv.Set(reflect.ValueOf(driver.opts.wildcardScalar(tok)))
+		return nil
+	case reflect.String:
+		if tok.Type != TString {
+			return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+		}
+		key_rv.SetString(tok.Str)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch tok.Type {
+		case TInt:
+			i = tok.Int
+		case TUint:
+			if tok.Uint > math.MaxInt64 {
+				return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+			}
+			i = int64(tok.Uint)
+		case TString:
+			var err error
+			if i, err = strconv.ParseInt(tok.Str, 10, 64); err != nil {
+				return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+			}
+		default:
+			return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+		}
+		if key_rv.OverflowInt(i) {
+			return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+		}
+		key_rv.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch tok.Type {
+		case TUint:
+			u = tok.Uint
+		case TInt:
+			if tok.Int < 0 {
+				return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+			}
+			u = uint64(tok.Int)
+		case TString:
+			var err error
+			if u, err = strconv.ParseUint(tok.Str, 10, 64); err != nil {
+				return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+			}
+		default:
+			return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+		}
+		if key_rv.OverflowUint(u) {
+			return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+		}
+		key_rv.SetUint(u)
+		return nil
+	case reflect.Bool:
+		switch tok.Type {
+		case TBool:
+			key_rv.SetBool(tok.Bool)
+		case TString:
+			b, err := strconv.ParseBool(tok.Str)
+			if err != nil || (tok.Str != "true" && tok.Str != "false") {
+				return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+			}
+			key_rv.SetBool(b)
+		default:
+			return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+		}
+		return nil
+	default:
+		return ErrUnmarshalTypeCantFit{*tok, key_rv, 0}
+	}
+}
+
+// For error messages: string keys quoted, others (ints, bools, etc) as-is.
+func describeMapKey(key_rv reflect.Value) string {
+	if key_rv.Kind() == reflect.String {
+		return strconv.Quote(key_rv.String())
 	}
+	return fmt.Sprint(key_rv)
 }
 
-func (mach *unmarshalMachineMapStringWildcard) mustAcceptKey(key_rv reflect.Value) error {
+func (mach *unmarshalMachineMapWildcard) mustAcceptKey(key_rv reflect.Value) error {
+	if mach.seen != nil {
+		if _, exists := mach.seen[key_rv.Interface()]; exists {
+			return fmt.Errorf("repeated key %s", describeMapKey(key_rv))
+		}
+		mach.seen[key_rv.Interface()] = struct{}{}
+		return nil
+	}
 	if exists := mach.target_rv.MapIndex(key_rv).IsValid(); exists {
-		return fmt.Errorf("repeated key %q", key_rv)
+		return fmt.Errorf("repeated key %s", describeMapKey(key_rv))
 	}
 	return nil
 }
 
-func (mach *unmarshalMachineMapStringWildcard) step_AcceptValue(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
-	mach.phase = unmarshalMachineMapStringWildcardPhase_acceptAnotherKeyOrClose
-	mach.tmp_rv.Set(mach.valueZero_rv)
+func (mach *unmarshalMachineMapWildcard) step_AcceptValue(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+	mach.phase = unmarshalMachineMapWildcardPhase_acceptAnotherKeyOrClose
+	// When merging, the value merges with any existing value for the key.
+	//  (Map values aren't addressable, so we work on a copy, which gets saved back in the next step.)
+	if existing_rv := mach.target_rv.MapIndex(mach.key_rv); mach.seen != nil && existing_rv.IsValid() {
+		mach.tmp_rv.Set(existing_rv)
+	} else {
+		mach.tmp_rv.Set(mach.valueZero_rv)
+	}
 	return false, driver.Recurse(
 		tok,
 		mach.tmp_rv,
@@ -140,12 +311,12 @@ func (mach *unmarshalMachineMapStringWildcard) step_AcceptValue(driver *Unmarsha
 	)
 }
 
-func (mach *unmarshalMachineMapStringWildcard) step_AcceptAnotherKeyOrClose(_ *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+func (mach *unmarshalMachineMapWildcard) step_AcceptAnotherKeyOrClose(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
 	// First, save any refs from the last value.
 	//  (This is fiddly: the delay comes mostly from the handling of slices, which may end up re-allocating
 	//   themselves during their decoding.)
 	mach.target_rv.SetMapIndex(mach.key_rv, mach.tmp_rv)
 
 	// The rest is the same as the very first acceptKeyOrClose (and has the same future state transitions).
-	return mach.step_AcceptKeyOrClose(nil, slab, tok)
+	return mach.step_AcceptKeyOrClose(driver, slab, tok)
 }
@@ -0,0 +1,26 @@
+package obj
+
+import (
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+type unmarshalMachineNumber struct {
+	rv reflect.Value
+}
+
+func (mach *unmarshalMachineNumber) Reset(_ *unmarshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.rv = rv
+	return nil
+}
+
+func (mach *unmarshalMachineNumber) Step(_ *Unmarshaller, _ *unmarshalSlab, tok *Token) (done bool, err error) {
+	switch tok.Type {
+	case TInt, TUint, TFloat64:
+		mach.rv.SetString(string(numberFromToken(tok)))
+		return true, nil
+	default:
+		return true, ErrUnmarshalTypeCantFit{*tok, mach.rv, 0}
+	}
+}
@@ -0,0 +1,154 @@
+package obj
+
+import (
+	"fmt"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	UnmarshalOptions adjusts how an Unmarshaller fills in values
+	which the atlas and the types themselves leave open to interpretation
+	(mostly: what to put into an `interface{}`).
+
+	The zero value is the default behavior.
+*/
+type UnmarshalOptions struct {
+	// If true, maps unmarshalled into an `interface{}` become an OrderedMap
+	// (preserving the order of keys in the token stream), rather than
+	// a `map[string]interface{}`.
+	OrderedMaps bool
+
+	// If true, maps unmarshalled into an `interface{}` become
+	// a `map[interface{}]interface{}`, with keys of whatever kind they are
+	// in the token stream (cbor, for example, may have int keys).
+	// Ignored if OrderedMaps is set.
+	AnyKeyMaps bool
+
+	// Selects what type numbers unmarshalled into an `interface{}` become.
+	Numbers NumberMode
+
+	// If true, bytes unmarshalled into an `interface{}` become a string
+	// rather than a `[]byte`.
+	BytesAsString bool
+
+	// If set, this is called for tagged values unmarshalled into an `interface{}`
+	// when the atlas has no entry for the tag (without a hook, that's an error).
+	// The value is first unmarshalled as if it had no tag; the hook may then
+	// return anything it likes in its place.
+	TagHook func(tag int, value interface{}) (interface{}, error)
+
+	// If true, the cbor value-sharing tags (28, "shareable", and 29, "sharedref")
+	// are interpreted, as emitted by MarshalOptions.ValueSharing:
+	// a reference unmarshalled into a pointer is set to the very same pointer
+	// as the shareable value it refers to, so shared pointers and cycles are
+	// reconstructed.  (A reference unmarshalled into a non-pointer gets a copy.)
+	ValueSharing bool
+
+	// Selects what happens to the existing content of the value we unmarshal into.
+	Merge MergeMode
+}
+
+// A type to enumerate the ways numbers can be unmarshalled into an `interface{}`.
+type NumberMode uint8
+
+const (
+	NumberMode_Default NumberMode = iota // ints and uints become `int`; floats become `float64`.
+	NumberMode_Float64                   // all numbers become `float64` (like the stdlib's encoding/json).
+	NumberMode_Literal                   // all numbers become `Number`, which keeps ints exact and floats at float64 precision (and still floats).
+)
+
+/*
+	A type to enumerate the ways unmarshalling treats the existing content
+	of the value it's unmarshalling into.  This is useful for layering:
+	unmarshal a base config, then unmarshal overrides on top of it.
+
+	In all modes, a null token sets the value to its zero (nil maps, slices,
+	and pointers; zero structs), and scalars simply replace what was there.
+	Pointers which are already set are followed, so their targets are updated
+	in place, except in MergeMode_Replace (where they're nil to start with).
+
+	For the rest, per kind of value (and machine):
+
+		                          | Default | Replace | Deep    | Append   | Reuse
+		--------------------------+---------+---------+---------+----------+---------
+		struct: absent fields     | kept    | zeroed  | kept    | kept     | zeroed
+		struct: present fields    | (a)     | new     | (a)     | (a)      | (a)
+		map: absent keys          | kept    | removed | kept    | kept     | removed
+		map: present keys         | error   | new     | (a)     | (a)      | new
+		slice                     | new     | new     | new     | appended | (c)
+		array                     | new     | new     | new     | new      | new
+		interface{}: map          | new     | new     | (b)     | (b)      | new
+		interface{}: array        | new     | new     | new     | appended | new
+		OrderedMap                | new     | new     | (a)     | (a)      | new
+
+	(a): unmarshalled into the existing value, by the same rules, recursively.
+	(b): if the interface already holds a map of the type that would be
+	produced (see OrderedMaps and AnyKeyMaps), it's merged into;
+	otherwise, it's replaced.
+	(c): the existing backing array is reused (and its elements unmarshalled
+	into, by the same rules) as far as its capacity goes.
+
+	MergeMode_Reuse gives the same results as MergeMode_Replace, but keeps
+	the memory that's already allocated -- pointers' targets, slices' backing
+	arrays, and maps -- which makes it cheap to unmarshal many values into
+	the same slot in a row (as UnmarshalEach does).
+
+	Note that a key in the stream that is already present in a map is an error
+	in MergeMode_Default (as it always has been); the merging modes only
+	reject keys that are repeated within the stream.
+*/
+type MergeMode uint8
+
+const (
+	MergeMode_Default MergeMode = iota // structs merge; maps gain entries, but existing keys are rejected; everything else is replaced.
+	MergeMode_Replace                  // the value is zeroed first, so nothing of the existing content survives.
+	MergeMode_Deep                     // structs and maps merge recursively; slices are replaced.
+	MergeMode_Append                   // like MergeMode_Deep, except slices are appended to.
+	MergeMode_Reuse                    // like MergeMode_Replace, except memory that's already allocated is reused.
+)
+
+// Whether maps should merge with the entries already present.
+func (m MergeMode) merges() bool {
+	return m == MergeMode_Deep || m == MergeMode_Append
+}
+
+// Pick the value for a scalar token unmarshalled into an `interface{}`.
+func (opts *UnmarshalOptions) wildcardScalar(tok *Token) interface{} {
+	switch tok.Type {
+	case TString:
+		return tok.Str
+	case TBytes:
+		if opts.BytesAsString {
+			return string(tok.Bytes)
+		}
+		return tok.Bytes
+	case TBool:
+		return tok.Bool
+	case TInt:
+		switch opts.Numbers {
+		case NumberMode_Float64:
+			return float64(tok.Int)
+		case NumberMode_Literal:
+			return numberFromToken(tok)
+		}
+		return int(tok.Int) // Unmarshalling with no particular type info should default to using plain 'int' whenever viable.
+	case TUint:
+		switch opts.Numbers {
+		case NumberMode_Float64:
+			return float64(tok.Uint)
+		case NumberMode_Literal:
+			return numberFromToken(tok)
+		}
+		return int(tok.Uint) // Unmarshalling with no particular type info should default to using plain 'int' whenever viable.
+	case TFloat64:
+		if opts.Numbers == NumberMode_Literal {
+			return numberFromToken(tok)
+		}
+		return tok.Float64
+	case TNull:
+		return nil
+	default: // any of the other token types should not have been routed here to begin with.
+		panic(fmt.Errorf("unhandled: %v", tok.Type))
+	}
+}
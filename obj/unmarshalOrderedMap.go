@@ -0,0 +1,97 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+type unmarshalMachineOrderedMap struct {
+	target_rv reflect.Value       // Handle to the OrderedMap.  Set when done.
+	valueMach UnmarshalMachine    // Machine for values.
+	result    OrderedMap          // Entries accumulated so far.
+	seen      map[string]struct{} // Keys accumulated so far, for rejecting repeats.
+	tmp_rv    reflect.Value       // Addressable handle to a slot for values to unmarshal into.
+	current   int                 // Index in result of the entry whose value we're unmarshalling.
+	phase     unmarshalMachineMapWildcardPhase
+}
+
+func (mach *unmarshalMachineOrderedMap) Reset(slab *unmarshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.target_rv = rv
+	mach.valueMach = slab.requisitionMachine(rt_iface)
+	mach.result = nil
+	mach.seen = nil
+	mach.tmp_rv = reflect.New(rt_iface).Elem()
+	mach.phase = unmarshalMachineMapWildcardPhase_initial
+	return nil
+}
+
+func (mach *unmarshalMachineOrderedMap) Step(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+	switch mach.phase {
+	case unmarshalMachineMapWildcardPhase_initial:
+		switch tok.Type {
+		case TNull:
+			mach.target_rv.Set(reflect.Zero(mach.target_rv.Type()))
+			slab.release()
+			return true, nil
+		case TMapOpen:
+			mach.phase = unmarshalMachineMapWildcardPhase_acceptKeyOrClose
+			if tok.Length > 0 {
+				mach.result = make(OrderedMap, 0, tok.Length)
+			} else {
+				mach.result = OrderedMap{}
+			}
+			mach.seen = make(map[string]struct{}, cap(mach.result))
+			// When merging, start from (a copy of) the existing entries.
+			if driver.opts.Merge.merges() {
+				mach.result = append(mach.result, mach.target_rv.Convert(rt_orderedMap).Interface().(OrderedMap)...)
+			}
+			return false, nil
+		case TMapClose:
+			return true, fmt.Errorf("unexpected mapClose; expected start of map")
+		case TArrClose:
+			return true, fmt.Errorf("unexpected arrClose; expected start of map")
+		default:
+			return true, ErrUnmarshalTypeCantFit{*tok, mach.target_rv, 0}
+		}
+	case unmarshalMachineMapWildcardPhase_acceptValue:
+		mach.phase = unmarshalMachineMapWildcardPhase_acceptAnotherKeyOrClose
+		// When merging, the value merges with any existing value for the key.
+		if existing := mach.result[mach.current].Value; existing != nil {
+			mach.tmp_rv.Set(reflect.ValueOf(&existing).Elem())
+		} else {
+			mach.tmp_rv.Set(reflect.Zero(rt_iface))
+		}
+		return false, driver.Recurse(tok, mach.tmp_rv, rt_iface, mach.valueMach)
+	case unmarshalMachineMapWildcardPhase_acceptAnotherKeyOrClose:
+		// Save the last value, then carry on just like the first key.
+		mach.result[mach.current].Value = mach.tmp_rv.Interface()
+		fallthrough
+	case unmarshalMachineMapWildcardPhase_acceptKeyOrClose:
+		switch tok.Type {
+		case TMapClose:
+			mach.target_rv.Set(reflect.ValueOf(mach.result).Convert(mach.target_rv.Type()))
+			slab.release()
+			return true, nil
+		case TString:
+			if _, exists := mach.seen[tok.Str]; exists {
+				return true, fmt.Errorf("repeated key %q", tok.Str)
+			}
+			mach.seen[tok.Str] = struct{}{}
+			mach.current = -1
+			if driver.opts.Merge.merges() {
+				mach.current = mach.result.index(tok.Str)
+			}
+			if mach.current < 0 {
+				mach.current = len(mach.result)
+				mach.result = append(mach.result, OrderedMapEntry{Key: tok.Str})
+			}
+			mach.phase = unmarshalMachineMapWildcardPhase_acceptValue
+			return false, nil
+		default:
+			return true, fmt.Errorf("unexpected token %s; expected map key or end of map", tok)
+		}
+	}
+	panic("unreachable")
+}
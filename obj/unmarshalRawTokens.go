@@ -0,0 +1,46 @@
+package obj
+
+import (
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+type unmarshalMachineRawTokens struct {
+	target_rv reflect.Value
+	toks      RawTokens
+	depth     int
+}
+
+func (mach *unmarshalMachineRawTokens) Reset(_ *unmarshalSlab, rv reflect.Value, _ reflect.Type) error {
+	mach.target_rv = rv
+	mach.toks = nil
+	mach.depth = 0
+	return nil
+}
+
+func (mach *unmarshalMachineRawTokens) Step(_ *Unmarshaller, _ *unmarshalSlab, tok *Token) (done bool, err error) {
+	// Copy the token.  Bytes need a deep copy, since decoders may reuse their buffers.
+	captured := *tok
+	if tok.Bytes != nil {
+		captured.Bytes = make([]byte, len(tok.Bytes))
+		copy(captured.Bytes, tok.Bytes)
+	}
+	mach.toks = append(mach.toks, captured)
+
+	// Keep track of depth, so we know when the subtree is complete.
+	switch tok.Type {
+	case TMapOpen, TArrOpen:
+		mach.depth++
+	case TMapClose, TArrClose:
+		mach.depth--
+		if mach.depth < 0 {
+			return true, ErrMalformedTokenStream{tok.Type, "start of value"}
+		}
+	}
+	if mach.depth > 0 {
+		return false, nil
+	}
+	mach.target_rv.Set(reflect.ValueOf(mach.toks).Convert(mach.target_rv.Type()))
+	return true, nil
+}
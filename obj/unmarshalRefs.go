@@ -0,0 +1,72 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Like Recurse, for a value tagged shareable: strips the tag, and records
+	where the value went, so later references to it can be resolved.
+*/
+func (d *Unmarshaller) recurseShareable(tok *Token, rv reflect.Value, rt reflect.Type, nextMach UnmarshalMachine) error {
+	untagged := *tok
+	untagged.Tagged = false
+	idx := len(d.shared)
+	d.shared = append(d.shared, reflect.Value{})
+	if err := d.Recurse(&untagged, rv, rt, nextMach); err != nil {
+		return err
+	}
+	// Pointers are allocated by the first step, which is done now
+	//  (and references can't appear until later steps, so this is in time even for cycles).
+	//  We keep the innermost pointer, since that's what a reference will want.
+	switch {
+	case rv.Kind() == reflect.Ptr:
+		for !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+			rv = rv.Elem()
+		}
+		d.shared[idx] = rv
+	case rv.CanAddr():
+		d.shared[idx] = rv.Addr()
+	default:
+		d.shared[idx] = rv
+	}
+	return nil
+}
+
+/*
+	Set the value to the shareable value that the reference token refers to.
+*/
+func (d *Unmarshaller) resolveSharedRef(tok *Token, rv reflect.Value) error {
+	var idx uint64
+	switch {
+	case tok.Type == TUint:
+		idx = tok.Uint
+	case tok.Type == TInt && tok.Int >= 0:
+		idx = uint64(tok.Int)
+	default:
+		return fmt.Errorf("value sharing: a reference must be a uint, not %s", tok.Type)
+	}
+	if idx >= uint64(len(d.shared)) {
+		return fmt.Errorf("value sharing: reference to shared value %d, but only %d have been seen", idx, len(d.shared))
+	}
+	shared_rv := d.shared[idx]
+	// If the shareable value was unmarshalled into an interface, what we want is the content.
+	if shared_rv.Kind() == reflect.Ptr && shared_rv.Type().Elem().Kind() == reflect.Interface {
+		shared_rv = shared_rv.Elem()
+		if !shared_rv.IsNil() {
+			shared_rv = shared_rv.Elem()
+		}
+	}
+	switch {
+	case shared_rv.Type().AssignableTo(rv.Type()):
+		rv.Set(shared_rv)
+	case shared_rv.Kind() == reflect.Ptr && shared_rv.Type().Elem().AssignableTo(rv.Type()):
+		rv.Set(shared_rv.Elem())
+	default:
+		return fmt.Errorf("value sharing: cannot use shared value %d (a %s) as a %s", idx, shared_rv.Type(), rv.Type())
+	}
+	return nil
+}
@@ -22,12 +22,18 @@ type unmarshalSlabRow struct {
 	ptrDerefDelegateUnmarshalMachine
 	unmarshalMachinePrimitive
 	unmarshalMachineWildcard
-	unmarshalMachineMapStringWildcard
+	unmarshalMachineMapWildcard
 	unmarshalMachineSliceWildcard
 	unmarshalMachineArrayWildcard
 	unmarshalMachineStructAtlas
 	unmarshalMachineTransform
 	unmarshalMachineUnionKeyed
+	unmarshalMachineUnionKinded
+	unmarshalMachineEnum
+	unmarshalMachineRawTokens
+	unmarshalMachineOrderedMap
+	unmarshalMachineNumber
+	unmarshalMachineHooks
 
 	errThunkUnmarshalMachine
 }
@@ -92,17 +98,35 @@ func _yieldUnmarshalMachinePtr(row *unmarshalSlabRow, atl atlas.Atlas, rt reflec
 		return _yieldUnmarshalMachinePtrForAtlasEntry(row, entry, atl)
 	}
 
+	// Consult the type's own methods third.
+	if hk := unmarshalHookKindFor(rt); hk != hookKind_none {
+		row.unmarshalMachineHooks.kind = hk
+		return &row.unmarshalMachineHooks
+	}
+
 	// If no specific behavior found, use default behavior based on kind.
 	switch rt.Kind() {
-
+	case reflect.String:
+		// Number is a string underneath, but has its own behavior.
+		if rt == rt_number {
+			return &row.unmarshalMachineNumber
+		}
+		row.unmarshalMachinePrimitive.kind = rt.Kind()
+		return &row.unmarshalMachinePrimitive
 	case reflect.Bool,
-		reflect.String,
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
 		reflect.Float32, reflect.Float64:
 		row.unmarshalMachinePrimitive.kind = rt.Kind()
 		return &row.unmarshalMachinePrimitive
 	case reflect.Slice:
+		// slices of tokens are raw tokens: captured or emitted verbatim.
+		if rt.Elem() == rt_token {
+			return &row.unmarshalMachineRawTokens
+		}
+		if rt == rt_orderedMap {
+			return &row.unmarshalMachineOrderedMap
+		}
 		// un-typedef'd byte slices were handled already, but a typedef'd one still gets gets treated like a special kind:
 		if rt.Elem().Kind() == reflect.Uint8 {
 			row.unmarshalMachinePrimitive.kind = rt.Kind()
@@ -117,8 +141,13 @@ func _yieldUnmarshalMachinePtr(row *unmarshalSlabRow, atl atlas.Atlas, rt reflec
 		}
 		return &row.unmarshalMachineArrayWildcard
 	case reflect.Map:
-		return &row.unmarshalMachineMapStringWildcard
+		return &row.unmarshalMachineMapWildcard
 	case reflect.Struct:
+		if rt == rt_arrayStream {
+			mach := &row.errThunkUnmarshalMachine
+			mach.err = fmt.Errorf("cannot unmarshal into %v: it can only be marshalled (use UnmarshalEach to stream elements out of an array)", rt)
+			return mach
+		}
 		// TODO here we could also invoke automatic atlas autogen, if configured to be permitted
 		mach := &row.errThunkUnmarshalMachine
 		mach.err = fmt.Errorf("missing an atlas entry describing how to unmarshal type %v (and auto-atlasing for structs is not enabled)", rt)
@@ -147,7 +176,7 @@ func _yieldUnmarshalMachinePtrForAtlasEntry(row *unmarshalSlabRow, entry *atlas.
 		// and don't have a real value to transform until later.
 		row.unmarshalMachineTransform.trFunc = entry.UnmarshalTransformFunc
 		row.unmarshalMachineTransform.recv_rt = entry.UnmarshalTransformTargetType
-		// Pick delegate without growing stack.  (This currently means recursive transform won't fly.)
+		// Pick delegate without growing stack.  (This means recursive transforms won't fly; atlas.Build rejects them.)
 		row.unmarshalMachineTransform.delegate = _yieldUnmarshalMachinePtr(row, atl, entry.UnmarshalTransformTargetType)
 		return &row.unmarshalMachineTransform
 	case entry.StructMap != nil:
@@ -156,11 +185,32 @@ func _yieldUnmarshalMachinePtrForAtlasEntry(row *unmarshalSlabRow, entry *atlas.
 	case entry.UnionKeyedMorphism != nil:
 		row.unmarshalMachineUnionKeyed.cfg = entry.UnionKeyedMorphism
 		return &row.unmarshalMachineUnionKeyed
+	case entry.UnionKindedMorphism != nil:
+		row.unmarshalMachineUnionKinded.cfg = entry.UnionKindedMorphism
+		return &row.unmarshalMachineUnionKinded
+	case entry.EnumMorphism != nil:
+		row.unmarshalMachineEnum.cfg = entry
+		return &row.unmarshalMachineEnum
 	default:
 		panic("invalid atlas entry")
 	}
 }
 
+// Like _yieldUnmarshalMachinePtrForAtlasEntry, but for the members of unions,
+// which may be entries with no special configuration (e.g. a plain string
+// in a kinded union): for those, we use the default machinery for the type.
+func _yieldUnmarshalMachinePtrForUnionMember(row *unmarshalSlabRow, entry *atlas.AtlasEntry, atl atlas.Atlas) UnmarshalMachine {
+	if entry.UnmarshalTransformFunc == nil &&
+		entry.StructMap == nil &&
+		entry.MapMorphism == nil &&
+		entry.UnionKeyedMorphism == nil &&
+		entry.UnionKindedMorphism == nil &&
+		entry.EnumMorphism == nil {
+		return _yieldUnmarshalMachinePtr(row, atl, entry.Type)
+	}
+	return _yieldUnmarshalMachinePtrForAtlasEntry(row, entry, atl)
+}
+
 // Returns the top row of the slab.  Useful for machines that need to delegate
 //  to another type that's definitely not their own (comes up for the wildcard delegators).
 func (s *unmarshalSlab) tip() *unmarshalSlabRow {
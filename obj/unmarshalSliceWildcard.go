@@ -37,7 +37,7 @@ func (mach *unmarshalMachineSliceWildcard) Step(driver *Unmarshaller, slab *unma
 	panic("unreachable")
 }
 
-func (mach *unmarshalMachineSliceWildcard) step_Initial(_ *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+func (mach *unmarshalMachineSliceWildcard) step_Initial(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
 	// If it's a special state, start an object.
 	//  (Or, blow up if its a special state that's silly).
 	switch tok.Type {
@@ -46,7 +46,16 @@ func (mach *unmarshalMachineSliceWildcard) step_Initial(_ *Unmarshaller, slab *u
 	case TArrOpen:
 		// Great.  Consumed.
 		mach.phase = unmarshalMachineArrayWildcardPhase_acceptValueOrClose
-		// Initialize the slice.
+		// Initialize the slice (unless appending to what's already there,
+		//  or reusing its backing array).
+		if driver.opts.Merge == MergeMode_Append && !mach.target_rv.IsNil() {
+			mach.index = mach.working_rv.Len()
+			return false, nil
+		}
+		if driver.opts.Merge == MergeMode_Reuse && !mach.target_rv.IsNil() {
+			mach.working_rv = mach.target_rv.Slice(0, 0)
+			return false, nil
+		}
 		mach.target_rv.Set(reflect.MakeSlice(mach.target_rv.Type(), 0, 0))
 		return false, nil
 	case TMapClose:
@@ -77,7 +86,12 @@ func (mach *unmarshalMachineSliceWildcard) step_AcceptValueOrClose(driver *Unmar
 	}
 
 	// Grow the slice if necessary.
-	mach.working_rv = reflect.Append(mach.working_rv, mach.valueZero_rv)
+	//  When reusing, whatever was in the backing array stays put, so its memory can be reused too.
+	if driver.opts.Merge == MergeMode_Reuse && mach.index < mach.working_rv.Cap() {
+		mach.working_rv = mach.working_rv.Slice(0, mach.index+1)
+	} else {
+		mach.working_rv = reflect.Append(mach.working_rv, mach.valueZero_rv)
+	}
 
 	// Recurse on a handle to the next index.
 	rv := mach.working_rv.Index(mach.index)
@@ -2,7 +2,9 @@ package obj
 
 import (
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
 
 	"github.com/polydawn/refmt/obj/atlas"
 	. "github.com/polydawn/refmt/tok"
@@ -16,6 +18,7 @@ type unmarshalMachineStructAtlas struct {
 	index      int                  // Progress marker: our distance into the stream of pairs.
 	value      bool                 // Progress marker: whether the next token is a value.
 	fieldEntry atlas.StructMapEntry // Which field we expect next: set when consuming a key.
+	seen       []bool               // Which fields were present (only in MergeMode_Reuse, which zeroes the rest at the end).
 }
 
 func (mach *unmarshalMachineStructAtlas) Reset(_ *unmarshalSlab, rv reflect.Value, _ reflect.Type) error {
@@ -23,6 +26,7 @@ func (mach *unmarshalMachineStructAtlas) Reset(_ *unmarshalSlab, rv reflect.Valu
 	// not necessary to reset expectLen because MapOpen tokens also consistently use the -1 convention.
 	mach.index = -1
 	mach.value = false
+	mach.seen = nil
 	return nil
 }
 
@@ -34,6 +38,9 @@ func (mach *unmarshalMachineStructAtlas) Step(driver *Unmarshaller, slab *unmars
 			// Great.  Consumed.
 			mach.expectLen = tok.Length
 			mach.index++
+			if driver.opts.Merge == MergeMode_Reuse {
+				mach.seen = make([]bool, len(mach.cfg.StructMap.Fields))
+			}
 			return false, nil
 		case TMapClose:
 			return true, ErrMalformedTokenStream{tok.Type, "start of map"}
@@ -86,8 +93,20 @@ func (mach *unmarshalMachineStructAtlas) Step(driver *Unmarshaller, slab *unmars
 
 		// Future: this would be a reasonable place to check that all required fields have been filled in, if we add such a feature.
 
+		// When reusing, the fields that weren't present are zeroed (while the ones that were kept their memory).
+		if driver.opts.Merge == MergeMode_Reuse {
+			for n, fieldEntry := range mach.cfg.StructMap.Fields {
+				if mach.seen[n] || fieldEntry.Ignore {
+					continue
+				}
+				field_rv := fieldEntry.ReflectRoute.TraverseToValue(mach.rv)
+				field_rv.Set(reflect.Zero(field_rv.Type()))
+			}
+		}
+
 		return true, nil
 	case TString:
+		// Fields keyed as int match their decimal form too, since that's what they look like after a trip through json.
 		for n := 0; n < len(mach.cfg.StructMap.Fields); n++ {
 			fieldEntry := mach.cfg.StructMap.Fields[n]
 			if fieldEntry.SerialName != tok.Str {
@@ -95,6 +114,9 @@ func (mach *unmarshalMachineStructAtlas) Step(driver *Unmarshaller, slab *unmars
 			}
 			mach.fieldEntry = fieldEntry
 			mach.value = true
+			if mach.seen != nil {
+				mach.seen[n] = true
+			}
 			break
 		}
 		if mach.value == false {
@@ -102,6 +124,31 @@ func (mach *unmarshalMachineStructAtlas) Step(driver *Unmarshaller, slab *unmars
 			// Currently we're being extremely strict about it, which is a divergence from the stdlib json behavior.
 			return true, ErrNoSuchField{tok.Str, mach.cfg.Type.String()}
 		}
+	case TInt, TUint:
+		var key int64
+		if tok.Type == TInt {
+			key = tok.Int
+		} else {
+			if tok.Uint > math.MaxInt64 {
+				return true, ErrNoSuchField{strconv.FormatUint(tok.Uint, 10), mach.cfg.Type.String()}
+			}
+			key = int64(tok.Uint)
+		}
+		for n := 0; n < len(mach.cfg.StructMap.Fields); n++ {
+			fieldEntry := mach.cfg.StructMap.Fields[n]
+			if !fieldEntry.KeyAsInt || fieldEntry.SerialInt != key {
+				continue
+			}
+			mach.fieldEntry = fieldEntry
+			mach.value = true
+			if mach.seen != nil {
+				mach.seen[n] = true
+			}
+			break
+		}
+		if mach.value == false {
+			return true, ErrNoSuchField{strconv.FormatInt(key, 10), mach.cfg.Type.String()}
+		}
 	default:
 		return true, ErrMalformedTokenStream{tok.Type, "map key"}
 	}
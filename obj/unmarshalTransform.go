@@ -1,6 +1,7 @@
 package obj
 
 import (
+	"fmt"
 	"reflect"
 
 	"github.com/polydawn/refmt/obj/atlas"
@@ -32,6 +33,12 @@ func (mach *unmarshalMachineTransform) Step(driver *Unmarshaller, slab *unmarsha
 	}
 	// on the last step, use transform, and finally set in real target.
 	tr_rv, err := mach.trFunc(mach.recv_rv)
+	if !tr_rv.IsValid() || !tr_rv.Type().AssignableTo(mach.target_rv.Type()) {
+		if err != nil {
+			return true, err
+		}
+		return true, fmt.Errorf("unmarshal transform func yielded a value which cannot be assigned to %v", mach.target_rv.Type())
+	}
 	// do attempt the set even if error.  user may appreciate partial progress.
 	mach.target_rv.Set(tr_rv)
 	return true, err
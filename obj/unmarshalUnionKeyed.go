@@ -77,7 +77,7 @@ func (mach *unmarshalMachineUnionKeyed) step_acceptKey(driver *Unmarshaller, sla
 		//  Assigning into the interface must be done at the end if it's a non-pointer.
 		mach.tmp_rv = reflect.New(delegateAtlasEnt.Type).Elem()
 		// Get and configure a machine for the delegation.
-		delegate := _yieldUnmarshalMachinePtrForAtlasEntry(slab.tip(), delegateAtlasEnt, slab.atlas)
+		delegate := _yieldUnmarshalMachinePtrForUnionMember(slab.tip(), delegateAtlasEnt, slab.atlas)
 		if err := delegate.Reset(slab, mach.tmp_rv, delegateAtlasEnt.Type); err != nil {
 			return true, err
 		}
@@ -0,0 +1,65 @@
+package obj
+
+import (
+	"reflect"
+
+	"github.com/polydawn/refmt/obj/atlas"
+	. "github.com/polydawn/refmt/tok"
+)
+
+type unmarshalMachineUnionKinded struct {
+	cfg *atlas.UnionKindedMorphism // set on initialization
+
+	target_rv reflect.Value
+	target_rt reflect.Type
+
+	tmp_rv   reflect.Value
+	delegate UnmarshalMachine // actual machine, once we've demuxed with the first token.
+}
+
+func (mach *unmarshalMachineUnionKinded) Reset(_ *unmarshalSlab, rv reflect.Value, rt reflect.Type) error {
+	mach.target_rv = rv
+	mach.target_rt = rt
+	mach.delegate = nil
+	return nil
+}
+
+func (mach *unmarshalMachineUnionKinded) Step(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
+	if mach.delegate == nil {
+		if err := mach.prepareDemux(slab, tok); err != nil {
+			return true, err
+		}
+	}
+	done, err = mach.delegate.Step(driver, slab, tok)
+	if done && err == nil {
+		// Assigning into the interface must be done at the end in case it's a non-pointer.
+		mach.target_rv.Set(mach.tmp_rv)
+	}
+	return
+}
+
+func (mach *unmarshalMachineUnionKinded) prepareDemux(slab *unmarshalSlab, tok *Token) error {
+	// Look up the configuration for this kind of token.
+	//  Ints and uints are close enough to fill in for each other if only one was declared.
+	delegateAtlasEnt, ok := mach.cfg.Elements[tok.Type]
+	if !ok {
+		switch {
+		case tok.Type == TUint:
+			delegateAtlasEnt, ok = mach.cfg.Elements[TInt]
+		case tok.Type == TInt && tok.Int >= 0:
+			delegateAtlasEnt, ok = mach.cfg.Elements[TUint]
+		}
+	}
+	if !ok {
+		return ErrNoSuchUnionMember{tok.Type.String(), mach.target_rt, mach.cfg.KnownMembers}
+	}
+	// Allocate a new concrete value, and hang on to that rv handle.
+	mach.tmp_rv = reflect.New(delegateAtlasEnt.Type).Elem()
+	// Get and configure a machine for the delegation.
+	delegate := _yieldUnmarshalMachinePtrForUnionMember(slab.tip(), delegateAtlasEnt, slab.atlas)
+	if err := delegate.Reset(slab, mach.tmp_rv, delegateAtlasEnt.Type); err != nil {
+		return err
+	}
+	mach.delegate = delegate
+	return nil
+}
@@ -12,6 +12,8 @@ type unmarshalMachineWildcard struct {
 	target_rt reflect.Type
 	delegate  UnmarshalMachine // actual machine, once we've demuxed with the first token.
 	holder_rv reflect.Value    // if set, handle to slot where slice is stored; content must be placed into target at end.
+	hooked    bool             // if set, the value was tagged with hookTag, and must go through the TagHook at end.
+	hookTag   int
 }
 
 func (mach *unmarshalMachineWildcard) Reset(_ *unmarshalSlab, rv reflect.Value, rt reflect.Type) error {
@@ -19,6 +21,7 @@ func (mach *unmarshalMachineWildcard) Reset(_ *unmarshalSlab, rv reflect.Value,
 	mach.target_rt = rt
 	mach.delegate = nil
 	mach.holder_rv = reflect.Value{}
+	mach.hooked = false
 	return nil
 }
 
@@ -26,6 +29,9 @@ func (mach *unmarshalMachineWildcard) Step(driver *Unmarshaller, slab *unmarshal
 	if mach.delegate == nil {
 		done, err = mach.prepareDemux(driver, slab, tok)
 		if done {
+			if err == nil && mach.hooked {
+				err = mach.applyTagHook(driver)
+			}
 			return
 		}
 	}
@@ -36,14 +42,41 @@ func (mach *unmarshalMachineWildcard) Step(driver *Unmarshaller, slab *unmarshal
 	if mach.holder_rv.IsValid() {
 		mach.target_rv.Set(mach.holder_rv)
 	}
+	if err == nil && mach.hooked {
+		err = mach.applyTagHook(driver)
+	}
 	return
 }
 
+func (mach *unmarshalMachineWildcard) applyTagHook(driver *Unmarshaller) error {
+	v, err := driver.opts.TagHook(mach.hookTag, mach.target_rv.Interface())
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		mach.target_rv.Set(reflect.Zero(mach.target_rt))
+		return nil
+	}
+	v_rv := reflect.ValueOf(v)
+	if !v_rv.Type().AssignableTo(mach.target_rt) {
+		return fmt.Errorf("tag hook for tag %d yielded a %T, which cannot be assigned to %v", mach.hookTag, v, mach.target_rt)
+	}
+	mach.target_rv.Set(v_rv)
+	return nil
+}
+
 func (mach *unmarshalMachineWildcard) prepareDemux(driver *Unmarshaller, slab *unmarshalSlab, tok *Token) (done bool, err error) {
 	// If a "tag" is set in the token, we try to follow that as a hint for
 	//  any specifically customized behaviors for how this should be unmarshalled.
+	//  If the atlas doesn't know the tag, but there's a tag hook, we carry on
+	//  as if there was no tag, and let the hook have its way at the end.
 	if tok.Tagged == true {
 		atlasEntry, exists := slab.atlas.GetEntryByTag(tok.Tag)
+		if !exists && driver.opts.TagHook != nil {
+			mach.hooked = true
+			mach.hookTag = tok.Tag
+			goto untagged
+		}
 		if !exists {
 			return true, fmt.Errorf("missing an unmarshaller for tag %v", tok.Tag)
 		}
@@ -56,14 +89,38 @@ func (mach *unmarshalMachineWildcard) prepareDemux(driver *Unmarshaller, slab *u
 		return false, nil
 	}
 
+untagged:
 	// Switch on token type: we may be able to delegate to a primitive machine,
 	//  but we may also need to initialize a container type and then hand off.
 	switch tok.Type {
 	case TMapOpen:
-		child := make(map[string]interface{})
+		// When merging, an existing map of the same sort we'd make is reused.
+		//  (Otherwise, the new map replaces whatever was there.)
+		var existing_rv reflect.Value
+		if driver.opts.Merge.merges() && !mach.target_rv.IsNil() {
+			existing_rv = mach.target_rv.Elem()
+		}
+		if driver.opts.OrderedMaps {
+			mach.holder_rv = reflect.New(rt_orderedMap).Elem()
+			if existing_rv.IsValid() && existing_rv.Type() == rt_orderedMap {
+				mach.holder_rv.Set(existing_rv)
+			}
+			mach.delegate = &slab.tip().unmarshalMachineOrderedMap
+			if err := mach.delegate.Reset(slab, mach.holder_rv, rt_orderedMap); err != nil {
+				return true, err
+			}
+			return false, nil
+		}
+		var child interface{} = make(map[string]interface{})
+		if driver.opts.AnyKeyMaps {
+			child = make(map[interface{}]interface{})
+		}
 		child_rv := reflect.ValueOf(child)
+		if existing_rv.IsValid() && existing_rv.Type() == child_rv.Type() {
+			child_rv = existing_rv
+		}
 		mach.target_rv.Set(child_rv)
-		mach.delegate = &slab.tip().unmarshalMachineMapStringWildcard
+		mach.delegate = &slab.tip().unmarshalMachineMapWildcard
 		if err := mach.delegate.Reset(slab, child_rv, child_rv.Type()); err != nil {
 			return true, err
 		}
@@ -81,6 +138,11 @@ func (mach *unmarshalMachineWildcard) prepareDemux(driver *Unmarshaller, slab *u
 		// - https://play.golang.org/p/jV9VFDht6F -- finally getting somewhere good
 
 		holder := make([]interface{}, 0)
+		if driver.opts.Merge == MergeMode_Append && !mach.target_rv.IsNil() {
+			if existing, ok := mach.target_rv.Interface().([]interface{}); ok {
+				holder = existing
+			}
+		}
 		mach.holder_rv = reflect.ValueOf(&holder).Elem()
 		mach.delegate = &slab.tip().unmarshalMachineSliceWildcard
 		if err := mach.delegate.Reset(slab, mach.holder_rv, mach.holder_rv.Type()); err != nil {
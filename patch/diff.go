@@ -0,0 +1,76 @@
+package patch
+
+import (
+	"strconv"
+
+	"github.com/polydawn/refmt/obj"
+	"github.com/polydawn/refmt/shared"
+)
+
+/*
+	Generate a JSON Patch which turns the original document into the
+	modified one.
+
+	Maps are diffed key by key, and arrays index by index (trailing
+	elements are removed or added); anything else that differs is replaced.
+	The patch is correct, but not necessarily minimal: an element inserted
+	at the start of an array, for example, shows up as a change to every
+	element after it.
+*/
+func Diff(original, modified interface{}) (Patch, error) {
+	original, err := normalize(original)
+	if err != nil {
+		return nil, err
+	}
+	modified, err = normalize(modified)
+	if err != nil {
+		return nil, err
+	}
+	return diff(nil, "", original, modified), nil
+}
+
+func diff(p Patch, path string, original, modified interface{}) Patch {
+	if equal(original, modified) {
+		return p
+	}
+	switch a := original.(type) {
+	case obj.OrderedMap:
+		b, ok := modified.(obj.OrderedMap)
+		if !ok {
+			break
+		}
+		for _, ent := range a {
+			if v, ok := b.Get(ent.Key); ok {
+				p = diff(p, shared.AppendPointer(path, ent.Key), ent.Value, v)
+			} else {
+				p = append(p, Operation{Op: "remove", Path: shared.AppendPointer(path, ent.Key)})
+			}
+		}
+		for _, ent := range b {
+			if _, ok := a.Get(ent.Key); !ok {
+				p = append(p, Operation{Op: "add", Path: shared.AppendPointer(path, ent.Key), Value: ent.Value})
+			}
+		}
+		return p
+	case []interface{}:
+		b, ok := modified.([]interface{})
+		if !ok {
+			break
+		}
+		n := len(a)
+		if len(b) < n {
+			n = len(b)
+		}
+		for i := 0; i < n; i++ {
+			p = diff(p, shared.AppendPointer(path, strconv.Itoa(i)), a[i], b[i])
+		}
+		for i := len(a) - 1; i >= n; i-- {
+			p = append(p, Operation{Op: "remove", Path: shared.AppendPointer(path, strconv.Itoa(i))})
+		}
+		for i := n; i < len(b); i++ {
+			p = append(p, Operation{Op: "add", Path: shared.AppendPointer(path, strconv.Itoa(i)), Value: b[i]})
+		}
+		return p
+	}
+	return append(p, Operation{Op: "replace", Path: path, Value: modified})
+}
@@ -0,0 +1,18 @@
+/*
+	The `patch` package implements partial updates of documents:
+	JSON Merge Patch (RFC 7386), and JSON Patch (RFC 6902).
+	Patches can be applied, and also generated by diffing two documents.
+
+	Despite the names, nothing here is specific to JSON: patches work on
+	token streams, so the same patch applies equally well to cbor
+	(or anything else refmt can tokenize).  They also work directly on
+	Go objects, using an atlas to get to and from tokens.
+
+	Documents are handled in memory as trees of `obj.OrderedMap` (for maps,
+	so the order of keys is preserved), `[]interface{}` (for arrays), and
+	scalars -- which is what `Read` produces.  Functions that take trees
+	also accept anything else the obj package can marshal without an atlas
+	(e.g. `map[string]interface{}`), but what they return is always in the
+	canonical form.  Map keys must be strings.
+*/
+package patch
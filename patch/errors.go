@@ -0,0 +1,19 @@
+package patch
+
+import (
+	"fmt"
+)
+
+// ErrOperationFailed is the error returned when applying a JSON Patch and
+// one of its operations can't be applied (including when a "test" fails).
+// When this happens, the document is left unmodified.
+type ErrOperationFailed struct {
+	Index  int    // Index of the operation in the patch.
+	Op     string // The operation, e.g. "add".
+	Path   string // The path of the operation.
+	Reason string // Freeform description of what went wrong.
+}
+
+func (e ErrOperationFailed) Error() string {
+	return fmt.Sprintf("patch operation %d (%s %q) failed: %s", e.Index, e.Op, e.Path, e.Reason)
+}
@@ -0,0 +1,282 @@
+package patch
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/polydawn/refmt/obj"
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Patch is a JSON Patch (RFC 6902): a sequence of operations,
+	applied in order.  Patches can be marshalled and unmarshalled
+	with any of refmt's formats, with no atlas required.
+*/
+type Patch []Operation
+
+/*
+	Operation is one step of a Patch.
+
+	Op is one of "add", "remove", "replace", "move", "copy", or "test".
+	Path (and From, for "move" and "copy") are JSON Pointers (RFC 6901).
+	Value is used by "add", "replace", and "test"; it's a tree
+	(see the package docs), and may be nil (meaning null).
+*/
+type Operation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+/*
+	Apply the patch to a document, returning the result.
+
+	Application is atomic: if any operation fails, an ErrOperationFailed
+	is returned and the result is nil.  The document given isn't modified.
+*/
+func (p Patch) Apply(doc interface{}) (interface{}, error) {
+	doc, err := normalize(doc)
+	if err != nil {
+		return nil, err
+	}
+	return p.apply(doc)
+}
+
+/*
+	Like Apply, but reading the document from a token source,
+	and writing the result to a token sink.
+*/
+func (p Patch) ApplyTokens(dst shared.TokenSink, src shared.TokenSource) error {
+	doc, err := Read(src)
+	if err != nil {
+		return err
+	}
+	doc, err = p.apply(doc)
+	if err != nil {
+		return err
+	}
+	return Write(dst, doc)
+}
+
+/*
+	Like Apply, but updating a Go object in place.
+	The object is marshalled and unmarshalled with the atlas
+	(so the target must be a pointer).  If the patch fails,
+	the object isn't modified.
+*/
+func (p Patch) ApplyObject(target interface{}, atl atlas.Atlas) error {
+	doc, err := FromObject(target, atl)
+	if err != nil {
+		return err
+	}
+	doc, err = p.apply(doc)
+	if err != nil {
+		return err
+	}
+	return ToObject(doc, target, atl)
+}
+
+// Apply to a canonical tree, which we're free to mutate.
+func (p Patch) apply(doc interface{}) (interface{}, error) {
+	for i, op := range p {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, ErrOperationFailed{i, op.Op, op.Path, err.Error()}
+		}
+	}
+	return doc, nil
+}
+
+func (op Operation) apply(doc interface{}) (interface{}, error) {
+	segs, err := shared.ParsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		value, err := normalize(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, segs, value)
+	case "remove":
+		if len(segs) == 0 {
+			return nil, fmt.Errorf("cannot remove the whole document")
+		}
+		return update(doc, segs, removeChild)
+	case "replace":
+		value, err := normalize(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return replace(doc, segs, value)
+	case "move":
+		fromSegs, err := shared.ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		// The value has to exist, even if it's not going anywhere.
+		value, err := get(doc, fromSegs)
+		if err != nil {
+			return nil, err
+		}
+		if op.From == op.Path {
+			return doc, nil
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, fmt.Errorf("cannot move a value into one of its own children")
+		}
+		if len(fromSegs) == 0 {
+			return nil, fmt.Errorf("cannot move the whole document")
+		}
+		if doc, err = update(doc, fromSegs, removeChild); err != nil {
+			return nil, err
+		}
+		return add(doc, segs, value)
+	case "copy":
+		fromSegs, err := shared.ParsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, fromSegs)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = normalize(value); err != nil { // copying.
+			return nil, err
+		}
+		return add(doc, segs, value)
+	case "test":
+		value, err := normalize(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		actual, err := get(doc, segs)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(actual, value) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+func add(doc interface{}, segs []string, value interface{}) (interface{}, error) {
+	if len(segs) == 0 {
+		return value, nil
+	}
+	return update(doc, segs, func(parent interface{}, seg string) (interface{}, error) {
+		return addChild(parent, seg, value)
+	})
+}
+
+func replace(doc interface{}, segs []string, value interface{}) (interface{}, error) {
+	if len(segs) == 0 {
+		return value, nil
+	}
+	return update(doc, segs, func(parent interface{}, seg string) (interface{}, error) {
+		return setChild(parent, seg, value)
+	})
+}
+
+// Whether the operation carries a value.
+func (op Operation) hasValue() bool {
+	switch op.Op {
+	case "add", "replace", "test":
+		return true
+	}
+	return false
+}
+
+// Whether the operation has a source path.
+func (op Operation) hasFrom() bool {
+	switch op.Op {
+	case "move", "copy":
+		return true
+	}
+	return false
+}
+
+/*
+	MarshalRefmt emits the operation as a map,
+	with only the members its kind of operation uses.
+*/
+func (op Operation) MarshalRefmt() (obj.RawTokens, error) {
+	toks := obj.RawTokens{
+		{Type: TMapOpen, Length: 2},
+		{Type: TString, Str: "op"}, {Type: TString, Str: op.Op},
+		{Type: TString, Str: "path"}, {Type: TString, Str: op.Path},
+	}
+	if op.hasFrom() {
+		toks[0].Length++
+		toks = append(toks, Token{Type: TString, Str: "from"}, Token{Type: TString, Str: op.From})
+	}
+	if op.hasValue() {
+		toks[0].Length++
+		toks = append(toks, Token{Type: TString, Str: "value"})
+		marshaller := obj.NewMarshaller(emptyAtlas)
+		if err := marshaller.Bind(op.Value); err != nil {
+			return nil, err
+		}
+		for done := false; !done; {
+			var tok Token
+			var err error
+			if done, err = marshaller.Step(&tok); err != nil {
+				return nil, err
+			}
+			toks = append(toks, tok)
+		}
+	}
+	return append(toks, Token{Type: TMapClose}), nil
+}
+
+/*
+	UnmarshalRefmt reads the operation from a map.
+	Members the kind of operation needs must be present; others are ignored.
+*/
+func (op *Operation) UnmarshalRefmt(toks obj.RawTokens) error {
+	tree, err := Read(toks.Source())
+	if err != nil {
+		return err
+	}
+	m, ok := tree.(obj.OrderedMap)
+	if !ok {
+		return fmt.Errorf("patch operation must be a map, not %s", kindName(tree))
+	}
+	str := func(key string) (string, error) {
+		v, ok := m.Get(key)
+		if !ok {
+			return "", fmt.Errorf("patch operation is missing %q", key)
+		}
+		s, ok := v.(string)
+		if !ok {
+			return "", fmt.Errorf("patch operation %q must be a string, not %s", key, kindName(v))
+		}
+		return s, nil
+	}
+	*op = Operation{}
+	if op.Op, err = str("op"); err != nil {
+		return err
+	}
+	if op.Path, err = str("path"); err != nil {
+		return err
+	}
+	if op.hasFrom() {
+		if op.From, err = str("from"); err != nil {
+			return err
+		}
+	}
+	if op.hasValue() {
+		if op.Value, ok = m.Get("value"); !ok {
+			return fmt.Errorf("patch operation is missing %q", "value")
+		}
+	}
+	return nil
+}
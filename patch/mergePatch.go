@@ -0,0 +1,127 @@
+package patch
+
+import (
+	"github.com/polydawn/refmt/obj"
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
+)
+
+/*
+	Apply a JSON Merge Patch (RFC 7386) to a document, returning the result.
+
+	In short: a map in the patch is merged into the document recursively,
+	with null values meaning "remove this key"; anything else in the patch
+	replaces what's in the document.
+
+	The document given isn't modified.
+*/
+func MergePatch(doc, patch interface{}) (interface{}, error) {
+	doc, err := normalize(doc)
+	if err != nil {
+		return nil, err
+	}
+	patch, err = normalize(patch)
+	if err != nil {
+		return nil, err
+	}
+	return mergePatch(doc, patch), nil
+}
+
+func mergePatch(doc, patch interface{}) interface{} {
+	patchMap, ok := patch.(obj.OrderedMap)
+	if !ok {
+		return patch
+	}
+	docMap, ok := doc.(obj.OrderedMap)
+	if !ok {
+		docMap = obj.OrderedMap{}
+	}
+	for _, ent := range patchMap {
+		if ent.Value == nil {
+			if removed, err := removeChild(docMap, ent.Key); err == nil { // absent is fine.
+				docMap = removed.(obj.OrderedMap)
+			}
+			continue
+		}
+		existing, _ := docMap.Get(ent.Key)
+		docMap.Set(ent.Key, mergePatch(existing, ent.Value))
+	}
+	return docMap
+}
+
+/*
+	Like MergePatch, but reading the document and the patch from
+	token sources, and writing the result to a token sink.
+*/
+func MergePatchTokens(dst shared.TokenSink, doc, patch shared.TokenSource) error {
+	docTree, err := Read(doc)
+	if err != nil {
+		return err
+	}
+	patchTree, err := Read(patch)
+	if err != nil {
+		return err
+	}
+	return Write(dst, mergePatch(docTree, patchTree))
+}
+
+/*
+	Like MergePatch, but updating a Go object in place.
+	The object is marshalled and unmarshalled with the atlas
+	(so the target must be a pointer).
+*/
+func MergePatchObject(target interface{}, patch shared.TokenSource, atl atlas.Atlas) error {
+	docTree, err := FromObject(target, atl)
+	if err != nil {
+		return err
+	}
+	patchTree, err := Read(patch)
+	if err != nil {
+		return err
+	}
+	return ToObject(mergePatch(docTree, patchTree), target, atl)
+}
+
+/*
+	Generate a JSON Merge Patch which turns the original document into the
+	modified one.
+
+	Merge patches can't express everything: if the modified document has a
+	null value in a map, the patch will remove that key instead.
+	(JSON Patch has no such limitation; see Diff.)
+*/
+func CreateMergePatch(original, modified interface{}) (interface{}, error) {
+	original, err := normalize(original)
+	if err != nil {
+		return nil, err
+	}
+	modified, err = normalize(modified)
+	if err != nil {
+		return nil, err
+	}
+	return createMergePatch(original, modified), nil
+}
+
+func createMergePatch(original, modified interface{}) interface{} {
+	originalMap, ok1 := original.(obj.OrderedMap)
+	modifiedMap, ok2 := modified.(obj.OrderedMap)
+	if !ok1 || !ok2 {
+		return modified
+	}
+	patch := obj.OrderedMap{}
+	for _, ent := range originalMap {
+		if _, ok := modifiedMap.Get(ent.Key); !ok {
+			patch = append(patch, obj.OrderedMapEntry{Key: ent.Key, Value: nil})
+		}
+	}
+	for _, ent := range modifiedMap {
+		existing, ok := originalMap.Get(ent.Key)
+		switch {
+		case !ok:
+			patch = append(patch, ent)
+		case !equal(existing, ent.Value):
+			patch = append(patch, obj.OrderedMapEntry{Key: ent.Key, Value: createMergePatch(existing, ent.Value)})
+		}
+	}
+	return patch
+}
@@ -0,0 +1,294 @@
+package patch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+func parse(t *testing.T, s string) interface{} {
+	t.Helper()
+	doc, err := Read(json.NewDecoder(strings.NewReader(s)))
+	Wish(t, err, ShouldEqual, nil)
+	return doc
+}
+
+func render(t *testing.T, doc interface{}) string {
+	t.Helper()
+	var buf bytes.Buffer
+	Wish(t, Write(json.NewEncoder(&buf, json.EncodeOptions{}), doc), ShouldEqual, nil)
+	return buf.String()
+}
+
+func TestMergePatch(t *testing.T) {
+	// The examples from RFC 7386, Appendix A.
+	for _, tr := range []struct {
+		doc, patch, expect string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		t.Run(tr.doc+" + "+tr.patch, func(t *testing.T) {
+			result, err := MergePatch(parse(t, tr.doc), parse(t, tr.patch))
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, render(t, result), ShouldEqual, tr.expect)
+
+			var buf bytes.Buffer
+			err = MergePatchTokens(
+				json.NewEncoder(&buf, json.EncodeOptions{}),
+				json.NewDecoder(strings.NewReader(tr.doc)),
+				json.NewDecoder(strings.NewReader(tr.patch)),
+			)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, buf.String(), ShouldEqual, tr.expect)
+		})
+	}
+	t.Run("doesn't modify the original", func(t *testing.T) {
+		doc := parse(t, `{"a":{"b":1}}`)
+		_, err := MergePatch(doc, parse(t, `{"a":{"b":2}}`))
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, render(t, doc), ShouldEqual, `{"a":{"b":1}}`)
+	})
+	t.Run("accepts plain maps", func(t *testing.T) {
+		result, err := MergePatch(map[string]interface{}{"x": 1, "y": 2}, map[string]interface{}{"y": nil})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, render(t, result), ShouldEqual, `{"x":1}`)
+	})
+}
+
+func TestCreateMergePatch(t *testing.T) {
+	for _, tr := range []struct {
+		original, modified, expect string
+	}{
+		{`{"a":"b","c":{"d":"e","f":"g"}}`, `{"a":"z","c":{"d":"e"}}`, `{"a":"z","c":{"f":null}}`},
+		{`{"a":1}`, `{"a":1}`, `{}`},
+		{`{"a":1}`, `["x"]`, `["x"]`},
+		{`{"a":1,"b":2}`, `{"c":3}`, `{"a":null,"b":null,"c":3}`},
+	} {
+		t.Run(tr.original+" -> "+tr.modified, func(t *testing.T) {
+			p, err := CreateMergePatch(parse(t, tr.original), parse(t, tr.modified))
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, render(t, p), ShouldEqual, tr.expect)
+			// Applying the patch gets us the modified document.
+			result, err := MergePatch(parse(t, tr.original), p)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, equal(result, parse(t, tr.modified)), ShouldEqual, true)
+		})
+	}
+}
+
+func parsePatch(t *testing.T, s string) Patch {
+	t.Helper()
+	var p Patch
+	Wish(t, json.Unmarshal([]byte(s), &p), ShouldEqual, nil)
+	return p
+}
+
+func TestJSONPatch(t *testing.T) {
+	// The examples from RFC 6902, Appendix A.
+	for _, tr := range []struct {
+		name, doc, patch, expect, err string
+	}{
+		{"adding an object member",
+			`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`,
+			`{"foo":"bar","baz":"qux"}`, ""},
+		{"adding an array element",
+			`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			`{"foo":["bar","qux","baz"]}`, ""},
+		{"removing an object member",
+			`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`,
+			`{"foo":"bar"}`, ""},
+		{"removing an array element",
+			`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`,
+			`{"foo":["bar","baz"]}`, ""},
+		{"replacing a value",
+			`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			`{"baz":"boo","foo":"bar"}`, ""},
+		{"moving a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, ""},
+		{"moving an array element",
+			`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`, ""},
+		{"testing a value: success",
+			`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`, ""},
+		{"testing a value: error",
+			`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`,
+			``, `patch operation 0 (test "/baz") failed: test failed`},
+		{"adding a nested member object",
+			`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`, ""},
+		{"ignoring unrecognized elements",
+			`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`,
+			`{"foo":"bar","baz":"qux"}`, ""},
+		{"adding to a nonexistent target",
+			`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			``, `patch operation 0 (add "/baz/bat") failed: no such key "baz"`},
+		{"~ escape ordering",
+			`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`,
+			`{"/":9,"~1":10}`, ""},
+		{"comparing strings and numbers",
+			`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`,
+			``, `patch operation 0 (test "/~01") failed: test failed`},
+		{"adding an array value",
+			`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			`{"foo":["bar",["abc","def"]]}`, ""},
+		// A few more of our own.
+		{"copying a value",
+			`{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			`{"a":{"b":1},"c":{"b":2}}`, ""},
+		{"replacing the whole document",
+			`{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`,
+			`[1]`, ""},
+		{"moving into a child of itself",
+			`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			``, `patch operation 0 (move "/a/b/c") failed: cannot move a value into one of its own children`},
+		{"moving a value onto itself",
+			`{"a":1}`, `[{"op":"move","from":"/a","path":"/a"}]`,
+			`{"a":1}`, ""},
+		{"moving a nonexistent value onto itself",
+			`{"a":1}`, `[{"op":"move","from":"/b","path":"/b"}]`,
+			``, `patch operation 0 (move "/b") failed: no such key "b"`},
+		{"index with leading zero",
+			`[1,2]`, `[{"op":"remove","path":"/01"}]`,
+			``, `patch operation 0 (remove "/01") failed: "01" is not an array index`},
+		{"index out of range",
+			`[1,2]`, `[{"op":"add","path":"/3","value":3}]`,
+			``, `patch operation 0 (add "/3") failed: array index 3 out of range`},
+	} {
+		t.Run(tr.name, func(t *testing.T) {
+			doc := parse(t, tr.doc)
+			result, err := parsePatch(t, tr.patch).Apply(doc)
+			if tr.err != "" {
+				Wish(t, err.Error(), ShouldEqual, tr.err)
+				Wish(t, result, ShouldEqual, nil)
+				return
+			}
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, render(t, result), ShouldEqual, tr.expect)
+			Wish(t, render(t, doc), ShouldEqual, tr.doc) // unmodified.
+		})
+	}
+	t.Run("missing value is rejected", func(t *testing.T) {
+		var p Patch
+		err := json.Unmarshal([]byte(`[{"op":"add","path":"/a"}]`), &p)
+		Wish(t, err.Error(), ShouldEqual, `patch operation is missing "value"`)
+	})
+	t.Run("marshals with only the members used", func(t *testing.T) {
+		bs, err := json.Marshal(Patch{
+			{Op: "add", Path: "/a", Value: nil},
+			{Op: "remove", Path: "/b"},
+			{Op: "move", From: "/c", Path: "/d"},
+		})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, string(bs), ShouldEqual, `[{"op":"add","path":"/a","value":null},{"op":"remove","path":"/b"},{"op":"move","path":"/d","from":"/c"}]`)
+	})
+	t.Run("on tokens", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := parsePatch(t, `[{"op":"add","path":"/b","value":2}]`).ApplyTokens(
+			json.NewEncoder(&buf, json.EncodeOptions{}),
+			json.NewDecoder(strings.NewReader(`{"a":1}`)),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, buf.String(), ShouldEqual, `{"a":1,"b":2}`)
+	})
+}
+
+func TestObjects(t *testing.T) {
+	type Config struct {
+		Name  string
+		Port  int
+		Tags  []string
+		Extra map[string]string
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(Config{}).StructMap().Autogenerate().Complete(),
+	)
+	base := func() Config {
+		return Config{Name: "svc", Port: 80, Tags: []string{"a"}, Extra: map[string]string{"k": "v"}}
+	}
+	t.Run("json patch", func(t *testing.T) {
+		cfg := base()
+		err := parsePatch(t, `[{"op":"replace","path":"/port","value":8080},{"op":"add","path":"/tags/-","value":"b"},{"op":"remove","path":"/extra/k"}]`).ApplyObject(&cfg, atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, cfg, ShouldEqual, Config{Name: "svc", Port: 8080, Tags: []string{"a", "b"}, Extra: map[string]string{}})
+	})
+	t.Run("failed json patch leaves the object alone", func(t *testing.T) {
+		cfg := base()
+		err := parsePatch(t, `[{"op":"replace","path":"/port","value":8080},{"op":"remove","path":"/nope"}]`).ApplyObject(&cfg, atl)
+		Wish(t, err.Error(), ShouldEqual, `patch operation 1 (remove "/nope") failed: no such key "nope"`)
+		Wish(t, cfg, ShouldEqual, base())
+	})
+	t.Run("merge patch", func(t *testing.T) {
+		cfg := base()
+		err := MergePatchObject(&cfg, json.NewDecoder(strings.NewReader(`{"name":"svc2","extra":{"k":null,"k2":"v2"}}`)), atl)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, cfg, ShouldEqual, Config{Name: "svc2", Port: 80, Tags: []string{"a"}, Extra: map[string]string{"k2": "v2"}})
+	})
+	t.Run("diff", func(t *testing.T) {
+		a := base()
+		b := base()
+		b.Port = 443
+		b.Tags = nil
+		b.Extra["k3"] = "v3"
+		aTree, err := FromObject(a, atl)
+		Wish(t, err, ShouldEqual, nil)
+		bTree, err := FromObject(b, atl)
+		Wish(t, err, ShouldEqual, nil)
+		p, err := Diff(aTree, bTree)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, p, ShouldEqual, Patch{
+			{Op: "replace", Path: "/port", Value: 443},
+			{Op: "replace", Path: "/tags", Value: nil},
+			{Op: "add", Path: "/extra/k3", Value: "v3"},
+		})
+		Wish(t, p.ApplyObject(&a, atl), ShouldEqual, nil)
+		Wish(t, a, ShouldEqual, b)
+	})
+}
+
+func TestDiff(t *testing.T) {
+	for _, tr := range []struct {
+		original, modified, expect string
+	}{
+		{`{"a":1,"b":2}`, `{"a":1,"b":3,"c":4}`, `[{"op":"replace","path":"/b","value":3},{"op":"add","path":"/c","value":4}]`},
+		{`{"a":{"x/y":1}}`, `{"a":{}}`, `[{"op":"remove","path":"/a/x~1y"}]`},
+		{`[1,2,3]`, `[1,5]`, `[{"op":"replace","path":"/1","value":5},{"op":"remove","path":"/2"}]`},
+		{`[1]`, `[1,2,3]`, `[{"op":"add","path":"/1","value":2},{"op":"add","path":"/2","value":3}]`},
+		{`{"a":1}`, `"x"`, `[{"op":"replace","path":"","value":"x"}]`},
+		{`{"a":[1]}`, `{"a":[1]}`, `[]`},
+	} {
+		t.Run(tr.original+" -> "+tr.modified, func(t *testing.T) {
+			p, err := Diff(parse(t, tr.original), parse(t, tr.modified))
+			Wish(t, err, ShouldEqual, nil)
+			if p == nil {
+				p = Patch{}
+			}
+			bs, err := json.Marshal(p)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, string(bs), ShouldEqual, tr.expect)
+			result, err := p.Apply(parse(t, tr.original))
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, equal(result, parse(t, tr.modified)), ShouldEqual, true)
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/polydawn/refmt/obj"
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
+)
+
+var emptyAtlas = atlas.MustBuild()
+
+/*
+	Read a document from the token source into a tree.
+*/
+func Read(src shared.TokenSource) (interface{}, error) {
+	var doc interface{}
+	unmarshaller := obj.NewUnmarshallerWithOptions(emptyAtlas, obj.UnmarshalOptions{OrderedMaps: true})
+	if err := unmarshaller.Bind(&doc); err != nil {
+		return nil, err
+	}
+	if err := (shared.TokenPump{src, unmarshaller}).Run(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+/*
+	Write a tree to the token sink.
+*/
+func Write(dst shared.TokenSink, doc interface{}) error {
+	marshaller := obj.NewMarshaller(emptyAtlas)
+	if err := marshaller.Bind(doc); err != nil {
+		return err
+	}
+	return shared.TokenPump{marshaller, dst}.Run()
+}
+
+/*
+	Convert a Go object to a tree, marshalling it with the atlas.
+*/
+func FromObject(v interface{}, atl atlas.Atlas) (interface{}, error) {
+	var doc interface{}
+	marshaller := obj.NewMarshaller(atl)
+	if err := marshaller.Bind(v); err != nil {
+		return nil, err
+	}
+	unmarshaller := obj.NewUnmarshallerWithOptions(emptyAtlas, obj.UnmarshalOptions{OrderedMaps: true})
+	if err := unmarshaller.Bind(&doc); err != nil {
+		return nil, err
+	}
+	if err := (shared.TokenPump{marshaller, unmarshaller}).Run(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+/*
+	Fill a Go object from a tree, unmarshalling it with the atlas.
+	The target (which must be a pointer) is entirely replaced.
+*/
+func ToObject(doc interface{}, target interface{}, atl atlas.Atlas) error {
+	marshaller := obj.NewMarshaller(emptyAtlas)
+	if err := marshaller.Bind(doc); err != nil {
+		return err
+	}
+	unmarshaller := obj.NewUnmarshallerWithOptions(atl, obj.UnmarshalOptions{Merge: obj.MergeMode_Replace})
+	if err := unmarshaller.Bind(target); err != nil {
+		return err
+	}
+	return shared.TokenPump{marshaller, unmarshaller}.Run()
+}
+
+// Bring a tree into canonical form.  The result is always a deep copy.
+func normalize(doc interface{}) (interface{}, error) {
+	return FromObject(doc, emptyAtlas)
+}
+
+/*
+	Check whether two (canonical) trees are equal.
+	Maps are equal if they have the same entries, regardless of order;
+	numbers are equal if their values are numerically equal.
+*/
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case obj.OrderedMap:
+		b, ok := b.(obj.OrderedMap)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for _, ent := range a {
+			v, ok := b.Get(ent.Key)
+			if !ok || !equal(ent.Value, v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case []byte:
+		b, ok := b.([]byte)
+		return ok && bytes.Equal(a, b)
+	case int:
+		switch b := b.(type) {
+		case int:
+			return a == b
+		case float64:
+			return float64(a) == b
+		}
+		return false
+	case float64:
+		switch b := b.(type) {
+		case int:
+			return a == float64(b)
+		case float64:
+			return a == b
+		}
+		return false
+	default:
+		return a == b
+	}
+}
+
+// Parse an array index segment.  Leading zeros aren't allowed;
+// the index may equal the length only if 'end' is allowed (for adds), and "-" means the end.
+func parseIndex(seg string, length int, end bool) (int, error) {
+	if seg == "-" && end {
+		return length, nil
+	}
+	i, err := strconv.Atoi(seg)
+	if err != nil || i < 0 || (len(seg) > 1 && seg[0] == '0') || seg[0] == '+' {
+		return 0, fmt.Errorf("%q is not an array index", seg)
+	}
+	if i > length || (i == length && !end) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// Return the child of a container.
+func child(node interface{}, seg string) (interface{}, error) {
+	switch node := node.(type) {
+	case obj.OrderedMap:
+		v, ok := node.Get(seg)
+		if !ok {
+			return nil, fmt.Errorf("no such key %q", seg)
+		}
+		return v, nil
+	case []interface{}:
+		i, err := parseIndex(seg, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		return node[i], nil
+	default:
+		return nil, fmt.Errorf("cannot index into a %s", kindName(node))
+	}
+}
+
+// Return the value at the path.
+func get(doc interface{}, segs []string) (interface{}, error) {
+	for _, seg := range segs {
+		var err error
+		if doc, err = child(doc, seg); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+/*
+	Update the container which is the parent of the path, using the func
+	(which is given the container and the last segment of the path,
+	and returns the updated container).  The path must not be empty.
+	Returns the updated document.
+*/
+func update(doc interface{}, segs []string, fn func(parent interface{}, seg string) (interface{}, error)) (interface{}, error) {
+	if len(segs) == 1 {
+		return fn(doc, segs[0])
+	}
+	c, err := child(doc, segs[0])
+	if err != nil {
+		return nil, err
+	}
+	c, err = update(c, segs[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+	switch node := doc.(type) {
+	case obj.OrderedMap:
+		node.Set(segs[0], c)
+		return node, nil
+	case []interface{}:
+		i, _ := parseIndex(segs[0], len(node), false) // already checked by child.
+		node[i] = c
+		return node, nil
+	}
+	panic("unreachable")
+}
+
+// Remove the key or index from the container.
+func removeChild(node interface{}, seg string) (interface{}, error) {
+	switch node := node.(type) {
+	case obj.OrderedMap:
+		for i, ent := range node {
+			if ent.Key == seg {
+				return append(node[:i:i], node[i+1:]...), nil
+			}
+		}
+		return nil, fmt.Errorf("no such key %q", seg)
+	case []interface{}:
+		i, err := parseIndex(seg, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		return append(node[:i:i], node[i+1:]...), nil
+	default:
+		return nil, fmt.Errorf("cannot index into a %s", kindName(node))
+	}
+}
+
+// Set the key in the container, or insert at the index.
+func addChild(node interface{}, seg string, v interface{}) (interface{}, error) {
+	switch node := node.(type) {
+	case obj.OrderedMap:
+		node.Set(seg, v)
+		return node, nil
+	case []interface{}:
+		i, err := parseIndex(seg, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = v
+		return node, nil
+	default:
+		return nil, fmt.Errorf("cannot index into a %s", kindName(node))
+	}
+}
+
+// Overwrite the existing key or index in the container.
+func setChild(node interface{}, seg string, v interface{}) (interface{}, error) {
+	switch node := node.(type) {
+	case obj.OrderedMap:
+		if _, ok := node.Get(seg); !ok {
+			return nil, fmt.Errorf("no such key %q", seg)
+		}
+		node.Set(seg, v)
+		return node, nil
+	case []interface{}:
+		i, err := parseIndex(seg, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = v
+		return node, nil
+	default:
+		return nil, fmt.Errorf("cannot index into a %s", kindName(node))
+	}
+}
+
+func kindName(node interface{}) string {
+	switch node.(type) {
+	case nil:
+		return "null"
+	case obj.OrderedMap:
+		return "map"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case []byte:
+		return "bytes"
+	case bool:
+		return "bool"
+	default:
+		return "number"
+	}
+}
@@ -65,7 +65,9 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 		case TArrClose:
 			return true, fmt.Errorf("unexpected arrClose; expected start of value")
 		default:
-			d.emitValue(tok)
+			if err := d.emitValue(tok); err != nil {
+				return true, err
+			}
 			d.wr.Write(wordBreak)
 			return true, nil
 		}
@@ -82,9 +84,11 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 			return true, fmt.Errorf("unexpected arrClose; expected start of key or end of map")
 		default:
 			switch tok.Type {
-			case TString, TInt, TUint:
+			case TString, TInt, TUint, TBool:
 				d.wr.Write(indentWord(len(d.stack)))
-				d.emitValue(tok)
+				if err := d.emitValue(tok); err != nil {
+					return true, err
+				}
 				d.wr.Write(wordColon)
 				d.current = phase_mapExpectValue
 				return false, nil
@@ -108,7 +112,9 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 			return true, fmt.Errorf("unexpected arrClose; expected start of value")
 		default:
 			d.current = phase_mapExpectKeyOrEnd
-			d.emitValue(tok)
+			if err := d.emitValue(tok); err != nil {
+				return true, err
+			}
 			d.wr.Write(wordBreak)
 			return false, nil
 		}
@@ -129,12 +135,14 @@ func (d *Encoder) Step(tok *Token) (done bool, err error) {
 			return d.popPhase()
 		default:
 			d.wr.Write(indentWord(len(d.stack)))
-			d.emitValue(tok)
+			if err := d.emitValue(tok); err != nil {
+				return true, err
+			}
 			d.wr.Write(wordBreak)
 			return false, nil
 		}
 	default:
-		panic("Unreachable")
+		return true, fmt.Errorf("pretty encoder in invalid phase %d", d.current)
 	}
 }
 
@@ -150,7 +158,7 @@ func (d *Encoder) popPhase() (bool, error) {
 		return true, nil
 	}
 	if n < 0 { // the state machines are supposed to have already errored better
-		panic("prettyEncoder stack overpopped")
+		return true, fmt.Errorf("pretty encoder stack overpopped")
 	}
 	d.current = d.stack[n-1]
 	d.stack = d.stack[0:n]
@@ -201,7 +209,7 @@ func (d *Encoder) emitArrClose(tok *Token) {
 	d.wr.Write(wordBreak)
 }
 
-func (d *Encoder) emitValue(tok *Token) {
+func (d *Encoder) emitValue(tok *Token) error {
 	if tok.Tagged {
 		d.wr.Write(wordTag)
 		d.wr.Write([]byte(strconv.Itoa(tok.Tag)))
@@ -233,8 +241,9 @@ func (d *Encoder) emitValue(tok *Token) {
 		b := strconv.AppendFloat(d.scratch[:0], tok.Float64, 'f', 6, 64)
 		d.wr.Write(b)
 	default:
-		panic(fmt.Errorf("TODO finish more pretty.Encoder primitives support: unhandled token %s", tok))
+		return fmt.Errorf("unexpected %s; expected start of value", tok.Type)
 	}
+	return nil
 }
 
 func (d *Encoder) writeByte(b byte) {
@@ -8,7 +8,9 @@ import (
 	"github.com/polydawn/refmt"
 	"github.com/polydawn/refmt/cbor"
 	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/obj"
 	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/polydawn/refmt/shared"
 )
 
 func TestRoundTrip(t *testing.T) {
@@ -84,6 +86,114 @@ func TestRoundTrip(t *testing.T) {
 	})
 }
 
+func TestRoundTripMapKeys(t *testing.T) {
+	value := map[int]string{-3: "a", 0: "b", 500: "c"}
+	t.Run("cbor", func(t *testing.T) {
+		bs, err := refmt.Marshal(cbor.EncodeOptions{}, value)
+		if err != nil {
+			t.Fatalf("failed encoding: %s", err)
+		}
+		if expect := "a32261610061621901f46163"; fmt.Sprintf("%x", bs) != expect {
+			t.Errorf("cbor should use native int keys: expected %s, got %x", expect, bs)
+		}
+		var slot map[int]string
+		if err := refmt.Unmarshal(cbor.DecodeOptions{}, bs, &slot); err != nil {
+			t.Fatalf("failed decoding: %s", err)
+		}
+		if fmt.Sprint(slot) != fmt.Sprint(value) {
+			t.Errorf("round trip mismatch: %v != %v", slot, value)
+		}
+	})
+	t.Run("json", func(t *testing.T) {
+		bs, err := refmt.Marshal(json.EncodeOptions{}, value)
+		if err != nil {
+			t.Fatalf("failed encoding: %s", err)
+		}
+		if expect := `{"-3":"a","0":"b","500":"c"}`; string(bs) != expect {
+			t.Errorf("json should stringify keys: expected %s, got %s", expect, bs)
+		}
+		var slot map[int]string
+		if err := refmt.Unmarshal(json.DecodeOptions{}, bs, &slot); err != nil {
+			t.Fatalf("failed decoding: %s", err)
+		}
+		if fmt.Sprint(slot) != fmt.Sprint(value) {
+			t.Errorf("round trip mismatch: %v != %v", slot, value)
+		}
+	})
+}
+
+func TestRoundTripArrayStream(t *testing.T) {
+	counter := func() obj.ArrayStream {
+		i := 0
+		return obj.NewArrayStream(func() (int, bool) {
+			i++
+			return i, i <= 3
+		})
+	}
+	t.Run("cbor", func(t *testing.T) {
+		bs, err := refmt.Marshal(cbor.EncodeOptions{}, counter())
+		if err != nil {
+			t.Fatalf("failed encoding: %s", err)
+		}
+		if expect := "9f010203ff"; fmt.Sprintf("%x", bs) != expect {
+			t.Errorf("cbor should use an indefinite-length array: expected %s, got %x", expect, bs)
+		}
+		var slot []int
+		if err := refmt.Unmarshal(cbor.DecodeOptions{}, bs, &slot); err != nil {
+			t.Fatalf("failed decoding: %s", err)
+		}
+		if fmt.Sprint(slot) != "[1 2 3]" {
+			t.Errorf("round trip mismatch: %v", slot)
+		}
+	})
+	t.Run("json", func(t *testing.T) {
+		bs, err := refmt.Marshal(json.EncodeOptions{}, counter())
+		if err != nil {
+			t.Fatalf("failed encoding: %s", err)
+		}
+		if expect := `[1,2,3]`; string(bs) != expect {
+			t.Errorf("expected %s, got %s", expect, bs)
+		}
+	})
+}
+
+func TestRoundTripValueSharing(t *testing.T) {
+	type Node struct {
+		Name string
+		Next *Node
+	}
+	atl := atlas.MustBuild(
+		atlas.BuildEntry(Node{}).StructMap().Autogenerate().Complete(),
+	)
+	a := &Node{Name: "a"}
+	a.Next = &Node{Name: "b", Next: a}
+
+	var buf bytes.Buffer
+	marshaller := obj.NewMarshallerWithOptions(atl, obj.MarshalOptions{ValueSharing: true})
+	if err := marshaller.Bind(a); err != nil {
+		t.Fatalf("failed binding: %s", err)
+	}
+	if err := (shared.TokenPump{marshaller, cbor.NewEncoder(&buf)}).Run(); err != nil {
+		t.Fatalf("failed encoding: %s", err)
+	}
+	// 0xd81c is tag 28 (shareable); 0xd81d is tag 29 (sharedref).
+	if expect := "d81ca2646e616d656161646e657874d81ca2646e616d656162646e657874d81d00"; fmt.Sprintf("%x", buf.Bytes()) != expect {
+		t.Errorf("expected %s, got %x", expect, buf.Bytes())
+	}
+
+	var slot Node
+	unmarshaller := obj.NewUnmarshallerWithOptions(atl, obj.UnmarshalOptions{ValueSharing: true})
+	if err := unmarshaller.Bind(&slot); err != nil {
+		t.Fatalf("failed binding: %s", err)
+	}
+	if err := (shared.TokenPump{cbor.NewDecoder(cbor.DecodeOptions{}, &buf), unmarshaller}).Run(); err != nil {
+		t.Fatalf("failed decoding: %s", err)
+	}
+	if slot.Name != "a" || slot.Next.Name != "b" || slot.Next.Next != &slot {
+		t.Errorf("cycle not reconstructed: %#v", slot)
+	}
+}
+
 func testRoundTripAllEncodings(
 	t *testing.T,
 	value interface{},
@@ -0,0 +1,71 @@
+package shared
+
+import (
+	"fmt"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+// The errors here are returned by the Validator (and the validating sink
+// and source wrappers).  Each carries the index of the offending token
+// within the value (counting from zero), and the token itself.
+
+// ErrInvalidTokenType is returned for a token whose Type isn't one of the
+// known TokenTypes.
+type ErrInvalidTokenType struct {
+	Index int
+	Token Token
+}
+
+func (e ErrInvalidTokenType) Error() string {
+	return fmt.Sprintf("invalid token stream: token %d has invalid type %q", e.Index, byte(e.Token.Type))
+}
+
+// ErrUnbalancedToken is returned when a token appears where it can't:
+// a close with no matching open (or the wrong kind of open),
+// or anything at all after a value is complete.
+type ErrUnbalancedToken struct {
+	Index    int
+	Token    Token
+	Expected string // Freeform description of what could have appeared instead.
+}
+
+func (e ErrUnbalancedToken) Error() string {
+	return fmt.Sprintf("invalid token stream: token %d: unexpected %s; expected %s", e.Index, e.Token, e.Expected)
+}
+
+// ErrInvalidMapKey is returned when a map key isn't a string, int, uint, or bool.
+type ErrInvalidMapKey struct {
+	Index int
+	Token Token
+}
+
+func (e ErrInvalidMapKey) Error() string {
+	return fmt.Sprintf("invalid token stream: token %d: %s cannot be a map key", e.Index, e.Token)
+}
+
+// ErrLengthMismatch is returned when a map or array declared a Length,
+// and then had a different number of entries.  Index is of the token
+// which revealed the mismatch (either the extra entry, or the early close).
+type ErrLengthMismatch struct {
+	Index    int
+	Token    Token
+	Declared int
+	Actual   int // When there were too many entries, this is the count so far.
+}
+
+func (e ErrLengthMismatch) Error() string {
+	return fmt.Sprintf("invalid token stream: token %d: %s: declared length %d, but got %d entries", e.Index, e.Token, e.Declared, e.Actual)
+}
+
+// ErrIncompleteValue is returned by the validating wrappers when the
+// source or sink they wrap says it's done before the value is complete,
+// or isn't done when it is.
+type ErrIncompleteValue struct {
+	Index  int
+	Reason string
+}
+
+func (e ErrIncompleteValue) Error() string {
+	return fmt.Sprintf("invalid token stream: token %d: %s", e.Index, e.Reason)
+}
@@ -0,0 +1,102 @@
+package shared
+
+import (
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	TokenSinkFunc adapts a function to a TokenSink.
+*/
+type TokenSinkFunc func(consume *Token) (done bool, err error)
+
+func (f TokenSinkFunc) Step(consume *Token) (done bool, err error) {
+	return f(consume)
+}
+
+/*
+	TokenMiddleware wraps a TokenSink in another, which sees every token
+	on its way into the sink -- to count it, log it, or even change it.
+	Middleware should pass each token on to next (unless it's returning an
+	error), and return what next returns.
+*/
+type TokenMiddleware func(next TokenSink) TokenSink
+
+/*
+	With returns a copy of the pump whose tokens go through the middleware
+	on their way to the sink.  The first middleware given sees each token
+	first.  A pump without middleware pays nothing for the feature.
+*/
+func (p TokenPump) With(middleware ...TokenMiddleware) TokenPump {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		p.TokenSink = middleware[i](p.TokenSink)
+	}
+	return p
+}
+
+/*
+	ObserveTokens returns middleware which calls fn with each token and the
+	depth it's at (zero for the tokens of the outermost value, one for the
+	tokens inside it, and so on; a map or array's close is at the same depth
+	as its open), before passing the token on.  If fn returns an error,
+	the pump stops with it.
+
+	fn must not keep the token (or its Bytes) after it returns;
+	it's reused for the next one.
+*/
+func ObserveTokens(fn func(tok *Token, depth int) error) TokenMiddleware {
+	return func(next TokenSink) TokenSink {
+		depth := 0
+		return TokenSinkFunc(func(tok *Token) (bool, error) {
+			d := depth
+			switch tok.Type {
+			case TMapOpen, TArrOpen:
+				depth++
+			case TMapClose, TArrClose:
+				depth--
+				d = depth
+			}
+			if err := fn(tok, d); err != nil {
+				return true, err
+			}
+			return next.Step(tok)
+		})
+	}
+}
+
+/*
+	PumpStats holds counts of the tokens that pass through CountTokens.
+*/
+type PumpStats struct {
+	Tokens   int64 // Tokens seen.
+	Bytes    int64 // Total length of the strings and byte slices in the tokens seen.
+	Depth    int   // Current depth of nesting of maps and arrays.
+	MaxDepth int   // Deepest nesting seen.
+}
+
+/*
+	CountTokens returns middleware which keeps stats up to date as tokens
+	pass through it.  Stats aren't synchronized: if you want to watch them
+	from another goroutine while the pump runs, use ObserveTokens and
+	do whatever synchronization you need there.
+*/
+func CountTokens(stats *PumpStats) TokenMiddleware {
+	return func(next TokenSink) TokenSink {
+		return TokenSinkFunc(func(tok *Token) (bool, error) {
+			stats.Tokens++
+			switch tok.Type {
+			case TMapOpen, TArrOpen:
+				stats.Depth++
+				if stats.Depth > stats.MaxDepth {
+					stats.MaxDepth = stats.Depth
+				}
+			case TMapClose, TArrClose:
+				stats.Depth--
+			case TString:
+				stats.Bytes += int64(len(tok.Str))
+			case TBytes:
+				stats.Bytes += int64(len(tok.Bytes))
+			}
+			return next.Step(tok)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+const (
+	DefaultPipelineBatchSize = 256
+	DefaultPipelineBatches   = 4
+)
+
+/*
+	PipelinedPump moves tokens from a TokenSource to a TokenSink, like
+	TokenPump, but steps the source and the sink in separate goroutines --
+	so e.g. decoding and encoding a large document can use two cores.
+
+	Tokens are handed between the goroutines in batches, through a ring of
+	batches which are reused: the source goroutine fills one batch while the
+	sink goroutine drains another.  At most Batches batches are in flight,
+	so memory use is bounded however far ahead the source gets.
+
+	Sources may reuse their buffers for the Bytes of tokens (the same memory
+	may hold the next token's bytes; decoders reading with zero-copy reads
+	do), so the pump copies Bytes into memory owned by the batch, which stays
+	valid until the sink has been stepped with the token.  (As with any source, a sink which keeps Bytes longer than that
+	must copy them.)  Str needs no copy: Go strings are immutable, and the
+	batch holding a reference to one is enough to keep it.
+
+	The outcome is the same as TokenPump's, errors included: the sink sees
+	the tokens in order, and an error from the source is returned only after
+	the sink has been stepped with every token before it (so if the sink
+	errors first, the sink's error is the one returned).  The source may be
+	stepped up to BatchSize*Batches tokens ahead of the sink, though, so if
+	the sink errors (or the pump is cancelled), the source may have been
+	read further than the sink got.  Neither is used after Run returns.
+
+	Handing tokens between goroutines costs a little per token, so this only
+	pays off when both the source and the sink do real work per token
+	(e.g. decoding CBOR from and encoding JSON to buffered streams).
+*/
+type PipelinedPump struct {
+	TokenSource
+	TokenSink
+	BatchSize int // Tokens per batch.  If zero, DefaultPipelineBatchSize.
+	Batches   int // Batches in the ring.  If zero, DefaultPipelineBatches.
+}
+
+// A batch of tokens in flight between the goroutines of a PipelinedPump.
+type tokenBatch struct {
+	toks  []Token
+	arena []byte // holds copies of the Bytes of toks.
+	done  bool   // whether the source was done after the last of toks.
+	err   error  // error from the source after the last of toks, if any.
+}
+
+func (p PipelinedPump) Run() error {
+	return p.RunContext(context.Background())
+}
+
+/*
+	RunContext is like Run, but stops with the context's error if the
+	context is cancelled (or its deadline passes) before the pump is done.
+
+	The context is checked between batches.  As with TokenPump.RunContext,
+	a source or sink that's blocked can't be interrupted by it; and since
+	RunContext waits for both goroutines to stop before returning,
+	it can't return until they're unblocked.
+*/
+func (p PipelinedPump) RunContext(ctx context.Context) error {
+	batchSize, batches := p.BatchSize, p.Batches
+	if batchSize <= 0 {
+		batchSize = DefaultPipelineBatchSize
+	}
+	if batches <= 0 {
+		batches = DefaultPipelineBatches
+	}
+	// Both channels can hold every batch, so sends never block;
+	// the goroutines only ever wait to receive.
+	free := make(chan *tokenBatch, batches)
+	full := make(chan *tokenBatch, batches)
+	for i := 0; i < batches; i++ {
+		free <- &tokenBatch{toks: make([]Token, 0, batchSize)}
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		p.produce(free, full, stop, batchSize)
+	}()
+	err := p.consume(ctx, free, full)
+	close(stop)
+	<-stopped
+	return err
+}
+
+// Fill batches from the source, until it's done or errors,
+// or until told to stop.
+func (p PipelinedPump) produce(free <-chan *tokenBatch, full chan<- *tokenBatch, stop <-chan struct{}, batchSize int) {
+	for {
+		// Check for stop first: if a batch is free too, select would
+		// pick between them at random.
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		var batch *tokenBatch
+		select {
+		case batch = <-free:
+		case <-stop:
+			return
+		}
+		batch.toks, batch.arena = batch.toks[:0], batch.arena[:0]
+		for len(batch.toks) < batchSize {
+			batch.toks = batch.toks[:len(batch.toks)+1]
+			tok := &batch.toks[len(batch.toks)-1]
+			// This slot's old Bytes may point into the arena, at memory
+			// that's been reused since; don't let the source write there.
+			tok.Bytes = nil
+			batch.done, batch.err = p.TokenSource.Step(tok)
+			if batch.err != nil {
+				batch.toks = batch.toks[:len(batch.toks)-1] // as in TokenPump, the sink doesn't see it.
+				break
+			}
+			if tok.Type == TBytes && len(tok.Bytes) > 0 {
+				start := len(batch.arena)
+				batch.arena = append(batch.arena, tok.Bytes...)
+				tok.Bytes = batch.arena[start:len(batch.arena):len(batch.arena)]
+			}
+			if batch.done {
+				break
+			}
+		}
+		full <- batch
+		if batch.done || batch.err != nil {
+			return
+		}
+	}
+}
+
+// Drain batches into the sink, until the source's last token or error,
+// or an error from the sink, or cancellation.
+func (p PipelinedPump) consume(ctx context.Context, free chan<- *tokenBatch, full <-chan *tokenBatch) error {
+	cancelled := ctx.Done()
+	for {
+		var batch *tokenBatch
+		select {
+		case batch = <-full:
+		case <-cancelled:
+			return ctx.Err()
+		}
+		var sinkDone bool
+		for i := range batch.toks {
+			var err error
+			if sinkDone, err = p.TokenSink.Step(&batch.toks[i]); err != nil {
+				return err
+			}
+		}
+		switch {
+		case batch.err != nil:
+			return batch.err
+		case batch.done:
+			if sinkDone {
+				return nil
+			}
+			return fmt.Errorf("src at end of item but sink expects more")
+		}
+		free <- batch
+	}
+}
@@ -0,0 +1,212 @@
+package shared_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+// Tokens for an array of n maps, each with a few keys of various kinds
+// (and if withBytes, a short byte string).
+func pipelineFixture(n int, withBytes bool) []Token {
+	toks := []Token{{Type: TArrOpen, Length: n}}
+	for i := 0; i < n; i++ {
+		entries := 3
+		if withBytes {
+			entries++
+		}
+		toks = append(toks,
+			Token{Type: TMapOpen, Length: entries},
+			Token{Type: TString, Str: "id"}, Token{Type: TInt, Int: int64(i)},
+			Token{Type: TString, Str: "name"}, Token{Type: TString, Str: fmt.Sprintf("entry number %d", i)},
+			Token{Type: TString, Str: "score"}, Token{Type: TFloat64, Float64: float64(i) / 8},
+		)
+		if withBytes {
+			toks = append(toks,
+				Token{Type: TString, Str: "blob"}, Token{Type: TBytes, Bytes: []byte{byte(i), byte(i >> 8), 0xff}},
+			)
+		}
+		toks = append(toks, Token{Type: TMapClose})
+	}
+	return append(toks, Token{Type: TArrClose})
+}
+
+func pipelineFixtureCbor(t testing.TB, n int, withBytes bool) []byte {
+	var buf bytes.Buffer
+	err := shared.TokenPump{
+		shared.NewTokenSlice(pipelineFixture(n, withBytes)),
+		cbor.NewEncoder(&buf),
+	}.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A source which yields the Bytes of every token in the same buffer,
+// as sources reading with zero-copy reads may.
+type reusingSource struct {
+	src shared.TokenSource
+	buf []byte
+}
+
+func (s *reusingSource) Step(tok *Token) (bool, error) {
+	done, err := s.src.Step(tok)
+	if tok.Type == TBytes {
+		s.buf = append(s.buf[:0], tok.Bytes...)
+		tok.Bytes = s.buf
+	}
+	return done, err
+}
+
+// A sink which counts tokens, and errors at the given count (if nonzero).
+type countingSink struct {
+	n       int
+	errAt   int
+	sinkErr error
+}
+
+func (s *countingSink) Step(tok *Token) (bool, error) {
+	s.n++
+	if s.n == s.errAt {
+		return true, s.sinkErr
+	}
+	return false, nil
+}
+
+// A source which errors after n tokens.
+type failingSource struct {
+	endlessSource
+	n int
+}
+
+func (s *failingSource) Step(tok *Token) (bool, error) {
+	if s.endlessSource.n == s.n {
+		return true, fmt.Errorf("source failed")
+	}
+	return s.endlessSource.Step(tok)
+}
+
+func TestPipelinedPump(t *testing.T) {
+	t.Run("same as TokenPump", func(t *testing.T) {
+		doc := `{"a":[1,"xy",{"b":null}],"c":true,"d":[],"e":{}}`
+		for _, batchSize := range []int{0, 1, 2, 5} {
+			var buf bytes.Buffer
+			err := shared.PipelinedPump{
+				json.NewDecoder(strings.NewReader(doc)),
+				json.NewEncoder(&buf, json.EncodeOptions{}),
+				batchSize, 2,
+			}.Run()
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, buf.String(), ShouldEqual, doc)
+		}
+	})
+	t.Run("bytes are copied", func(t *testing.T) {
+		data := pipelineFixtureCbor(t, 500, true)
+		for _, batchSize := range []int{1, 7, 0} {
+			var buf bytes.Buffer
+			err := shared.PipelinedPump{
+				&reusingSource{src: cbor.NewDecoder(cbor.DecodeOptions{}, bytes.NewReader(data))},
+				cbor.NewEncoder(&buf),
+				batchSize, 3,
+			}.Run()
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, bytes.Equal(buf.Bytes(), data), ShouldEqual, true)
+		}
+	})
+	t.Run("source error, after the tokens before it", func(t *testing.T) {
+		src := &failingSource{n: 100}
+		sink := &countingSink{}
+		err := shared.PipelinedPump{src, sink, 16, 2}.Run()
+		Wish(t, err.Error(), ShouldEqual, "source failed")
+		Wish(t, sink.n, ShouldEqual, 100)
+	})
+	t.Run("sink error", func(t *testing.T) {
+		src := &failingSource{n: 1000}
+		sink := &countingSink{errAt: 10, sinkErr: fmt.Errorf("sink failed")}
+		err := shared.PipelinedPump{src, sink, 16, 2}.Run()
+		Wish(t, err.Error(), ShouldEqual, "sink failed")
+		Wish(t, sink.n, ShouldEqual, 10)
+		Wish(t, src.endlessSource.n <= 10+3*16, ShouldEqual, true) // read ahead no more than the ring holds.
+	})
+	t.Run("sink expects more", func(t *testing.T) {
+		err := shared.PipelinedPump{
+			shared.NewTokenSlice([]Token{{Type: TArrOpen, Length: -1}, {Type: TInt, Int: 1}}),
+			&shared.Validator{},
+			0, 0,
+		}.Run()
+		Wish(t, err.Error(), ShouldEqual, "src at end of item but sink expects more")
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		src := &endlessSource{}
+		sink := shared.ObserveTokens(func(tok *Token, _ int) error {
+			if tok.Int == 1000 {
+				cancel()
+			}
+			return nil
+		})(&shared.Validator{})
+		err := shared.PipelinedPump{src, sink, 0, 0}.RunContext(ctx)
+		Wish(t, err, ShouldEqual, context.Canceled)
+		n := src.n
+		Wish(t, n < 1000+6*shared.DefaultPipelineBatchSize, ShouldEqual, true) // stopped promptly.
+		Wish(t, src.n, ShouldEqual, n)                                          // and really stopped.
+	})
+	t.Run("already cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		sink := &countingSink{}
+		err := shared.PipelinedPump{&endlessSource{}, sink, 0, 0}.RunContext(ctx)
+		Wish(t, err, ShouldEqual, context.Canceled)
+		Wish(t, sink.n, ShouldEqual, 0)
+	})
+}
+
+// Transcode cbor (from a stream) to json, as a real conversion would.
+func benchmarkTranscode(b *testing.B, run func(src shared.TokenSource, sink shared.TokenSink) error) {
+	data := pipelineFixtureCbor(b, 10000, false)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src := cbor.NewDecoder(cbor.DecodeOptions{}, bytes.NewReader(data))
+		sink := json.NewEncoder(ioutil.Discard, json.EncodeOptions{})
+		if err := run(src, sink); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTranscodeTokenPump(b *testing.B) {
+	benchmarkTranscode(b, func(src shared.TokenSource, sink shared.TokenSink) error {
+		return shared.TokenPump{src, sink}.Run()
+	})
+}
+
+func BenchmarkTranscodePipelinedPump(b *testing.B) {
+	benchmarkTranscode(b, func(src shared.TokenSource, sink shared.TokenSink) error {
+		return shared.PipelinedPump{src, sink, 0, 0}.Run()
+	})
+}
+
+func BenchmarkTranscodePipelinedPumpSmallBatches(b *testing.B) {
+	benchmarkTranscode(b, func(src shared.TokenSource, sink shared.TokenSink) error {
+		return shared.PipelinedPump{src, sink, 16, 4}.Run()
+	})
+}
+
+func BenchmarkPipelinedPumpRun(b *testing.B) {
+	benchmarkPump(b, func(p shared.TokenPump) error {
+		return shared.PipelinedPump{p.TokenSource, p.TokenSink, 0, 0}.Run()
+	})
+}
@@ -0,0 +1,47 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Helpers for JSON Pointers (RFC 6901), which are how paths into token
+// streams are written throughout refmt: in the Selector and Transformer,
+// in errors from the obj package, in diffs, and in patches.
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// EscapePointerToken escapes a map key (or anything else) for use as one
+// segment of a JSON Pointer: "~" becomes "~0" and "/" becomes "~1".
+func EscapePointerToken(seg string) string {
+	return pointerEscaper.Replace(seg)
+}
+
+// UnescapePointerToken reverses EscapePointerToken.
+func UnescapePointerToken(seg string) string {
+	return pointerUnescaper.Replace(seg)
+}
+
+// AppendPointer appends a segment (escaping it) to a JSON Pointer.
+func AppendPointer(path string, seg string) string {
+	return path + "/" + pointerEscaper.Replace(seg)
+}
+
+// ParsePointer parses a JSON Pointer into its unescaped segments.
+// The empty pointer, which refers to the whole document, has none.
+func ParsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if path[0] != '/' {
+		return nil, fmt.Errorf("invalid path %q: must be empty or start with '/'", path)
+	}
+	segments := strings.Split(path[1:], "/")
+	for i, seg := range segments {
+		segments[i] = pointerUnescaper.Replace(seg)
+	}
+	return segments, nil
+}
@@ -0,0 +1,28 @@
+package shared_test
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/shared"
+)
+
+func TestPointer(t *testing.T) {
+	t.Run("escaping", func(t *testing.T) {
+		Wish(t, shared.EscapePointerToken("a/b~c"), ShouldEqual, "a~1b~0c")
+		Wish(t, shared.UnescapePointerToken("a~1b~0c"), ShouldEqual, "a/b~c")
+		Wish(t, shared.UnescapePointerToken("~01"), ShouldEqual, "~1")
+		Wish(t, shared.AppendPointer("/x", "~1"), ShouldEqual, "/x/~01")
+	})
+	t.Run("parsing", func(t *testing.T) {
+		segs, err := shared.ParsePointer("")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, segs, ShouldEqual, []string(nil))
+		segs, err = shared.ParsePointer("/a~1b//~01")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, segs, ShouldEqual, []string{"a/b", "", "~1"})
+		_, err = shared.ParsePointer("a")
+		Wish(t, err.Error(), ShouldEqual, `invalid path "a": must be empty or start with '/'`)
+	})
+}
@@ -1,10 +1,16 @@
 /*
 	The `shared` package defines helper types and functions used
-	internally by all the other refmt packages; it is not user-facing.
+	internally by all the other refmt packages.
+
+	It also holds the TokenSource and TokenSink interfaces, and a few
+	utilities for working with token streams directly: TokenPump,
+	PipelinedPump, Selector, Transformer, TokenRecorder, TokenSlice,
+	TeeSink, and Validator.
 */
 package shared
 
 import (
+	"context"
 	"fmt"
 
 	. "github.com/polydawn/refmt/tok"
@@ -24,10 +30,51 @@ type TokenPump struct {
 }
 
 func (p TokenPump) Run() error {
+	return p.run(nil)
+}
+
+// How many tokens RunContext pumps between checks of the context.
+// Checking every token would cost more than it's worth; this keeps
+// aborts prompt (a few microseconds' work at most) without that.
+const pumpContextCheckInterval = 64
+
+/*
+	RunContext is like Run, but stops with the context's error if the
+	context is cancelled (or its deadline passes) before the pump is done.
+
+	The context is checked every few dozen tokens, so cancellation is prompt
+	as long as tokens keep flowing; but a source or sink that's blocked
+	(e.g. on a read from a network connection) can't be interrupted by it --
+	close the connection for that.
+*/
+func (p TokenPump) RunContext(ctx context.Context) error {
+	done := ctx.Done()
+	if done == nil { // context can never be cancelled: no need to check.
+		return p.run(nil)
+	}
+	return p.run(func() error {
+		select {
+		case <-done:
+			return ctx.Err()
+		default:
+			return nil
+		}
+	})
+}
+
+// The pump loop.  If check is set, it's called every
+// pumpContextCheckInterval tokens (starting before the first),
+// and the pump stops with its error if it returns one.
+func (p TokenPump) run(check func() error) error {
 	var tok Token
 	var srcDone, sinkDone bool
 	var err error
-	for {
+	for n := 0; ; n++ {
+		if check != nil && n%pumpContextCheckInterval == 0 {
+			if err := check(); err != nil {
+				return err
+			}
+		}
 		srcDone, err = p.TokenSource.Step(&tok)
 		if err != nil {
 			return err
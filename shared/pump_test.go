@@ -0,0 +1,169 @@
+package shared_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+// An endless array of ints.
+type endlessSource struct{ n int }
+
+func (s *endlessSource) Step(tok *Token) (bool, error) {
+	if s.n == 0 {
+		*tok = Token{Type: TArrOpen, Length: -1}
+	} else {
+		*tok = Token{Type: TInt, Int: int64(s.n)}
+	}
+	s.n++
+	return false, nil
+}
+
+func TestRunContext(t *testing.T) {
+	t.Run("completes", func(t *testing.T) {
+		var buf bytes.Buffer
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := shared.TokenPump{
+			json.NewDecoder(strings.NewReader(`{"a":[1,2]}`)),
+			json.NewEncoder(&buf, json.EncodeOptions{}),
+		}.RunContext(ctx)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, buf.String(), ShouldEqual, `{"a":[1,2]}`)
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		src := &endlessSource{}
+		pump := shared.TokenPump{src, &shared.Validator{}}.With(
+			shared.ObserveTokens(func(tok *Token, _ int) error {
+				if tok.Int == 1000 {
+					cancel()
+				}
+				return nil
+			}),
+		)
+		err := pump.RunContext(ctx)
+		Wish(t, err, ShouldEqual, context.Canceled)
+		Wish(t, src.n < 1100, ShouldEqual, true) // stopped promptly.
+	})
+	t.Run("already cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		src := &endlessSource{}
+		err := shared.TokenPump{src, &shared.Validator{}}.RunContext(ctx)
+		Wish(t, err, ShouldEqual, context.Canceled)
+		Wish(t, src.n, ShouldEqual, 0)
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	doc := `{"a":[1,"xy"],"b":{"c":"z"}}`
+	t.Run("stats", func(t *testing.T) {
+		var stats shared.PumpStats
+		var buf bytes.Buffer
+		err := shared.TokenPump{
+			json.NewDecoder(strings.NewReader(doc)),
+			json.NewEncoder(&buf, json.EncodeOptions{}),
+		}.With(shared.CountTokens(&stats)).Run()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, buf.String(), ShouldEqual, doc)
+		Wish(t, stats, ShouldEqual, shared.PumpStats{Tokens: 12, Bytes: 6, Depth: 0, MaxDepth: 2})
+	})
+	t.Run("observe, in order", func(t *testing.T) {
+		var log []string
+		observer := func(name string) shared.TokenMiddleware {
+			return shared.ObserveTokens(func(tok *Token, depth int) error {
+				if name == "first" || depth == 0 {
+					log = append(log, fmt.Sprintf("%s %d %s", name, depth, tok))
+				}
+				return nil
+			})
+		}
+		var rec shared.TokenRecorder
+		err := shared.TokenPump{
+			json.NewDecoder(strings.NewReader(`[{"k":1}]`)),
+			&rec,
+		}.With(observer("first"), observer("second")).Run()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, log, ShouldEqual, []string{
+			"first 0 <[>",
+			"second 0 <[>",
+			"first 1 <{>",
+			"first 2 <s:\"k\">",
+			"first 2 <i:1>",
+			"first 1 <}>",
+			"first 0 <]>",
+			"second 0 <]>",
+		})
+	})
+	t.Run("errors stop the pump", func(t *testing.T) {
+		err := shared.TokenPump{&endlessSource{}, &shared.Validator{}}.With(
+			shared.ObserveTokens(func(tok *Token, _ int) error {
+				if tok.Int == 3 {
+					return fmt.Errorf("enough")
+				}
+				return nil
+			}),
+		).Run()
+		Wish(t, err.Error(), ShouldEqual, "enough")
+	})
+	t.Run("transforming", func(t *testing.T) {
+		upper := func(next shared.TokenSink) shared.TokenSink {
+			return shared.TokenSinkFunc(func(tok *Token) (bool, error) {
+				if tok.Type == TString {
+					tok.Str = strings.ToUpper(tok.Str)
+				}
+				return next.Step(tok)
+			})
+		}
+		var buf bytes.Buffer
+		err := shared.TokenPump{
+			json.NewDecoder(strings.NewReader(doc)),
+			json.NewEncoder(&buf, json.EncodeOptions{}),
+		}.With(upper).Run()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, buf.String(), ShouldEqual, `{"A":[1,"XY"],"B":{"C":"Z"}}`)
+	})
+}
+
+func benchmarkPump(b *testing.B, run func(shared.TokenPump) error) {
+	toks := []Token{{Type: TArrOpen, Length: 1000}}
+	for i := 0; i < 1000; i++ {
+		toks = append(toks, Token{Type: TInt, Int: int64(i)})
+	}
+	toks = append(toks, Token{Type: TArrClose})
+	src := shared.NewTokenSlice(toks)
+	var v shared.Validator
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		src.Reset()
+		v.Reset()
+		if err := run(shared.TokenPump{src, &v}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPumpRun(b *testing.B) {
+	benchmarkPump(b, func(p shared.TokenPump) error { return p.Run() })
+}
+
+func BenchmarkPumpRunContext(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	benchmarkPump(b, func(p shared.TokenPump) error { return p.RunContext(ctx) })
+}
+
+func BenchmarkPumpWithStats(b *testing.B) {
+	var stats shared.PumpStats
+	benchmarkPump(b, func(p shared.TokenPump) error { return p.With(shared.CountTokens(&stats)).Run() })
+}
@@ -0,0 +1,119 @@
+package shared
+
+import (
+	"fmt"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	TokenRecorder is a TokenSink which captures the tokens of one value,
+	so they can be replayed later (as many times as you like) with Source.
+
+	Byte slices in the tokens are copied as they're recorded, so it's safe
+	to record from decoders which reuse their buffers.
+
+	Like any other sink, the recorder says it's done when it's been given
+	a complete value; stepping it again after that is an error,
+	unless it's Reset first.
+*/
+type TokenRecorder struct {
+	toks  []Token
+	depth int
+	done  bool
+}
+
+func (r *TokenRecorder) Step(consume *Token) (done bool, err error) {
+	if r.done {
+		return true, fmt.Errorf("recorder already has a complete value")
+	}
+	switch consume.Type {
+	case TMapOpen, TArrOpen:
+		r.depth++
+	case TMapClose, TArrClose:
+		if r.depth == 0 {
+			return true, fmt.Errorf("unexpected %s at start of value", consume.Type)
+		}
+		r.depth--
+	case TNull, TString, TBytes, TBool, TInt, TUint, TFloat64:
+		// Nothing to track.
+	default:
+		return true, fmt.Errorf("invalid token %s", consume)
+	}
+	tok := *consume
+	if tok.Type == TBytes && tok.Bytes != nil {
+		tok.Bytes = append([]byte{}, tok.Bytes...)
+	}
+	r.toks = append(r.toks, tok)
+	r.done = r.depth == 0
+	return r.done, nil
+}
+
+/*
+	Tokens returns the tokens recorded so far.
+	The slice is shared with the recorder until it's Reset.
+*/
+func (r *TokenRecorder) Tokens() []Token {
+	return r.toks
+}
+
+/*
+	Done returns true if the recorder has been given a complete value.
+*/
+func (r *TokenRecorder) Done() bool {
+	return r.done
+}
+
+/*
+	Source returns a TokenSource which replays the recorded value.
+	It's an error to ask for one before the value is complete.
+*/
+func (r *TokenRecorder) Source() (*TokenSlice, error) {
+	if !r.done {
+		return nil, fmt.Errorf("recorder doesn't have a complete value")
+	}
+	return NewTokenSlice(r.toks), nil
+}
+
+/*
+	Reset clears the recorder, so it can record another value.
+*/
+func (r *TokenRecorder) Reset() {
+	*r = TokenRecorder{}
+}
+
+/*
+	TokenSlice is a TokenSource which yields a slice of tokens,
+	saying it's done on the last one.  (The tokens should be one complete
+	value, as a TokenRecorder captures -- TokenSlice doesn't check.)
+
+	Once it's done, stepping it again is an error, unless it's Reset first:
+	then it replays the same tokens again.
+*/
+type TokenSlice struct {
+	toks  []Token
+	index int
+}
+
+func NewTokenSlice(toks []Token) *TokenSlice {
+	return &TokenSlice{toks: toks}
+}
+
+func (s *TokenSlice) Step(fillme *Token) (done bool, err error) {
+	if len(s.toks) == 0 {
+		return true, fmt.Errorf("no tokens")
+	}
+	if s.index >= len(s.toks) {
+		return true, fmt.Errorf("token slice already replayed to the end")
+	}
+	*fillme = s.toks[s.index]
+	s.index++
+	return s.index == len(s.toks), nil
+}
+
+/*
+	Reset rewinds the slice, so it can be replayed again.
+*/
+func (s *TokenSlice) Reset() {
+	s.index = 0
+}
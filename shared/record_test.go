@@ -0,0 +1,122 @@
+package shared_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func TestTokenRecorder(t *testing.T) {
+	doc := `{"a":[1,"x"],"b":{}}`
+	var rec shared.TokenRecorder
+	err := shared.TokenPump{json.NewDecoder(strings.NewReader(doc)), &rec}.Run()
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, rec.Done(), ShouldEqual, true)
+	Wish(t, len(rec.Tokens()), ShouldEqual, 10)
+
+	t.Run("replays", func(t *testing.T) {
+		src, err := rec.Source()
+		Wish(t, err, ShouldEqual, nil)
+		for i := 0; i < 2; i++ {
+			var buf bytes.Buffer
+			err := shared.TokenPump{src, json.NewEncoder(&buf, json.EncodeOptions{})}.Run()
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, buf.String(), ShouldEqual, doc)
+			src.Reset()
+		}
+	})
+	t.Run("rejects more after done", func(t *testing.T) {
+		_, err := rec.Step(&Token{Type: TNull})
+		Wish(t, err.Error(), ShouldEqual, "recorder already has a complete value")
+	})
+	t.Run("source before done is an error", func(t *testing.T) {
+		var rec shared.TokenRecorder
+		done, err := rec.Step(&Token{Type: TArrOpen, Length: 1})
+		Wish(t, done, ShouldEqual, false)
+		Wish(t, err, ShouldEqual, nil)
+		_, err = rec.Source()
+		Wish(t, err.Error(), ShouldEqual, "recorder doesn't have a complete value")
+	})
+	t.Run("scalars are done right away", func(t *testing.T) {
+		var rec shared.TokenRecorder
+		done, err := rec.Step(&Token{Type: TString, Str: "x"})
+		Wish(t, done, ShouldEqual, true)
+		Wish(t, err, ShouldEqual, nil)
+		rec.Reset()
+		Wish(t, rec.Done(), ShouldEqual, false)
+		Wish(t, len(rec.Tokens()), ShouldEqual, 0)
+	})
+	t.Run("stray close is an error", func(t *testing.T) {
+		var rec shared.TokenRecorder
+		_, err := rec.Step(&Token{Type: TMapClose})
+		Wish(t, err.Error(), ShouldEqual, "unexpected map close at start of value")
+	})
+	t.Run("copies bytes", func(t *testing.T) {
+		var rec shared.TokenRecorder
+		bs := []byte("abc")
+		_, err := rec.Step(&Token{Type: TBytes, Bytes: bs})
+		Wish(t, err, ShouldEqual, nil)
+		bs[0] = 'z'
+		Wish(t, string(rec.Tokens()[0].Bytes), ShouldEqual, "abc")
+	})
+}
+
+func TestTokenSlice(t *testing.T) {
+	src := shared.NewTokenSlice([]Token{{Type: TArrOpen, Length: 1}, {Type: TInt, Int: 1}, {Type: TArrClose}})
+	var rec shared.TokenRecorder
+	Wish(t, shared.TokenPump{src, &rec}.Run(), ShouldEqual, nil)
+	_, err := src.Step(&Token{})
+	Wish(t, err.Error(), ShouldEqual, "token slice already replayed to the end")
+	_, err = shared.NewTokenSlice(nil).Step(&Token{})
+	Wish(t, err.Error(), ShouldEqual, "no tokens")
+}
+
+func TestTeeSink(t *testing.T) {
+	t.Run("json and cbor at once", func(t *testing.T) {
+		var jsonBuf, cborBuf bytes.Buffer
+		tee := shared.NewTeeSink(
+			json.NewEncoder(&jsonBuf, json.EncodeOptions{}),
+			cbor.NewEncoder(&cborBuf),
+		)
+		err := shared.TokenPump{json.NewDecoder(strings.NewReader(`{"a":[1,"x"]}`)), tee}.Run()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, jsonBuf.String(), ShouldEqual, `{"a":[1,"x"]}`)
+		Wish(t, hex.EncodeToString(cborBuf.Bytes()), ShouldEqual, "bf61619f016178ffff")
+	})
+	t.Run("sinks must agree on done", func(t *testing.T) {
+		var rec shared.TokenRecorder
+		tee := shared.NewTeeSink(&rec, shared.NewTeeSink(&shared.TokenRecorder{}, &shared.TokenRecorder{}))
+		_, err := tee.Step(&Token{Type: TArrOpen, Length: 1})
+		Wish(t, err, ShouldEqual, nil)
+		done, err := tee.Step(&Token{Type: TArrClose})
+		Wish(t, done, ShouldEqual, true)
+		Wish(t, err, ShouldEqual, nil)
+
+		tee = shared.NewTeeSink(&shared.TokenRecorder{}, neverDone{})
+		_, err = tee.Step(&Token{Type: TNull})
+		Wish(t, err.Error(), ShouldEqual, "tee sink 1 expects more, but sink 0 is done")
+		tee = shared.NewTeeSink(neverDone{}, &shared.TokenRecorder{})
+		_, err = tee.Step(&Token{Type: TNull})
+		Wish(t, err.Error(), ShouldEqual, "tee sink 1 is done, but sink 0 expects more")
+	})
+	t.Run("errors stop the tee", func(t *testing.T) {
+		var rec shared.TokenRecorder
+		rec.Step(&Token{Type: TNull})
+		tee := shared.NewTeeSink(&shared.TokenRecorder{}, &rec)
+		_, err := tee.Step(&Token{Type: TNull})
+		Wish(t, err.Error(), ShouldEqual, "recorder already has a complete value")
+	})
+}
+
+// A sink that swallows everything, and never thinks it's done.
+type neverDone struct{}
+
+func (neverDone) Step(*Token) (bool, error) { return false, nil }
@@ -0,0 +1,448 @@
+package shared
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Selector is a TokenSource which yields only part of the tokens from
+	another TokenSource: the value(s) at a path.
+
+	Paths may be JSON Pointers (RFC 6901), e.g. "/items/3/id", or "" for
+	the whole document; or a small subset of jq's syntax:
+
+		.             the whole document
+		.a.b          the value at key "b" in the map at key "a"
+		."odd key"    keys that aren't plain identifiers can be quoted
+		.a[3]         the value at index 3 of the array at key "a"
+		.items[]      each value in the array (or map) at key "items"
+		.items[].id   the value at key "id" in each of them
+
+	If the path has no "[]" in it, the Selector yields the single value at
+	the path.  Otherwise, it yields an array (of indefinite length) of all
+	the values selected.  Keys or indexes which don't exist are an error,
+	except after a "[]", where (as in jq) they select null: so ".items[].id"
+	yields a null for each item that has no id.
+
+	Everything that isn't selected is skipped over token by token, without
+	ever being assembled into values; and the Selector stops reading from
+	the underlying source as soon as it's yielded everything it can,
+	so whatever is after the selected value in the stream is left unread.
+*/
+type Selector struct {
+	in   TokenReader
+	path string
+	segs []selectSeg
+	each bool // whether any segment is selectEach (and so we wrap results in an array).
+
+	phase  selectPhase
+	frames []selectFrame // the containers we're inside of, while seeking.
+	depth  int           // depth within the value we're yielding.
+}
+
+type selectSegKind uint8
+
+const (
+	selectKey   selectSegKind = iota // a map key.
+	selectIndex                      // an array index.
+	selectEither                     // a map key, or an array index (JSON Pointers don't say which).
+	selectEach                       // every value in an array or map.
+)
+
+type selectSeg struct {
+	kind  selectSegKind
+	key   string
+	index int // -1 if this is a selectEither that can't be an array index.
+	text  string // the segment as it was written, for errors.
+}
+
+type selectPhase uint8
+
+const (
+	selectPhase_initial  selectPhase = iota
+	selectPhase_seek                 // read the root, and seek the first match.
+	selectPhase_yielding             // yielding a value; depth says how deep we are.
+	selectPhase_resume               // finished yielding a value; seek the next match.
+	selectPhase_finished
+)
+
+// A container we've descended into.
+type selectFrame struct {
+	seg   int    // index of the segment which led us into this container.
+	isMap bool   // whether it's a map (and so entries begin with keys).
+	n     int    // how many entries we've entered (if we're iterating over it).
+	key   string // the key of the current entry (if we're iterating over a map).
+}
+
+/*
+	Create a Selector yielding the value(s) at the path in src.
+	An error is returned if the path can't be parsed.
+*/
+func NewSelector(src TokenSource, path string) (*Selector, error) {
+	segs, err := parseSelectPath(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Selector{in: TokenReader{src: src}, path: path, segs: segs}
+	for _, seg := range segs {
+		if seg.kind == selectEach {
+			s.each = true
+		}
+	}
+	return s, nil
+}
+
+func (s *Selector) Step(tok *Token) (done bool, err error) {
+	switch s.phase {
+	case selectPhase_initial:
+		s.phase = selectPhase_seek
+		if s.each {
+			*tok = Token{Type: TArrOpen, Length: -1}
+			return false, nil
+		}
+		fallthrough
+	case selectPhase_seek:
+		if err := s.in.Next(tok); err != nil {
+			return true, err
+		}
+		if err := s.descend(tok, 0); err != nil {
+			if err == errSelectExhausted {
+				s.phase = selectPhase_finished
+				*tok = Token{Type: TArrClose}
+				return true, nil
+			}
+			return true, err
+		}
+		return s.yield(tok)
+	case selectPhase_yielding:
+		if err := s.in.Next(tok); err != nil {
+			return true, err
+		}
+		return s.yield(tok)
+	case selectPhase_resume:
+		found, err := s.resume(tok)
+		if err != nil {
+			return true, err
+		}
+		if !found {
+			s.phase = selectPhase_finished
+			*tok = Token{Type: TArrClose}
+			return true, nil
+		}
+		return s.yield(tok)
+	case selectPhase_finished:
+		return true, fmt.Errorf("selector already finished")
+	}
+	panic("unreachable")
+}
+
+// Pass through a token of the value being yielded, and figure out what's next.
+func (s *Selector) yield(tok *Token) (done bool, err error) {
+	s.phase = selectPhase_yielding
+	switch tok.Type {
+	case TMapOpen, TArrOpen:
+		s.depth++
+	case TMapClose, TArrClose:
+		s.depth--
+	}
+	if s.depth > 0 {
+		return false, nil
+	}
+	// That's a whole value.  If there can't be more, we're done (early, even:
+	// we don't read the rest of src).  Otherwise, look for the next one
+	// the next time we're stepped (tok is in use until then).
+	if !s.each {
+		s.phase = selectPhase_finished
+		return true, nil
+	}
+	s.phase = selectPhase_resume
+	return false, nil
+}
+
+// Given tok holding the start of a value at segment si (or the end of the
+// path, if si == len(s.segs)), consume tokens until tok holds the start of
+// a value to yield.
+func (s *Selector) descend(tok *Token, si int) error {
+	for ; si < len(s.segs); si++ {
+		seg := s.segs[si]
+		var isMap bool
+		switch tok.Type {
+		case TMapOpen:
+			isMap = true
+			if seg.kind == selectIndex {
+				return s.errorAt(si, "expected an array, got a map")
+			}
+		case TArrOpen:
+			if seg.kind == selectKey {
+				return s.errorAt(si, "expected a map, got an array")
+			}
+		default:
+			return s.errorAt(si, fmt.Sprintf("cannot descend into %s", tok.Type))
+		}
+		if !isMap && seg.index < 0 && seg.kind != selectEach {
+			return s.errorAt(si, "not an array index")
+		}
+		s.frames = append(s.frames, selectFrame{seg: si, isMap: isMap})
+		if seg.kind == selectEach {
+			more, err := s.nextEntry(tok, &s.frames[len(s.frames)-1])
+			if err != nil {
+				return err
+			}
+			if !more {
+				// Nothing in it; carry on from the containers above.
+				s.frames = s.frames[:len(s.frames)-1]
+				found, err := s.resume(tok)
+				if err != nil {
+					return err
+				}
+				if !found {
+					return errSelectExhausted
+				}
+				return nil
+			}
+			continue
+		}
+		for i := 0; ; i++ {
+			if err := s.in.Next(tok); err != nil {
+				return err
+			}
+			var match bool
+			if isMap {
+				if tok.Type == TMapClose {
+					return s.missing(tok, si, "no such key")
+				}
+				key, ok := selectKeyText(tok)
+				match = ok && key == seg.key
+				if err := s.in.Next(tok); err != nil {
+					return err
+				}
+			} else {
+				if tok.Type == TArrClose {
+					return s.missing(tok, si, "array index out of range")
+				}
+				match = i == seg.index
+			}
+			if match {
+				break
+			}
+			if err := s.in.Skip(tok); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Called by descend when the container for segment si has closed without
+// having what it's looking for: under a "[]", that selects null, and
+// otherwise it's an error.
+func (s *Selector) missing(tok *Token, si int, reason string) error {
+	for _, seg := range s.segs[:si] {
+		if seg.kind == selectEach {
+			s.frames = s.frames[:len(s.frames)-1]
+			*tok = Token{Type: TNull}
+			return nil
+		}
+	}
+	return s.errorAt(si, reason)
+}
+
+// Having finished a value, find the start of the next value to yield,
+// if there is one.  Containers we were only looking for one thing in are
+// skipped to their end; containers we're iterating over move on to their
+// next entry.
+func (s *Selector) resume(tok *Token) (found bool, err error) {
+	for len(s.frames) > 0 {
+		top := &s.frames[len(s.frames)-1]
+		if s.segs[top.seg].kind != selectEach {
+			if err := s.skipRest(tok); err != nil {
+				return false, err
+			}
+			s.frames = s.frames[:len(s.frames)-1]
+			continue
+		}
+		more, err := s.nextEntry(tok, top)
+		if err != nil {
+			return false, err
+		}
+		if !more {
+			s.frames = s.frames[:len(s.frames)-1]
+			continue
+		}
+		if err := s.descend(tok, top.seg+1); err != nil {
+			if err == errSelectExhausted {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Returned by descend when iteration runs out before anything is found.
+var errSelectExhausted = fmt.Errorf("exhausted")
+
+// Read the next entry of a container we're iterating over, leaving tok
+// holding the start of its value; or return false if the container closed.
+func (s *Selector) nextEntry(tok *Token, frame *selectFrame) (more bool, err error) {
+	if err := s.in.Next(tok); err != nil {
+		return false, err
+	}
+	switch tok.Type {
+	case TMapClose, TArrClose:
+		return false, nil
+	}
+	frame.n++
+	if frame.isMap {
+		// That was the key; we only need it for errors.
+		frame.key, _ = selectKeyText(tok)
+		if err := s.in.Next(tok); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Consume the rest of the container we're in, through its close.
+func (s *Selector) skipRest(tok *Token) error {
+	for depth := 1; depth > 0; {
+		if err := s.in.Next(tok); err != nil {
+			return err
+		}
+		switch tok.Type {
+		case TMapOpen, TArrOpen:
+			depth++
+		case TMapClose, TArrClose:
+			depth--
+		}
+	}
+	return nil
+}
+
+// The text of map keys which we can match.  (Keys of other kinds never match.)
+func selectKeyText(tok *Token) (string, bool) {
+	switch tok.Type {
+	case TString:
+		return tok.Str, true
+	case TInt:
+		return strconv.FormatInt(tok.Int, 10), true
+	case TUint:
+		return strconv.FormatUint(tok.Uint, 10), true
+	}
+	return "", false
+}
+
+// Errors say where they happened as a path, with the entries we're
+// iterating over in place of each "[]", so you can find the culprit.
+func (s *Selector) errorAt(si int, reason string) error {
+	var at strings.Builder
+	for i, seg := range s.segs[:si+1] {
+		var frame *selectFrame
+		for j := range s.frames {
+			if s.frames[j].seg == i && seg.kind == selectEach {
+				frame = &s.frames[j]
+			}
+		}
+		switch {
+		case frame == nil:
+			at.WriteString(seg.text)
+		case !frame.isMap:
+			fmt.Fprintf(&at, "[%d]", frame.n-1)
+		case frame.key == "" || strings.ContainsAny(frame.key, `.["\`):
+			at.WriteString("." + strconv.Quote(frame.key))
+		default:
+			at.WriteString("." + frame.key)
+		}
+	}
+	return fmt.Errorf("cannot select %q at %q: %s", s.path, at.String(), reason)
+}
+
+// Parse either a JSON Pointer or a jq-ish path.
+func parseSelectPath(path string) ([]selectSeg, error) {
+	switch {
+	case path == "":
+		return nil, nil
+	case path[0] == '/':
+		var segs []selectSeg
+		for _, raw := range strings.Split(path[1:], "/") {
+			key := UnescapePointerToken(raw)
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || strconv.Itoa(index) != key {
+				index = -1
+			}
+			segs = append(segs, selectSeg{selectEither, key, index, "/" + raw})
+		}
+		return segs, nil
+	case path[0] == '.':
+		return parseSelectQuery(path)
+	default:
+		return nil, fmt.Errorf("invalid path %q: must be a JSON Pointer (starting with '/') or start with '.'", path)
+	}
+}
+
+func parseSelectQuery(path string) ([]selectSeg, error) {
+	if path == "." {
+		return nil, nil
+	}
+	var segs []selectSeg
+	for i := 0; i < len(path); {
+		start := i
+		switch path[i] {
+		case '.':
+			i++
+			if i < len(path) && path[i] == '"' {
+				// Find the end of the quoted key (allowing escaped quotes).
+				end := i + 1
+				for ; end < len(path) && path[end] != '"'; end++ {
+					if path[end] == '\\' {
+						end++
+					}
+				}
+				if end >= len(path) {
+					return nil, fmt.Errorf("invalid path %q: unterminated quoted key", path)
+				}
+				key, err := strconv.Unquote(path[i : end+1])
+				if err != nil {
+					return nil, fmt.Errorf("invalid path %q: bad quoted key %s", path, path[i:end+1])
+				}
+				i = end + 1
+				segs = append(segs, selectSeg{selectKey, key, -1, path[start:i]})
+				continue
+			}
+			for i < len(path) && path[i] != '.' && path[i] != '[' {
+				i++
+			}
+			if i == start+1 {
+				if i < len(path) && path[i] == '[' {
+					continue // ".[3]" is the same as "[3]".
+				}
+				return nil, fmt.Errorf("invalid path %q: empty key at offset %d", path, start)
+			}
+			segs = append(segs, selectSeg{selectKey, path[start+1 : i], -1, path[start:i]})
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unterminated '['", path)
+			}
+			inner := path[i+1 : i+end]
+			i += end + 1
+			if inner == "" {
+				segs = append(segs, selectSeg{selectEach, "", -1, path[start:i]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path %q: %q is not an array index", path, inner)
+			}
+			segs = append(segs, selectSeg{selectIndex, "", index, path[start:i]})
+		default:
+			return nil, fmt.Errorf("invalid path %q: unexpected %q at offset %d", path, path[i], i)
+		}
+	}
+	return segs, nil
+}
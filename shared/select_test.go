@@ -0,0 +1,132 @@
+package shared_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+// Counts the tokens read through it, so we can check we stop early.
+type countingSource struct {
+	shared.TokenSource
+	n int
+}
+
+func (s *countingSource) Step(tok *Token) (bool, error) {
+	s.n++
+	return s.TokenSource.Step(tok)
+}
+
+func selectJson(t *testing.T, path, doc string) (string, int, error) {
+	t.Helper()
+	src := &countingSource{TokenSource: json.NewDecoder(strings.NewReader(doc))}
+	sel, err := shared.NewSelector(src, path)
+	if err != nil {
+		return "", 0, err
+	}
+	var buf bytes.Buffer
+	err = shared.TokenPump{sel, json.NewEncoder(&buf, json.EncodeOptions{})}.Run()
+	return buf.String(), src.n, err
+}
+
+func TestSelector(t *testing.T) {
+	doc := `{"a":{"b":[10,{"c":"x"},30]},"items":[{"id":1,"n":"p"},{"id":2},{"id":3}],"m":{"k1":{"id":"v1"},"k2":{"id":"v2"}},"z":true}`
+	for _, tr := range []struct {
+		path, expect string
+		reads        int // tokens read from the source; zero means don't check.
+	}{
+		{"", doc, 0},
+		{".", doc, 0},
+		{"/a/b/1", `{"c":"x"}`, 10},
+		{".a.b[1]", `{"c":"x"}`, 10},
+		{".a.b[1].c", `"x"`, 9},
+		{"/a/b/1/c", `"x"`, 9},
+		{".a.b[0]", `10`, 6},
+		{".z", `true`, 0},
+		{".items[].id", `[1,2,3]`, 0},
+		{".items[]", `[{"id":1,"n":"p"},{"id":2},{"id":3}]`, 0},
+		{".m[].id", `["v1","v2"]`, 0},
+		{".a.b[]", `[10,{"c":"x"},30]`, 0},
+		{".\"a\".b[2]", `30`, 0},
+	} {
+		t.Run(tr.path, func(t *testing.T) {
+			out, reads, err := selectJson(t, tr.path, doc)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, out, ShouldEqual, tr.expect)
+			if tr.reads != 0 {
+				Wish(t, reads, ShouldEqual, tr.reads)
+			}
+		})
+	}
+	t.Run("iterating nested arrays", func(t *testing.T) {
+		out, _, err := selectJson(t, ".[][].x", `[[{"x":1},{"x":2}],[],[{"x":3,"y":[4]}]]`)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[1,2,3]`)
+	})
+	t.Run("iterating empty arrays", func(t *testing.T) {
+		out, _, err := selectJson(t, ".[]", `[]`)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[]`)
+		out, _, err = selectJson(t, ".[][]", `[[],[]]`)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[]`)
+	})
+	t.Run("missing keys and indexes under [] are null", func(t *testing.T) {
+		out, _, err := selectJson(t, ".items[].x", `{"items":[{"x":1},{"y":2},{"x":{"z":3}}]}`)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[1,null,{"z":3}]`)
+		out, _, err = selectJson(t, ".[][1]", `[[1,2],[3],[]]`)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[2,null,null]`)
+		out, _, err = selectJson(t, ".[].a.b", `[{"a":{}},{"a":{"b":1}}]`)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[null,1]`)
+	})
+	t.Run("errors say which entry of [] they're in", func(t *testing.T) {
+		_, _, err := selectJson(t, ".[].x.y", `{"k":{"x":{}},"a.b":{"x":1}}`)
+		Wish(t, err.Error(), ShouldEqual, `cannot select ".[].x.y" at ".\"a.b\".x.y": cannot descend into int`)
+		_, _, err = selectJson(t, ".[].x.y", `[{"x":{}},{"x":{}},{"x":true}]`)
+		Wish(t, err.Error(), ShouldEqual, `cannot select ".[].x.y" at "[2].x.y": cannot descend into bool`)
+	})
+	t.Run("stops early", func(t *testing.T) {
+		// The rest of the document isn't even valid; we never get to it.
+		out, _, err := selectJson(t, "/a", `{"a":1,"b":}`)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `1`)
+	})
+}
+
+func TestSelectorErrors(t *testing.T) {
+	doc := `{"a":{"b":[10,20]},"items":[{"id":1},{"nope":2}]}`
+	for _, tr := range []struct {
+		path, err string
+	}{
+		{"a", `invalid path "a": must be a JSON Pointer (starting with '/') or start with '.'`},
+		{".a[x]", `invalid path ".a[x]": "x" is not an array index`},
+		{".a[", `invalid path ".a[": unterminated '['`},
+		{".a..b", `invalid path ".a..b": empty key at offset 2`},
+		{`."a`, `invalid path ".\"a": unterminated quoted key`},
+		{".x", `cannot select ".x" at ".x": no such key`},
+		{".a.b[2]", `cannot select ".a.b[2]" at ".a.b[2]": array index out of range`},
+		{".a.b.c", `cannot select ".a.b.c" at ".a.b.c": expected a map, got an array`},
+		{".a[0]", `cannot select ".a[0]" at ".a[0]": expected an array, got a map`},
+		{"/a/b/x", `cannot select "/a/b/x" at "/a/b/x": not an array index`},
+		{"/a/b/0/c", `cannot select "/a/b/0/c" at "/a/b/0/c": cannot descend into int`},
+		{".x[]", `cannot select ".x[]" at ".x": no such key`},
+		{".items[].id.x", `cannot select ".items[].id.x" at ".items[0].id.x": cannot descend into int`},
+		{".items[][0]", `cannot select ".items[][0]" at ".items[0][0]": expected an array, got a map`},
+		{".a[].x", `cannot select ".a[].x" at ".a.b.x": expected a map, got an array`},
+		{".a.b[]/x", `invalid path ".a.b[]/x": unexpected '/' at offset 6`},
+	} {
+		t.Run(tr.path, func(t *testing.T) {
+			_, _, err := selectJson(t, tr.path, doc)
+			Wish(t, err.Error(), ShouldEqual, tr.err)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package shared
+
+import (
+	"fmt"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	TeeSink is a TokenSink which feeds every token it's given to several
+	other sinks -- for example, to encode a value as json and cbor at once,
+	or to hash it while writing it.
+
+	Each sink gets its own copy of each token.  The first error from any
+	of the sinks is returned (and the tee shouldn't be stepped any further).
+	All the sinks have to agree about when the value is done;
+	if they don't, that's an error too.
+*/
+type TeeSink struct {
+	sinks []TokenSink
+	tok   Token
+}
+
+func NewTeeSink(sinks ...TokenSink) *TeeSink {
+	return &TeeSink{sinks: sinks}
+}
+
+func (t *TeeSink) Step(consume *Token) (done bool, err error) {
+	if len(t.sinks) == 0 {
+		return true, fmt.Errorf("tee has no sinks")
+	}
+	for i, sink := range t.sinks {
+		t.tok = *consume
+		sinkDone, err := sink.Step(&t.tok)
+		if err != nil {
+			return true, err
+		}
+		if i == 0 {
+			done = sinkDone
+		} else if sinkDone != done {
+			if done {
+				return true, fmt.Errorf("tee sink %d expects more, but sink 0 is done", i)
+			}
+			return true, fmt.Errorf("tee sink %d is done, but sink 0 expects more", i)
+		}
+	}
+	return done, nil
+}
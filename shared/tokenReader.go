@@ -0,0 +1,51 @@
+package shared
+
+import (
+	"fmt"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	TokenReader wraps a TokenSource for code which pulls tokens from it
+	directly (rather than handing it to a TokenPump), as the Selector and
+	Transformer do: Next errors instead of stepping the source again after
+	it's said it's done, and Skip consumes the rest of a value.
+*/
+type TokenReader struct {
+	src  TokenSource
+	done bool // whether src has said it's done.
+}
+
+func NewTokenReader(src TokenSource) *TokenReader {
+	return &TokenReader{src: src}
+}
+
+// Next reads the next token into tok.
+func (r *TokenReader) Next(tok *Token) error {
+	if r.done {
+		return fmt.Errorf("unexpected end of token stream")
+	}
+	done, err := r.src.Step(tok)
+	r.done = done
+	return err
+}
+
+// Skip consumes the rest of the value, given tok holding the start of it.
+func (r *TokenReader) Skip(tok *Token) error {
+	depth := 0
+	for {
+		switch tok.Type {
+		case TMapOpen, TArrOpen:
+			depth++
+		case TMapClose, TArrClose:
+			depth--
+		}
+		if depth <= 0 {
+			return nil
+		}
+		if err := r.Next(tok); err != nil {
+			return err
+		}
+	}
+}
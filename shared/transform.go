@@ -0,0 +1,542 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"math"
+	"strconv"
+	"strings"
+
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Transformer is a TokenSource which yields the tokens from another
+	TokenSource, rewritten by rules: keys can be renamed, values dropped,
+	replaced, hashed, or converted to another type.  No Go types are needed;
+	it works on any stream, so it can sit between any source and sink
+	(e.g. a json.Decoder and a cbor.Encoder, or an obj.Marshaller and
+	a json.Encoder) in a TokenPump.
+
+	Each rule has a path saying which values it applies to, in the same
+	syntax as Selector's: either a JSON Pointer, or a jq-ish path like
+	".users[].password", where "[]" matches every entry of an array or map.
+	Paths refer to the source's keys and indexes, whatever rules have done
+	to the ones before them: renaming ".a" doesn't change what ".a.b"
+	means, and dropping "[0]" doesn't make "[1]" the first element.
+
+	When a value is dropped, the map or array holding it will have fewer
+	entries than the source said; so maps and arrays which might have
+	entries dropped are yielded with indefinite length.
+
+	At most one of the rules which change values (ReplaceValue, HashValue,
+	ConvertType, and TransformValue) applies to any one value: the first
+	one given which matches.  To apply several to the same value, chain
+	transformers (each is a TokenSource, so one can read from another).
+*/
+type Transformer struct {
+	in    TokenReader
+	rules []TransformRule
+
+	frames []transformFrame // the containers we're inside of.
+	queue  []Token          // tokens of a replacement value still to yield.
+}
+
+/*
+	TransformRule is one rule for a Transformer.
+	Use RenameKey, Drop, ReplaceValue, HashValue, ConvertType,
+	or TransformValue to make them.
+*/
+type TransformRule struct {
+	kind  transformKind
+	path  string
+	segs  []selectSeg
+	name  string             // for transformRename.
+	value []Token            // for transformReplace.
+	fn    func(*Token) error // for transformValue.
+}
+
+type transformKind uint8
+
+const (
+	transformRename transformKind = iota
+	transformDrop
+	transformReplace
+	transformValue
+)
+
+// A container we're inside of, and where we are in it.
+type transformFrame struct {
+	isMap     bool
+	expectKey bool   // for maps: whether the next token is a key (or the close).
+	key       string // for maps: the key of the current entry.
+	index     int    // for arrays: the index of the current entry.
+}
+
+/*
+	RenameKey makes a rule renaming a map key.  The path is the path of the
+	entry (with its old name), so it must end with a key; e.g. RenameKey(
+	".user.mail", "email") renames the "mail" key in the map at ".user".
+	The new key is always a string.
+*/
+func RenameKey(path string, name string) TransformRule {
+	return TransformRule{kind: transformRename, path: path, name: name}
+}
+
+/*
+	Drop makes a rule dropping values: map entries (key and all),
+	or array elements.
+*/
+func Drop(path string) TransformRule {
+	return TransformRule{kind: transformDrop, path: path}
+}
+
+/*
+	ReplaceValue makes a rule replacing values (scalars, or whole maps or
+	arrays) with the value made of the given tokens, e.g.
+	ReplaceValue(".password", Token{Type: TString, Str: "REDACTED"}).
+	The tokens must be exactly one complete value.
+*/
+func ReplaceValue(path string, value ...Token) TransformRule {
+	toks := make([]Token, len(value))
+	for i, tok := range value {
+		toks[i] = tok
+		if tok.Bytes != nil {
+			toks[i].Bytes = append([]byte(nil), tok.Bytes...)
+		}
+	}
+	return TransformRule{kind: transformReplace, path: path, value: toks}
+}
+
+/*
+	TransformValue makes a rule changing scalar values (anything other than
+	a map or array) with a function, which may change the token however it
+	likes, as long as it leaves a scalar.  If the function returns an error,
+	the Transformer stops with it.  Maps and arrays at the path are an error.
+*/
+func TransformValue(path string, fn func(tok *Token) error) TransformRule {
+	return TransformRule{kind: transformValue, path: path, fn: fn}
+}
+
+/*
+	HashValue makes a rule replacing scalar values with the hex string of
+	their hash, e.g. to pseudonymize identifiers while keeping them comparable.
+	Strings and bytes are hashed as they are; other scalars are hashed as
+	their text as it would be in JSON ("12", "true", "null", and so on).
+	If newHash is nil, SHA-256 is used.
+*/
+func HashValue(path string, newHash func() hash.Hash) TransformRule {
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	return TransformValue(path, func(tok *Token) error {
+		var text []byte
+		switch tok.Type {
+		case TString:
+			text = []byte(tok.Str)
+		case TBytes:
+			text = tok.Bytes
+		default:
+			s, err := scalarText(tok)
+			if err != nil {
+				return err
+			}
+			text = []byte(s)
+		}
+		h := newHash()
+		h.Write(text)
+		*tok = Token{Type: TString, Str: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+}
+
+/*
+	ConvertType makes a rule converting scalar values to another type
+	(one of TString, TInt, TUint, TFloat64, TBool, or TBytes).
+
+	Anything converts to a string as its text as it would be in JSON,
+	except bytes, which are base64 (as encoding/json does); and strings
+	convert to other types by parsing that text.  Numbers convert to other
+	kinds of number if they fit exactly.  Values which can't be converted
+	are an error, as are values already of the type left as they are.
+	The results are untagged.
+*/
+func ConvertType(path string, to TokenType) TransformRule {
+	return TransformValue(path, func(tok *Token) error {
+		if tok.Type == to {
+			return nil
+		}
+		conv, err := convertScalar(tok, to)
+		if err != nil {
+			return err
+		}
+		*tok = conv
+		return nil
+	})
+}
+
+/*
+	Create a Transformer yielding the tokens from src, rewritten by the rules.
+	An error is returned if any of the rules is invalid (e.g. its path can't
+	be parsed, or it renames something that isn't a map key).
+*/
+func NewTransformer(src TokenSource, rules ...TransformRule) (*Transformer, error) {
+	t := &Transformer{in: TokenReader{src: src}, rules: make([]TransformRule, len(rules))}
+	for i, rule := range rules {
+		segs, err := parseSelectPath(rule.path)
+		if err != nil {
+			return nil, err
+		}
+		rule.segs = segs
+		switch rule.kind {
+		case transformRename:
+			if len(segs) == 0 || segs[len(segs)-1].kind == selectIndex || segs[len(segs)-1].kind == selectEach {
+				return nil, fmt.Errorf("invalid rule: cannot rename %q: the path must end with a map key", rule.path)
+			}
+		case transformDrop:
+			if len(segs) == 0 {
+				return nil, fmt.Errorf("invalid rule: cannot drop the whole document")
+			}
+		case transformReplace:
+			if err := validateValue(rule.value); err != nil {
+				return nil, fmt.Errorf("invalid rule: replacement for %q: %s", rule.path, err)
+			}
+		}
+		t.rules[i] = rule
+	}
+	return t, nil
+}
+
+// Check that toks are exactly one complete value.
+func validateValue(toks []Token) error {
+	var v Validator
+	for i := range toks {
+		tok := toks[i]
+		if _, err := v.Step(&tok); err != nil {
+			return err
+		}
+	}
+	if !v.done {
+		return fmt.Errorf("not a complete value")
+	}
+	return nil
+}
+
+func (t *Transformer) Step(tok *Token) (done bool, err error) {
+	if len(t.queue) > 0 {
+		*tok = t.queue[0]
+		t.queue = t.queue[1:]
+		if len(t.queue) > 0 {
+			return false, nil
+		}
+		return t.finishValue(), nil
+	}
+	for {
+		if err := t.in.Next(tok); err != nil {
+			return true, err
+		}
+		var top *transformFrame
+		if len(t.frames) > 0 {
+			top = &t.frames[len(t.frames)-1]
+		}
+		// Keys, and the ends of maps and arrays.
+		switch {
+		case top == nil:
+		case top.isMap && top.expectKey:
+			if tok.Type == TMapClose {
+				t.frames = t.frames[:len(t.frames)-1]
+				return t.finishValue(), nil
+			}
+			top.key = mapKeyText(tok)
+			top.expectKey = false
+			if t.match(transformDrop) != nil {
+				if err := t.in.Next(tok); err != nil {
+					return true, err
+				}
+				if err := t.in.Skip(tok); err != nil {
+					return true, err
+				}
+				top.expectKey = true
+				continue
+			}
+			if rule := t.match(transformRename); rule != nil {
+				*tok = Token{Type: TString, Str: rule.name}
+			}
+			return false, nil
+		case !top.isMap && tok.Type == TArrClose:
+			t.frames = t.frames[:len(t.frames)-1]
+			return t.finishValue(), nil
+		case !top.isMap && t.match(transformDrop) != nil:
+			if err := t.in.Skip(tok); err != nil {
+				return true, err
+			}
+			top.index++
+			continue
+		}
+		// The start of a value.
+		if rule := t.matchValueRule(); rule != nil {
+			return t.apply(rule, tok)
+		}
+		switch tok.Type {
+		case TMapOpen, TArrOpen:
+			if t.mayDrop() {
+				tok.Length = -1
+			}
+			t.frames = append(t.frames, transformFrame{isMap: tok.Type == TMapOpen, expectKey: true})
+			return false, nil
+		case TMapClose, TArrClose:
+			return true, fmt.Errorf("unexpected %s at %q", tok.Type, t.pointer())
+		}
+		return t.finishValue(), nil
+	}
+}
+
+// Apply a rule changing the value starting with tok.
+func (t *Transformer) apply(rule *TransformRule, tok *Token) (done bool, err error) {
+	switch rule.kind {
+	case transformReplace:
+		if err := t.in.Skip(tok); err != nil {
+			return true, err
+		}
+		*tok = rule.value[0]
+		if len(rule.value) > 1 {
+			t.queue = rule.value[1:]
+			return false, nil
+		}
+		return t.finishValue(), nil
+	case transformValue:
+		switch tok.Type {
+		case TMapOpen, TArrOpen:
+			return true, fmt.Errorf("cannot transform value at %q: it's a %s, not a scalar", t.pointer(), tok.Type)
+		}
+		if err := rule.fn(tok); err != nil {
+			return true, fmt.Errorf("cannot transform value at %q: %s", t.pointer(), err)
+		}
+		switch tok.Type {
+		case TNull, TString, TBytes, TBool, TInt, TUint, TFloat64:
+		default:
+			return true, fmt.Errorf("cannot transform value at %q: transformed to %s, not a scalar", t.pointer(), tok.Type)
+		}
+		return t.finishValue(), nil
+	}
+	panic("unreachable")
+}
+
+// Having yielded the end of a value, move on to the next entry
+// of the container it's in; and say if that was the whole document.
+func (t *Transformer) finishValue() (done bool) {
+	if len(t.frames) == 0 {
+		return true
+	}
+	top := &t.frames[len(t.frames)-1]
+	if top.isMap {
+		top.expectKey = true
+	} else {
+		top.index++
+	}
+	return false
+}
+
+// The first rule of the kind whose path is where we are, if any.
+func (t *Transformer) match(kind transformKind) *TransformRule {
+	for i := range t.rules {
+		if t.rules[i].kind == kind && t.matches(t.rules[i].segs) {
+			return &t.rules[i]
+		}
+	}
+	return nil
+}
+
+// The first rule changing values whose path is where we are, if any.
+func (t *Transformer) matchValueRule() *TransformRule {
+	for i := range t.rules {
+		switch t.rules[i].kind {
+		case transformReplace, transformValue:
+			if t.matches(t.rules[i].segs) {
+				return &t.rules[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Transformer) matches(segs []selectSeg) bool {
+	if len(segs) != len(t.frames) {
+		return false
+	}
+	return t.matchesPrefix(segs)
+}
+
+// Whether the path's first segments match the containers we're in.
+func (t *Transformer) matchesPrefix(segs []selectSeg) bool {
+	for i, seg := range segs {
+		f := t.frames[i]
+		switch seg.kind {
+		case selectKey:
+			if !f.isMap || f.key != seg.key {
+				return false
+			}
+		case selectIndex:
+			if f.isMap || f.index != seg.index {
+				return false
+			}
+		case selectEither:
+			if f.isMap && f.key != seg.key || !f.isMap && f.index != seg.index {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Whether any of the entries of the container we're about to enter
+// (whose path is where we are) might be dropped.
+func (t *Transformer) mayDrop() bool {
+	for _, rule := range t.rules {
+		if rule.kind == transformDrop && len(rule.segs) == len(t.frames)+1 && t.matchesPrefix(rule.segs[:len(t.frames)]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Where we are, as a JSON Pointer, for errors.
+func (t *Transformer) pointer() string {
+	var sb strings.Builder
+	for _, f := range t.frames {
+		sb.WriteByte('/')
+		if f.isMap {
+			sb.WriteString(EscapePointerToken(f.key))
+		} else {
+			sb.WriteString(strconv.Itoa(f.index))
+		}
+	}
+	return sb.String()
+}
+
+// The text of a map key, for matching against paths.
+// Like the Selector, except that bool keys match too.
+func mapKeyText(tok *Token) string {
+	if tok.Type == TBool {
+		return strconv.FormatBool(tok.Bool)
+	}
+	key, _ := selectKeyText(tok)
+	return key
+}
+
+// The text of a scalar as it would be in JSON (without quotes, for strings).
+func scalarText(tok *Token) (string, error) {
+	switch tok.Type {
+	case TNull:
+		return "null", nil
+	case TString:
+		return tok.Str, nil
+	case TBytes:
+		return base64.StdEncoding.EncodeToString(tok.Bytes), nil
+	case TBool:
+		return strconv.FormatBool(tok.Bool), nil
+	case TInt:
+		return strconv.FormatInt(tok.Int, 10), nil
+	case TUint:
+		return strconv.FormatUint(tok.Uint, 10), nil
+	case TFloat64:
+		if math.IsNaN(tok.Float64) || math.IsInf(tok.Float64, 0) {
+			return "", fmt.Errorf("cannot represent float %v as text", tok.Float64)
+		}
+		return strconv.FormatFloat(tok.Float64, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("%s is not a scalar", tok.Type)
+}
+
+func convertScalar(tok *Token, to TokenType) (Token, error) {
+	cantConvert := func() (Token, error) {
+		return Token{}, fmt.Errorf("cannot convert %s to %s", tok, to)
+	}
+	switch to {
+	case TString:
+		s, err := scalarText(tok)
+		if err != nil {
+			return Token{}, err
+		}
+		return Token{Type: TString, Str: s}, nil
+	case TBytes:
+		if tok.Type != TString {
+			return cantConvert()
+		}
+		bs, err := base64.StdEncoding.DecodeString(tok.Str)
+		if err != nil {
+			return cantConvert()
+		}
+		return Token{Type: TBytes, Bytes: bs}, nil
+	case TBool:
+		if tok.Type != TString {
+			return cantConvert()
+		}
+		b, err := strconv.ParseBool(tok.Str)
+		if err != nil {
+			return cantConvert()
+		}
+		return Token{Type: TBool, Bool: b}, nil
+	case TInt:
+		switch tok.Type {
+		case TString:
+			i, err := strconv.ParseInt(tok.Str, 10, 64)
+			if err != nil {
+				return cantConvert()
+			}
+			return Token{Type: TInt, Int: i}, nil
+		case TUint:
+			if tok.Uint > math.MaxInt64 {
+				return cantConvert()
+			}
+			return Token{Type: TInt, Int: int64(tok.Uint)}, nil
+		case TFloat64:
+			if tok.Float64 != math.Trunc(tok.Float64) || tok.Float64 < -(1<<63) || tok.Float64 >= 1<<63 {
+				return cantConvert()
+			}
+			return Token{Type: TInt, Int: int64(tok.Float64)}, nil
+		}
+	case TUint:
+		switch tok.Type {
+		case TString:
+			u, err := strconv.ParseUint(tok.Str, 10, 64)
+			if err != nil {
+				return cantConvert()
+			}
+			return Token{Type: TUint, Uint: u}, nil
+		case TInt:
+			if tok.Int < 0 {
+				return cantConvert()
+			}
+			return Token{Type: TUint, Uint: uint64(tok.Int)}, nil
+		case TFloat64:
+			if tok.Float64 != math.Trunc(tok.Float64) || tok.Float64 < 0 || tok.Float64 >= 1<<64 {
+				return cantConvert()
+			}
+			return Token{Type: TUint, Uint: uint64(tok.Float64)}, nil
+		}
+	case TFloat64:
+		switch tok.Type {
+		case TString:
+			f, err := strconv.ParseFloat(tok.Str, 64)
+			if err != nil {
+				return cantConvert()
+			}
+			return Token{Type: TFloat64, Float64: f}, nil
+		case TInt:
+			if f := float64(tok.Int); f < 1<<63 && int64(f) == tok.Int {
+				return Token{Type: TFloat64, Float64: f}, nil
+			}
+		case TUint:
+			if f := float64(tok.Uint); f < 1<<64 && uint64(f) == tok.Uint {
+				return Token{Type: TFloat64, Float64: f}, nil
+			}
+		}
+	default:
+		return Token{}, fmt.Errorf("cannot convert to %s", to)
+	}
+	return cantConvert()
+}
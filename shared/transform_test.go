@@ -0,0 +1,157 @@
+package shared_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func transformJson(doc string, rules ...shared.TransformRule) (string, error) {
+	t, err := shared.NewTransformer(json.NewDecoder(strings.NewReader(doc)), rules...)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = shared.TokenPump{t, json.NewEncoder(&buf, json.EncodeOptions{})}.Run()
+	return buf.String(), err
+}
+
+func TestTransformer(t *testing.T) {
+	t.Run("rename key", func(t *testing.T) {
+		out, err := transformJson(`{"user":{"mail":"a@b.c","name":"x"},"mail":1}`,
+			shared.RenameKey(".user.mail", "email"),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `{"user":{"email":"a@b.c","name":"x"},"mail":1}`)
+	})
+	t.Run("drop in every element", func(t *testing.T) {
+		out, err := transformJson(`{"users":[{"name":"a","password":"p"},{"password":{"x":[1]},"name":"b"}]}`,
+			shared.Drop(".users[].password"),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `{"users":[{"name":"a"},{"name":"b"}]}`)
+	})
+	t.Run("drop array elements", func(t *testing.T) {
+		out, err := transformJson(`{"items":[1,[2],3,4]}`,
+			shared.Drop("/items/1"),
+			shared.Drop(".items[2]"), // still the source's index.
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `{"items":[1,4]}`)
+	})
+	t.Run("lengths of containers with drops", func(t *testing.T) {
+		tr, err := shared.NewTransformer(shared.NewTokenSlice([]Token{
+			{Type: TMapOpen, Length: 2},
+			{Type: TString, Str: "a"}, {Type: TArrOpen, Length: 1}, {Type: TInt, Int: 1}, {Type: TArrClose},
+			{Type: TString, Str: "b"}, {Type: TInt, Int: 2},
+			{Type: TMapClose},
+		}), shared.Drop(".b"))
+		Wish(t, err, ShouldEqual, nil)
+		var rec shared.TokenRecorder
+		Wish(t, shared.TokenPump{tr, &rec}.Run(), ShouldEqual, nil)
+		Wish(t, rec.Tokens(), ShouldEqual, []Token{
+			{Type: TMapOpen, Length: -1},
+			{Type: TString, Str: "a"}, {Type: TArrOpen, Length: 1}, {Type: TInt, Int: 1}, {Type: TArrClose},
+			{Type: TMapClose},
+		})
+	})
+	t.Run("replace values", func(t *testing.T) {
+		out, err := transformJson(`{"password":"hunter2","a":{"deep":[1,2]},"b":2}`,
+			shared.ReplaceValue(".password", Token{Type: TString, Str: "REDACTED"}),
+			shared.ReplaceValue(".a", Token{Type: TArrOpen, Length: 1}, Token{Type: TNull}, Token{Type: TArrClose}),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `{"password":"REDACTED","a":[null],"b":2}`)
+	})
+	t.Run("replace the whole document", func(t *testing.T) {
+		out, err := transformJson(`{"a":1}`,
+			shared.ReplaceValue(".", Token{Type: TArrOpen, Length: 0}, Token{Type: TArrClose}),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[]`)
+	})
+	t.Run("hash values", func(t *testing.T) {
+		sum := sha256.Sum256([]byte("alice"))
+		sum12 := sha256.Sum256([]byte("12"))
+		out, err := transformJson(`[{"id":"alice","n":12}]`,
+			shared.HashValue(".[].id", nil),
+			shared.HashValue(".[].n", nil),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `[{"id":"`+hex.EncodeToString(sum[:])+`","n":"`+hex.EncodeToString(sum12[:])+`"}]`)
+	})
+	t.Run("convert types", func(t *testing.T) {
+		out, err := transformJson(`{"n":12,"f":1.5,"s":"42","b":"true","u":"7"}`,
+			shared.ConvertType(".n", TString),
+			shared.ConvertType(".f", TString),
+			shared.ConvertType(".s", TInt),
+			shared.ConvertType(".b", TBool),
+			shared.ConvertType(".u", TFloat64),
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `{"n":"12","f":"1.5","s":42,"b":true,"u":7}`)
+	})
+	t.Run("convert bytes, so json can encode them", func(t *testing.T) {
+		var data bytes.Buffer
+		err := shared.TokenPump{shared.NewTokenSlice([]Token{
+			{Type: TMapOpen, Length: 1},
+			{Type: TString, Str: "blob"}, {Type: TBytes, Bytes: []byte("hi!")},
+			{Type: TMapClose},
+		}), cbor.NewEncoder(&data)}.Run()
+		Wish(t, err, ShouldEqual, nil)
+		tr, err := shared.NewTransformer(cbor.NewDecoder(cbor.DecodeOptions{}, &data), shared.ConvertType(".blob", TString))
+		Wish(t, err, ShouldEqual, nil)
+		var buf bytes.Buffer
+		err = shared.TokenPump{tr, json.NewEncoder(&buf, json.EncodeOptions{})}.Run()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, buf.String(), ShouldEqual, `{"blob":"aGkh"}`)
+	})
+	t.Run("conversion errors", func(t *testing.T) {
+		_, err := transformJson(`{"a":[{"s":"x"}]}`, shared.ConvertType(".a[].s", TInt))
+		Wish(t, err.Error(), ShouldEqual, `cannot transform value at "/a/0/s": cannot convert <s:"x"> to int`)
+		_, err = transformJson(`{"a":{}}`, shared.ConvertType(".a", TString))
+		Wish(t, err.Error(), ShouldEqual, `cannot transform value at "/a": it's a map open, not a scalar`)
+		_, err = transformJson(`{"a":-1}`, shared.ConvertType(".a", TUint))
+		Wish(t, err.Error(), ShouldEqual, `cannot transform value at "/a": cannot convert <i:-1> to uint`)
+	})
+	t.Run("renames and value rules both apply", func(t *testing.T) {
+		out, err := transformJson(`{"a":{"x":1,"y":2}}`,
+			shared.RenameKey(".a", "b"),
+			shared.Drop(".a.x"), // paths are the source's names.
+			shared.ConvertType(".a.y", TString),
+			shared.HashValue(".a.y", nil), // only the first value rule applies.
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, out, ShouldEqual, `{"b":{"y":"2"}}`)
+	})
+	t.Run("chained", func(t *testing.T) {
+		first, err := shared.NewTransformer(json.NewDecoder(strings.NewReader(`{"n":12}`)), shared.ConvertType(".n", TString))
+		Wish(t, err, ShouldEqual, nil)
+		second, err := shared.NewTransformer(first, shared.HashValue(".n", nil), shared.RenameKey(".n", "hash"))
+		Wish(t, err, ShouldEqual, nil)
+		var buf bytes.Buffer
+		err = shared.TokenPump{second, json.NewEncoder(&buf, json.EncodeOptions{})}.Run()
+		Wish(t, err, ShouldEqual, nil)
+		sum := sha256.Sum256([]byte("12"))
+		Wish(t, buf.String(), ShouldEqual, `{"hash":"`+hex.EncodeToString(sum[:])+`"}`)
+	})
+	t.Run("invalid rules", func(t *testing.T) {
+		_, err := transformJson(`{}`, shared.Drop(""))
+		Wish(t, err.Error(), ShouldEqual, "invalid rule: cannot drop the whole document")
+		_, err = transformJson(`{}`, shared.RenameKey(".a[0]", "b"))
+		Wish(t, err.Error(), ShouldEqual, `invalid rule: cannot rename ".a[0]": the path must end with a map key`)
+		_, err = transformJson(`{}`, shared.ReplaceValue(".a", Token{Type: TArrOpen, Length: -1}))
+		Wish(t, err.Error(), ShouldEqual, `invalid rule: replacement for ".a": not a complete value`)
+		_, err = transformJson(`{}`, shared.Drop("a"))
+		Wish(t, err.Error(), ShouldEqual, `invalid path "a": must be a JSON Pointer (starting with '/') or start with '.'`)
+	})
+}
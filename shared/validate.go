@@ -0,0 +1,202 @@
+package shared
+
+import (
+	. "github.com/polydawn/refmt/tok"
+)
+
+/*
+	Validator is a TokenSink which checks that the tokens it's given are
+	a well-formed value, and does nothing else with them.
+	It checks that:
+
+		- every token has a valid TokenType;
+		- maps and arrays are closed, by the right kind of close, and
+		  nothing comes after the value is complete;
+		- map keys are strings, ints, uints, or bools;
+		- a map or array which declared a Length has that many entries.
+
+	Errors are one of ErrInvalidTokenType, ErrUnbalancedToken,
+	ErrInvalidMapKey, or ErrLengthMismatch, and say the index of the
+	offending token.
+
+	Use NewValidatingSink and NewValidatingSource to check tokens on
+	their way through to somewhere else.  A Validator can be Reset to
+	check another value.
+*/
+type Validator struct {
+	stack []validatorFrame
+	index int  // of the next token.
+	done  bool // whether we've seen a whole value.
+}
+
+type validatorFrame struct {
+	open   Token // the map or array open (with its Length, and tag).
+	count  int   // entries so far.
+	expect bool  // for maps: whether a value is expected (instead of a key or close).
+}
+
+func (v *Validator) Step(tok *Token) (done bool, err error) {
+	i := v.index
+	v.index++
+	if !tok.Type.IsValid() {
+		return true, ErrInvalidTokenType{i, *tok}
+	}
+	if v.done {
+		return true, ErrUnbalancedToken{i, *tok, "nothing (the value is already complete)"}
+	}
+	var top *validatorFrame
+	if n := len(v.stack); n > 0 {
+		top = &v.stack[n-1]
+	}
+
+	// Inside a map, expecting a key or the close.
+	if top != nil && top.open.Type == TMapOpen && !top.expect {
+		switch tok.Type {
+		case TMapClose:
+			return v.close(i, tok)
+		case TArrClose:
+			return true, ErrUnbalancedToken{i, *tok, "map key or map close"}
+		case TString, TInt, TUint, TBool:
+			if err := v.countEntry(i, tok, top); err != nil {
+				return true, err
+			}
+			top.expect = true
+			return false, nil
+		default:
+			return true, ErrInvalidMapKey{i, *tok}
+		}
+	}
+
+	// Otherwise expecting a value (or, in an array, the close).
+	switch tok.Type {
+	case TMapClose:
+		return true, ErrUnbalancedToken{i, *tok, v.expected()}
+	case TArrClose:
+		if top == nil || top.open.Type != TArrOpen {
+			return true, ErrUnbalancedToken{i, *tok, v.expected()}
+		}
+		return v.close(i, tok)
+	}
+	if top != nil {
+		if top.open.Type == TMapOpen {
+			top.expect = false
+		} else if err := v.countEntry(i, tok, top); err != nil {
+			return true, err
+		}
+	}
+	switch tok.Type {
+	case TMapOpen, TArrOpen:
+		v.stack = append(v.stack, validatorFrame{open: *tok})
+		return false, nil
+	}
+	return v.finishValue(), nil
+}
+
+// Count an entry in the container, checking it's not over the declared length.
+func (v *Validator) countEntry(i int, tok *Token, top *validatorFrame) error {
+	top.count++
+	if top.open.Length >= 0 && top.count > top.open.Length {
+		return ErrLengthMismatch{i, *tok, top.open.Length, top.count}
+	}
+	return nil
+}
+
+func (v *Validator) close(i int, tok *Token) (done bool, err error) {
+	top := v.stack[len(v.stack)-1]
+	if top.open.Length >= 0 && top.count != top.open.Length {
+		return true, ErrLengthMismatch{i, *tok, top.open.Length, top.count}
+	}
+	v.stack = v.stack[:len(v.stack)-1]
+	return v.finishValue(), nil
+}
+
+// Called when any value is complete; returns true if that completes the whole thing.
+func (v *Validator) finishValue() bool {
+	v.done = len(v.stack) == 0
+	return v.done
+}
+
+func (v *Validator) expected() string {
+	if len(v.stack) == 0 {
+		return "start of value"
+	}
+	if v.stack[len(v.stack)-1].open.Type == TArrOpen {
+		return "start of value or array close"
+	}
+	return "start of value"
+}
+
+/*
+	Reset clears the validator, so it can check another value.
+*/
+func (v *Validator) Reset() {
+	v.stack = v.stack[:0]
+	v.index = 0
+	v.done = false
+}
+
+/*
+	ValidatingSink is a TokenSink which checks tokens with a Validator
+	before passing them on to another sink.  Invalid tokens aren't passed on.
+	It's also an error if the sink says it's done at a different point
+	than the end of the value (ErrIncompleteValue).
+*/
+type ValidatingSink struct {
+	sink TokenSink
+	v    Validator
+}
+
+func NewValidatingSink(sink TokenSink) *ValidatingSink {
+	return &ValidatingSink{sink: sink}
+}
+
+func (s *ValidatingSink) Step(tok *Token) (done bool, err error) {
+	done, err = s.v.Step(tok)
+	if err != nil {
+		return true, err
+	}
+	sinkDone, err := s.sink.Step(tok)
+	if err != nil {
+		return true, err
+	}
+	if sinkDone != done {
+		if done {
+			return true, ErrIncompleteValue{s.v.index - 1, "value is complete, but sink expects more"}
+		}
+		return true, ErrIncompleteValue{s.v.index - 1, "sink is done, but value isn't complete"}
+	}
+	return done, nil
+}
+
+/*
+	ValidatingSource is a TokenSource which checks the tokens from another
+	source with a Validator as they're yielded.
+	It's also an error if the source says it's done at a different point
+	than the end of the value (ErrIncompleteValue).
+*/
+type ValidatingSource struct {
+	src TokenSource
+	v   Validator
+}
+
+func NewValidatingSource(src TokenSource) *ValidatingSource {
+	return &ValidatingSource{src: src}
+}
+
+func (s *ValidatingSource) Step(tok *Token) (done bool, err error) {
+	srcDone, err := s.src.Step(tok)
+	if err != nil {
+		return true, err
+	}
+	done, err = s.v.Step(tok)
+	if err != nil {
+		return true, err
+	}
+	if srcDone != done {
+		if done {
+			return true, ErrIncompleteValue{s.v.index - 1, "value is complete, but source isn't done"}
+		}
+		return true, ErrIncompleteValue{s.v.index - 1, "source is done, but value isn't complete"}
+	}
+	return done, nil
+}
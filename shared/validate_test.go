@@ -0,0 +1,142 @@
+package shared_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/shared"
+	. "github.com/polydawn/refmt/tok"
+)
+
+func validate(toks ...Token) (bool, error) {
+	var v shared.Validator
+	for i := range toks {
+		done, err := v.Step(&toks[i])
+		if err != nil || i == len(toks)-1 {
+			return done, err
+		}
+		if done {
+			// Let the validator see the extra tokens.
+			continue
+		}
+	}
+	return false, nil
+}
+
+func TestValidator(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		for _, toks := range [][]Token{
+			{{Type: TNull}},
+			{{Type: TMapOpen, Length: 2}, TokStr("a"), TokInt(1), {Type: TUint, Uint: 2}, {Type: TArrOpen, Length: -1}, {Type: TArrClose}, {Type: TMapClose}},
+			{{Type: TArrOpen, Length: 1}, {Type: TMapOpen, Length: 0}, {Type: TMapClose}, {Type: TArrClose}},
+			{{Type: TMapOpen, Length: -1}, {Type: TBool, Bool: true}, {Type: TBytes}, {Type: TMapClose}},
+		} {
+			done, err := validate(toks...)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, done, ShouldEqual, true)
+		}
+	})
+	for _, tr := range []struct {
+		title  string
+		toks   []Token
+		expect error
+	}{
+		{"invalid type",
+			[]Token{{Type: TArrOpen, Length: -1}, {}},
+			shared.ErrInvalidTokenType{1, Token{}}},
+		{"stray close",
+			[]Token{{Type: TArrClose}},
+			shared.ErrUnbalancedToken{0, Token{Type: TArrClose}, "start of value"}},
+		{"wrong close for map",
+			[]Token{{Type: TMapOpen, Length: -1}, {Type: TArrClose}},
+			shared.ErrUnbalancedToken{1, Token{Type: TArrClose}, "map key or map close"}},
+		{"wrong close for array",
+			[]Token{{Type: TArrOpen, Length: -1}, {Type: TMapClose}},
+			shared.ErrUnbalancedToken{1, Token{Type: TMapClose}, "start of value or array close"}},
+		{"close instead of map value",
+			[]Token{{Type: TMapOpen, Length: -1}, TokStr("k"), {Type: TMapClose}},
+			shared.ErrUnbalancedToken{2, Token{Type: TMapClose}, "start of value"}},
+		{"more after done",
+			[]Token{TokInt(1), TokInt(2)},
+			shared.ErrUnbalancedToken{1, TokInt(2), "nothing (the value is already complete)"}},
+		{"map key of bad type",
+			[]Token{{Type: TMapOpen, Length: -1}, {Type: TNull}},
+			shared.ErrInvalidMapKey{1, Token{Type: TNull}}},
+		{"map key that's a map",
+			[]Token{{Type: TMapOpen, Length: -1}, {Type: TMapOpen, Length: 0}},
+			shared.ErrInvalidMapKey{1, Token{Type: TMapOpen, Length: 0}}},
+		{"too many array entries",
+			[]Token{{Type: TArrOpen, Length: 1}, TokInt(1), TokInt(2)},
+			shared.ErrLengthMismatch{2, TokInt(2), 1, 2}},
+		{"too few array entries",
+			[]Token{{Type: TArrOpen, Length: 2}, TokInt(1), {Type: TArrClose}},
+			shared.ErrLengthMismatch{2, Token{Type: TArrClose}, 2, 1}},
+		{"too many map entries",
+			[]Token{{Type: TMapOpen, Length: 1}, TokStr("a"), TokInt(1), TokStr("b")},
+			shared.ErrLengthMismatch{3, TokStr("b"), 1, 2}},
+		{"too few map entries",
+			[]Token{{Type: TMapOpen, Length: 1}, {Type: TMapClose}},
+			shared.ErrLengthMismatch{1, Token{Type: TMapClose}, 1, 0}},
+	} {
+		t.Run(tr.title, func(t *testing.T) {
+			_, err := validate(tr.toks...)
+			Wish(t, err, ShouldEqual, tr.expect)
+		})
+	}
+	t.Run("error messages", func(t *testing.T) {
+		_, err := validate(Token{Type: TArrOpen, Length: 2}, TokInt(1), Token{Type: TArrClose})
+		Wish(t, err.Error(), ShouldEqual, "invalid token stream: token 2: <]>: declared length 2, but got 1 entries")
+	})
+	t.Run("reset", func(t *testing.T) {
+		var v shared.Validator
+		done, err := v.Step(&Token{Type: TNull})
+		Wish(t, done, ShouldEqual, true)
+		Wish(t, err, ShouldEqual, nil)
+		v.Reset()
+		done, err = v.Step(&Token{Type: TNull})
+		Wish(t, done, ShouldEqual, true)
+		Wish(t, err, ShouldEqual, nil)
+	})
+}
+
+func TestValidatingWrappers(t *testing.T) {
+	t.Run("sink", func(t *testing.T) {
+		var buf bytes.Buffer
+		sink := shared.NewValidatingSink(json.NewEncoder(&buf, json.EncodeOptions{}))
+		err := shared.TokenPump{
+			shared.NewTokenSlice([]Token{{Type: TArrOpen, Length: 2}, TokInt(1), {Type: TArrClose}}),
+			sink,
+		}.Run()
+		Wish(t, err, ShouldEqual, shared.ErrLengthMismatch{2, Token{Type: TArrClose}, 2, 1})
+		Wish(t, buf.String(), ShouldEqual, "[1") // the bad close never got to the encoder.
+	})
+	t.Run("sink done early", func(t *testing.T) {
+		sink := shared.NewValidatingSink(&shared.TokenRecorder{})
+		_, err := sink.Step(&Token{Type: TArrOpen, Length: -1})
+		Wish(t, err, ShouldEqual, nil)
+		sink = shared.NewValidatingSink(neverDone{})
+		_, err = sink.Step(&Token{Type: TNull})
+		Wish(t, err, ShouldEqual, shared.ErrIncompleteValue{0, "value is complete, but sink expects more"})
+	})
+	t.Run("source", func(t *testing.T) {
+		var rec shared.TokenRecorder
+		err := shared.TokenPump{
+			shared.NewValidatingSource(json.NewDecoder(strings.NewReader(`{"a":[1,2]}`))),
+			&rec,
+		}.Run()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, len(rec.Tokens()), ShouldEqual, 7)
+	})
+	t.Run("source done early", func(t *testing.T) {
+		src := shared.NewValidatingSource(shared.NewTokenSlice([]Token{{Type: TArrOpen, Length: -1}, TokInt(1)}))
+		var tok Token
+		_, err := src.Step(&tok)
+		Wish(t, err, ShouldEqual, nil)
+		_, err = src.Step(&tok)
+		Wish(t, err, ShouldEqual, shared.ErrIncompleteValue{1, "source is done, but value isn't complete"})
+	})
+}
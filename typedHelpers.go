@@ -0,0 +1,38 @@
+package refmt
+
+import (
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+/*
+	Like `Unmarshal`, but allocates and returns the value, so the caller
+	doesn't have to declare a slot for it first:
+
+		cfg, err := refmt.UnmarshalAs[Config](json.DecodeOptions{}, data)
+*/
+func UnmarshalAs[T any](opts DecodeOptions, data []byte) (T, error) {
+	var v T
+	err := Unmarshal(opts, data, &v)
+	return v, err
+}
+
+// Like `UnmarshalAs`, but using the given atlas (as per `UnmarshalAtlased`).
+func UnmarshalAtlasedAs[T any](opts DecodeOptions, data []byte, atl atlas.Atlas) (T, error) {
+	var v T
+	err := UnmarshalAtlased(opts, data, &v, atl)
+	return v, err
+}
+
+// Like `Clone`, but allocates and returns the destination value of type T.
+func CloneAs[T any](src interface{}) (T, error) {
+	var v T
+	err := Clone(src, &v)
+	return v, err
+}
+
+// Like `CloneAs`, but using the given atlas (as per `CloneAtlased`).
+func CloneAtlasedAs[T any](src interface{}, atl atlas.Atlas) (T, error) {
+	var v T
+	err := CloneAtlased(src, &v, atl)
+	return v, err
+}
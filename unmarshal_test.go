@@ -45,3 +45,27 @@ func TestUnmarshalAtlased(t *testing.T) {
 		})
 	})
 }
+
+func TestUnmarshalAs(t *testing.T) {
+	Convey("json", t, func() {
+		Convey("map", func() {
+			v, err := UnmarshalAs[map[string]string](json.DecodeOptions{}, []byte(`{"x":"1"}`))
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, map[string]string{"x": "1"})
+		})
+		Convey("obj with typed transform", func() {
+			type testObj struct {
+				X string
+			}
+			atl := atlas.MustBuild(
+				atlas.TransformEntry(
+					func(x testObj) (string, error) { return x.X, nil },
+					func(x string) (testObj, error) { return testObj{x}, nil },
+				),
+			)
+			v, err := UnmarshalAtlasedAs[testObj](json.DecodeOptions{}, []byte(`"1"`), atl)
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, testObj{"1"})
+		})
+	})
+}